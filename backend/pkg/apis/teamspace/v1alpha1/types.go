@@ -0,0 +1,169 @@
+package v1alpha1
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// GroupName is the API group of the Teamspace resource
+	GroupName = "teamspaces.hypershift.io"
+	// Version is the API version of the Teamspace resource
+	Version = "v1alpha1"
+	// Kind is the kind of the Teamspace resource
+	Kind = "Teamspace"
+)
+
+var (
+	// SchemeGroupVersion is the group version used to register the Teamspace resource
+	SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+
+	// TeamspaceResource is the GroupVersionResource used with the dynamic client
+	TeamspaceResource = SchemeGroupVersion.WithResource("teamspaces")
+)
+
+// TeamspacePhase is a high level summary of where the teamspace is in its lifecycle
+type TeamspacePhase string
+
+const (
+	PhasePending      TeamspacePhase = "Pending"
+	PhaseProvisioning TeamspacePhase = "Provisioning"
+	PhaseReady        TeamspacePhase = "Ready"
+	PhaseFailed       TeamspacePhase = "Failed"
+	PhaseDeleting     TeamspacePhase = "Deleting"
+	PhaseHibernated   TeamspacePhase = "Hibernated"
+)
+
+// Condition types reported on a Teamspace
+const (
+	ConditionNamespaceReady     = "NamespaceReady"
+	ConditionHostedClusterReady = "HostedClusterReady"
+	ConditionKubeconfigReady    = "KubeconfigReady"
+	// ConditionExpiring is set by the reaper once the owner has been warned of the upcoming expiry
+	ConditionExpiring = "Expiring"
+)
+
+// Teamspace is a developer environment on the management cluster
+type Teamspace struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TeamspaceSpec   `json:"spec"`
+	Status TeamspaceStatus `json:"status,omitempty"`
+}
+
+// TeamspaceSpec is the desired state of a Teamspace
+type TeamspaceSpec struct {
+	// DisplayName is the name the owner gave the teamspace. Teamspaces without one are shown
+	// under the name of the object.
+	DisplayName string `json:"displayName,omitempty"`
+	// Owner is the GitHub username of the teamspace owner
+	Owner string `json:"owner"`
+	// Release is the release image of the initial HostedCluster
+	Release string `json:"release,omitempty"`
+	// FeatureSet is the OpenShift feature set of the initial HostedCluster
+	FeatureSet string `json:"featureSet,omitempty"`
+	// Template is the name of the profile the teamspace was created from
+	Template string `json:"template,omitempty"`
+	// Collaborators are the other users the teamspace is shared with
+	Collaborators []Collaborator `json:"collaborators,omitempty"`
+	// ExpiresAt is when the teamspace is deleted by the reaper; teamspaces without it never expire
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// Transfer is a handover of the teamspace waiting for the new owner to accept it
+	Transfer *OwnershipTransfer `json:"transfer,omitempty"`
+	// Placement records why the teamspace was created in its management cluster
+	Placement *Placement `json:"placement,omitempty"`
+}
+
+// Placement is the decision of the placement engine, kept for troubleshooting
+type Placement struct {
+	// Reason explains why the cluster was picked
+	Reason string `json:"reason"`
+	// Region is the region the user preferred, if any
+	Region    string      `json:"region,omitempty"`
+	DecidedAt metav1.Time `json:"decidedAt"`
+	// Candidates are the management clusters that were considered
+	Candidates []PlacementCandidate `json:"candidates,omitempty"`
+}
+
+// PlacementCandidate is how a management cluster fared in the placement of a teamspace
+type PlacementCandidate struct {
+	Cluster  string `json:"cluster"`
+	Eligible bool   `json:"eligible"`
+	// Score ranks the eligible clusters from 0 to 100
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// OwnershipTransfer is a pending change of owner
+type OwnershipTransfer struct {
+	// To is the GitHub username of the new owner
+	To string `json:"to"`
+	// RequestedBy is the GitHub username of the owner who offered the teamspace
+	RequestedBy string      `json:"requestedBy"`
+	RequestedAt metav1.Time `json:"requestedAt"`
+}
+
+// CollaboratorRole is the access a collaborator has to a teamspace
+type CollaboratorRole string
+
+const (
+	// RoleViewer can see the teamspace and its status
+	RoleViewer CollaboratorRole = "viewer"
+	// RoleEditor can also use the hosted cluster and change its lifecycle
+	RoleEditor CollaboratorRole = "editor"
+	// RoleAdmin can also delete the teamspace and manage its collaborators
+	RoleAdmin CollaboratorRole = "admin"
+)
+
+// Collaborator is a user a teamspace is shared with
+type Collaborator struct {
+	// Username is the GitHub username of the collaborator
+	Username string           `json:"username"`
+	Role     CollaboratorRole `json:"role"`
+}
+
+// TeamspaceStatus is the observed state of a Teamspace
+type TeamspaceStatus struct {
+	Phase              TeamspacePhase     `json:"phase,omitempty"`
+	Namespace          string             `json:"namespace,omitempty"`
+	ObservedGeneration int64              `json:"observedGeneration,omitempty"`
+	Conditions         []metav1.Condition `json:"conditions,omitempty"`
+	// LastError is the most recent reconciliation error, cleared once reconciliation succeeds
+	LastError string `json:"lastError,omitempty"`
+	// ProvisionedAt is when the teamspace first became ready
+	ProvisionedAt *metav1.Time `json:"provisionedAt,omitempty"`
+}
+
+// DeepCopy returns a copy of the status that shares no slices or pointers with the original
+func (s *TeamspaceStatus) DeepCopy() *TeamspaceStatus {
+	out := *s
+	out.Conditions = append([]metav1.Condition(nil), s.Conditions...)
+	out.ProvisionedAt = s.ProvisionedAt.DeepCopy()
+	return &out
+}
+
+// FromUnstructured converts an object returned by the dynamic client into a Teamspace
+func FromUnstructured(u *unstructured.Unstructured) (*Teamspace, error) {
+	ts := &Teamspace{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), ts); err != nil {
+		return nil, fmt.Errorf("failed to convert teamspace %s: %v", u.GetName(), err)
+	}
+	return ts, nil
+}
+
+// ToUnstructured converts the Teamspace into an object usable with the dynamic client
+func (t *Teamspace) ToUnstructured() (*unstructured.Unstructured, error) {
+	t.APIVersion = SchemeGroupVersion.String()
+	t.Kind = Kind
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(t)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert teamspace %s: %v", t.Name, err)
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/metrics"
+)
+
+// ErrQueryUnsupported is returned by queries when no configured sink can be read back
+var ErrQueryUnsupported = errors.New("no audit sink supports queries")
+
+// queueSize is how many records can wait for the sinks before records are dropped
+const queueSize = 1024
+
+// defaultQueryLimit bounds the records returned by a query that sets no limit
+const defaultQueryLimit = 100
+
+// Outcome is how an audited action ended
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	// OutcomeDenied is an action refused for lack of authentication or permission
+	OutcomeDenied  Outcome = "denied"
+	OutcomeFailure Outcome = "failure"
+)
+
+// OutcomeOf derives the outcome of a request from its response status
+func OutcomeOf(status int) Outcome {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return OutcomeDenied
+	case status >= 400:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// Record is a single audited action
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	// Actor is the GitHub username of the caller, empty when they are not logged in
+	Actor   string  `json:"actor"`
+	Action  string  `json:"action"`
+	Target  string  `json:"target,omitempty"`
+	Outcome Outcome `json:"outcome"`
+	Status  int     `json:"status,omitempty"`
+	Method  string  `json:"method,omitempty"`
+	Path    string  `json:"path,omitempty"`
+	// SourceIP is the peer address of the connection; ForwardedFor is the X-Forwarded-For header
+	// set by proxies in front of the backend, which clients can also forge
+	SourceIP     string `json:"sourceIP"`
+	ForwardedFor string `json:"forwardedFor,omitempty"`
+	// Detail explains the outcome when the status alone does not
+	Detail string `json:"detail,omitempty"`
+}
+
+// Filter selects records in a query; empty fields match every record
+type Filter struct {
+	// Actor matches the actor case insensitively
+	Actor  string
+	Action string
+	Since  time.Time
+	Until  time.Time
+	// Limit is the maximum number of records returned, the most recent first
+	Limit int
+}
+
+// Matches reports whether the record passes the filter
+func (f Filter) Matches(r Record) bool {
+	if f.Actor != "" && !strings.EqualFold(r.Actor, f.Actor) {
+		return false
+	}
+	if f.Action != "" && r.Action != f.Action {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && r.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+func (f Filter) limit() int {
+	if f.Limit <= 0 {
+		return defaultQueryLimit
+	}
+	return f.Limit
+}
+
+// Sink is a destination of audit records
+type Sink interface {
+	Write(ctx context.Context, r Record) error
+}
+
+// Querier is implemented by sinks that can read their records back
+type Querier interface {
+	Query(ctx context.Context, f Filter) ([]Record, error)
+}
+
+// Logger writes audit records to every sink in the background, so slow sinks do not hold up
+// requests. Records are written in order.
+type Logger struct {
+	sinks   []Sink
+	records chan Record
+	done    chan struct{}
+}
+
+// NewLogger starts a logger writing to the sinks
+func NewLogger(sinks ...Sink) *Logger {
+	l := &Logger{
+		sinks:   sinks,
+		records: make(chan Record, queueSize),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+func (l *Logger) run() {
+	defer close(l.done)
+	for r := range l.records {
+		for _, sink := range l.sinks {
+			if err := sink.Write(context.Background(), r); err != nil {
+				slog.Error("Failed to write audit record", "action", r.Action, "actor", r.Actor, "error", err)
+			}
+		}
+	}
+}
+
+// Record queues the record for the sinks. It never holds up the request: when the sinks fall so
+// far behind that the queue is full, the record is dropped and counted.
+func (l *Logger) Record(r Record) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	select {
+	case l.records <- r:
+	default:
+		metrics.AuditRecordsDropped.Inc()
+		slog.Warn("Dropped audit record as the sinks fall behind", "action", r.Action, "actor", r.Actor)
+	}
+}
+
+// Close writes the queued records and stops the logger
+func (l *Logger) Close() {
+	close(l.records)
+	<-l.done
+}
+
+// Query reads records back from the first sink that supports it, the most recent first
+func (l *Logger) Query(ctx context.Context, f Filter) ([]Record, error) {
+	for _, sink := range l.sinks {
+		if querier, ok := sink.(Querier); ok {
+			return querier.Query(ctx, f)
+		}
+	}
+	return nil, ErrQueryUnsupported
+}
+
+// newestFirst sorts the records from the most recent and keeps the limit of the filter
+func newestFirst(records []Record, f Filter) []Record {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.After(records[j].Time)
+	})
+	if len(records) > f.limit() {
+		records = records[:f.limit()]
+	}
+	return records
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the record of the request, which handlers fill in
+// with what only they know through SetActor, SetTarget and SetDetail
+func NewContext(ctx context.Context, r *Record) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the record of the request, or nil if it is not audited
+func FromContext(ctx context.Context) *Record {
+	r, _ := ctx.Value(contextKey{}).(*Record)
+	return r
+}
+
+// SetActor records who made the request, for requests that establish it such as logins
+func SetActor(ctx context.Context, actor string) {
+	if r := FromContext(ctx); r != nil {
+		r.Actor = actor
+	}
+}
+
+// SetTarget records the object the request acted on, for requests that create it
+func SetTarget(ctx context.Context, target string) {
+	if r := FromContext(ctx); r != nil {
+		r.Target = target
+	}
+}
+
+// SetDetail records why the request ended the way it did
+func SetDetail(ctx context.Context, detail string) {
+	if r := FromContext(ctx); r != nil {
+		r.Detail = detail
+	}
+}
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/teamspace-app/backend/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testRecords(start time.Time) []Record {
+	return []Record{
+		{Time: start, Actor: "octocat", Action: "teamspace.create", Target: "demo-1a2b3c4d", Outcome: OutcomeSuccess},
+		{Time: start.Add(time.Minute), Actor: "hubot", Action: "kubeconfig.download", Target: "demo-1a2b3c4d", Outcome: OutcomeDenied},
+		{Time: start.Add(2 * time.Minute), Actor: "Octocat", Action: "kubeconfig.download", Target: "demo-1a2b3c4d", Outcome: OutcomeSuccess},
+	}
+}
+
+// querySink writes the records through a logger and queries the sink back
+func querySink(t *testing.T, sink Sink, filter Filter) []Record {
+	t.Helper()
+	logger := NewLogger(sink)
+	for _, r := range testRecords(time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC)) {
+		logger.Record(r)
+	}
+	logger.Close()
+
+	records, err := logger.Query(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("failed to query records: %v", err)
+	}
+	return records
+}
+
+func TestFileSinkQuery(t *testing.T) {
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to open sink: %v", err)
+	}
+
+	records := querySink(t, sink, Filter{Actor: "octocat"})
+	if len(records) != 2 || records[0].Action != "kubeconfig.download" || records[1].Action != "teamspace.create" {
+		t.Errorf("expected both records of octocat, the most recent first, got %+v", records)
+	}
+
+	records = querySink(t, sink, Filter{Since: time.Date(2025, 1, 2, 15, 1, 0, 0, time.UTC), Limit: 1})
+	if len(records) != 1 || records[0].Actor != "Octocat" {
+		t.Errorf("expected only the most recent record, got %+v", records)
+	}
+}
+
+func TestEventSinkQuery(t *testing.T) {
+	clientset := fake.NewClientset()
+	// The fake clientset leaves names to generate to the API server
+	generated := 0
+	clientset.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		event := action.(k8stesting.CreateAction).GetObject().(*corev1.Event)
+		generated++
+		event.Name = fmt.Sprintf("%s%d", event.GenerateName, generated)
+		return false, nil, nil
+	})
+	sink := NewEventSink(clientset.CoreV1(), "teamspaces")
+
+	records := querySink(t, sink, Filter{Actor: "octocat", Action: "kubeconfig.download"})
+	if len(records) != 1 || records[0].Actor != "Octocat" {
+		t.Errorf("expected the kubeconfig download of octocat, got %+v", records)
+	}
+
+	// Email usernames of OIDC providers can't be label values, so the label holds their hash
+	logger := NewLogger(sink)
+	logger.Record(Record{Time: time.Now(), Actor: "Jane.Doe@example.com", Action: "teamspace.create", Target: "demo-1a2b3c4d", Outcome: OutcomeSuccess})
+	logger.Close()
+	records, err := sink.Query(context.Background(), Filter{Actor: "jane.doe@example.com"})
+	if err != nil {
+		t.Fatalf("failed to query records: %v", err)
+	}
+	if len(records) != 1 || records[0].Actor != "Jane.Doe@example.com" {
+		t.Errorf("expected the teamspace create of jane, got %+v", records)
+	}
+}
+
+func TestQueryUnsupported(t *testing.T) {
+	logger := NewLogger()
+	defer logger.Close()
+	if _, err := logger.Query(context.Background(), Filter{}); err != ErrQueryUnsupported {
+		t.Errorf("expected queries to be unsupported without a file or events sink, got %v", err)
+	}
+}
+
+// stuckSink holds every write until it is released
+type stuckSink struct {
+	release chan struct{}
+}
+
+func (s *stuckSink) Write(ctx context.Context, r Record) error {
+	<-s.release
+	return nil
+}
+
+func TestRecordDropsWhenTheSinksFallBehind(t *testing.T) {
+	sink := &stuckSink{release: make(chan struct{})}
+	logger := NewLogger(sink)
+	defer logger.Close()
+	defer close(sink.release)
+
+	before := testutil.ToFloat64(metrics.AuditRecordsDropped)
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		// One record is held by the sink, the queue holds the next ones, and the rest are dropped
+		for i := 0; i < queueSize+3; i++ {
+			logger.Record(Record{Action: "teamspace.create"})
+		}
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected recording to go on while the sink is stuck")
+	}
+	if dropped := testutil.ToFloat64(metrics.AuditRecordsDropped) - before; dropped < 2 {
+		t.Errorf("expected the records that did not fit in the queue to be counted, got %v", dropped)
+	}
+}
+
+func TestOutcomeOf(t *testing.T) {
+	for status, want := range map[int]Outcome{
+		http.StatusOK:                  OutcomeSuccess,
+		http.StatusTemporaryRedirect:   OutcomeSuccess,
+		http.StatusUnauthorized:        OutcomeDenied,
+		http.StatusForbidden:           OutcomeDenied,
+		http.StatusNotFound:            OutcomeFailure,
+		http.StatusInternalServerError: OutcomeFailure,
+	} {
+		if got := OutcomeOf(status); got != want {
+			t.Errorf("expected status %d to be a %s, got %s", status, want, got)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/teamspace-app/backend/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	// auditLabel marks the Events written by the events sink
+	auditLabel = "teamspaces.hypershift.io/audit"
+	// actorLabel and actionLabel let queries select Events on the server
+	actorLabel  = "teamspaces.hypershift.io/audit-actor"
+	actionLabel = "teamspaces.hypershift.io/audit-action"
+)
+
+// actorHash encodes an actor for the actor label, which can't hold the emails and other
+// usernames of OIDC providers. It matches the username hash of the Teamspace labels.
+func actorHash(actor string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(actor)))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// NewSinks builds the sinks described by the config. The events client is only used by the
+// events sink.
+func NewSinks(cfg config.AuditConfig, events corev1client.EventsGetter) ([]Sink, error) {
+	var sinks []Sink
+	for _, sinkConfig := range cfg.Sinks {
+		switch sinkConfig.Type {
+		case "stdout":
+			sinks = append(sinks, NewWriterSink(os.Stdout))
+		case "file":
+			sink, err := NewFileSink(sinkConfig.Path)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case "events":
+			sinks = append(sinks, NewEventSink(events, sinkConfig.Namespace))
+		default:
+			return nil, fmt.Errorf("unknown audit sink type %q", sinkConfig.Type)
+		}
+	}
+	return sinks, nil
+}
+
+// WriterSink writes records as JSON lines, e.g. to stdout for the log collector of the cluster
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(_ context.Context, r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+// FileSink appends records as JSON lines to a file, and answers queries by scanning it
+type FileSink struct {
+	WriterSink
+	path string
+}
+
+// NewFileSink opens the file for appending, creating it if needed
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %v", path, err)
+	}
+	return &FileSink{WriterSink: WriterSink{w: file}, path: path}, nil
+}
+
+func (s *FileSink) Query(_ context.Context, f Filter) ([]Record, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %v", s.path, err)
+	}
+	defer file.Close()
+
+	// Records are appended in order, so only the most recent matches are kept while scanning
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if !f.Matches(r) {
+			continue
+		}
+		records = append(records, r)
+		if len(records) > 2*f.limit() {
+			records = records[len(records)-f.limit():]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %v", s.path, err)
+	}
+	return newestFirst(records, f), nil
+}
+
+// EventSink records each action as a Kubernetes Event in a namespace, where it shows up in
+// `oc get events`. The API server deletes Events after its event TTL, one hour by default, so
+// pair it with another sink for a lasting record.
+type EventSink struct {
+	events    corev1client.EventsGetter
+	namespace string
+}
+
+func NewEventSink(events corev1client.EventsGetter, namespace string) *EventSink {
+	return &EventSink{events: events, namespace: namespace}
+}
+
+func (s *EventSink) Write(ctx context.Context, r Record) error {
+	message, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %v", err)
+	}
+
+	eventLabels := map[string]string{auditLabel: "true"}
+	if r.Actor != "" {
+		eventLabels[actorLabel] = actorHash(r.Actor)
+	}
+	if len(validation.IsValidLabelValue(r.Action)) == 0 {
+		eventLabels[actionLabel] = r.Action
+	}
+	eventType := corev1.EventTypeNormal
+	if r.Outcome != OutcomeSuccess {
+		eventType = corev1.EventTypeWarning
+	}
+
+	_, err = s.events.Events(s.namespace).Create(ctx, &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "teamspace-audit-",
+			Namespace:    s.namespace,
+			Labels:       eventLabels,
+		},
+		// Events must be about an object; the records are filed under their namespace
+		InvolvedObject: corev1.ObjectReference{APIVersion: "v1", Kind: "Namespace", Name: s.namespace, Namespace: s.namespace},
+		Reason:         r.Action,
+		Message:        string(message),
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: "teamspace-audit"},
+		FirstTimestamp: metav1.NewTime(r.Time),
+		LastTimestamp:  metav1.NewTime(r.Time),
+		Count:          1,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %v", err)
+	}
+	return nil
+}
+
+func (s *EventSink) Query(ctx context.Context, f Filter) ([]Record, error) {
+	selector := labels.Set{auditLabel: "true"}
+	if f.Actor != "" {
+		selector[actorLabel] = actorHash(f.Actor)
+	}
+	if f.Action != "" {
+		selector[actionLabel] = f.Action
+	}
+	if invalidLabels(selector) {
+		// An action that cannot be a label value was never labelled
+		return []Record{}, nil
+	}
+
+	list, err := s.events.Events(s.namespace).List(ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(selector).String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %v", err)
+	}
+	records := []Record{}
+	for _, event := range list.Items {
+		var r Record
+		if err := json.Unmarshal([]byte(event.Message), &r); err != nil {
+			continue
+		}
+		if f.Matches(r) {
+			records = append(records, r)
+		}
+	}
+	return newestFirst(records, f), nil
+}
+
+func invalidLabels(set labels.Set) bool {
+	for _, value := range set {
+		if len(validation.IsValidLabelValue(value)) > 0 {
+			return true
+		}
+	}
+	return false
+}
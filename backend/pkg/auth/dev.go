@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/teamspace-app/backend/pkg/config"
+)
+
+// NewDevAuthHandler returns an auth handler for local development, whose login lets the user
+// pick any username and teams instead of going through GitHub
+func NewDevAuthHandler(appConfig *config.Config, store *sessions.CookieStore, allowedTeams []string) *AuthHandler {
+	h := NewAuthHandler(nil, appConfig, store, allowedTeams)
+	h.dev = true
+	return h
+}
+
+var devLoginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Teamspace development login</title></head>
+<body>
+<h1>Development login</h1>
+<p>The backend runs in development mode: log in as any user, with any teams.</p>
+<form method="get" action="/auth/callback">
+<input type="hidden" name="state" value="{{.State}}">
+<p><label>Username <input name="username" value="developer" required></label></p>
+<p><label>Teams, comma separated <input name="teams" value="{{.Teams}}"></label></p>
+{{if .Allowed}}<p>Allowed teams: {{.Allowed}}</p>{{end}}
+{{if .Admin}}<p>Admin teams: {{.Admin}}</p>{{end}}
+<p><button type="submit">Log in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// renderDevLogin shows the form that stands in for GitHub, which submits to the callback
+func (h *AuthHandler) renderDevLogin(w http.ResponseWriter, r *http.Request, state string) {
+	teams := ""
+	if len(h.allowed) > 0 {
+		teams = h.allowed[0]
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := devLoginPage.Execute(w, map[string]string{
+		"State":   state,
+		"Teams":   teams,
+		"Allowed": strings.Join(h.allowed, ", "),
+		"Admin":   strings.Join(h.appConfig.App.AdminTeams, ", "),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to render the development login", "error", err)
+	}
+}
+
+// devIdentity returns the username and teams submitted by the development login
+func devIdentity(r *http.Request) (string, []string) {
+	username := strings.TrimSpace(r.URL.Query().Get("username"))
+	teams := []string{}
+	for _, team := range strings.Split(r.URL.Query().Get("teams"), ",") {
+		if team = strings.TrimSpace(team); team != "" {
+			teams = append(teams, team)
+		}
+	}
+	return username, teams
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/teamspace-app/backend/pkg/config"
+	"golang.org/x/oauth2"
+)
+
+// githubUsername matches valid GitHub usernames
+var githubUsername = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9]|-[A-Za-z0-9]){0,38}$`)
+
+// githubProvider logs users in through a GitHub OAuth app, with the teams they belong to in the
+// configured org
+type githubProvider struct {
+	config *oauth2.Config
+	apiURL string
+	org    string
+	client *http.Client // Client for GitHub, instrumented for metrics
+}
+
+// NewGitHubProvider returns the provider of the GitHub or GitHub Enterprise Server in the config
+func NewGitHubProvider(appConfig *config.Config) IdentityProvider {
+	return &githubProvider{
+		config: &oauth2.Config{
+			ClientID:     appConfig.OAuth.GithubClientID,
+			ClientSecret: appConfig.OAuth.GithubClientSecret,
+			RedirectURL:  appConfig.OAuth.RedirectURL,
+			Scopes:       []string{"read:org", "read:user", "user:email"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  appConfig.OAuth.GithubURL + "/login/oauth/authorize",
+				TokenURL: appConfig.OAuth.GithubURL + "/login/oauth/access_token",
+			},
+		},
+		apiURL: appConfig.OAuth.GithubAPIURL,
+		org:    appConfig.App.GithubOrg,
+		client: &http.Client{Transport: &githubTransport{base: http.DefaultTransport}},
+	}
+}
+
+func (p *githubProvider) Name() string {
+	return "GitHub"
+}
+
+// AuthCodeURL ignores the nonce, as GitHub issues no ID token
+func (p *githubProvider) AuthCodeURL(state string, nonce string) string {
+	return p.config.AuthCodeURL(state, oauth2.AccessTypeOnline)
+}
+
+func (p *githubProvider) ValidUsername(username string) bool {
+	return githubUsername.MatchString(username)
+}
+
+func (p *githubProvider) Identify(ctx context.Context, code string, nonce string) (*Identity, error) {
+	// Exchange the code for a token
+	token, err := p.config.Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.client), code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %v", err)
+	}
+
+	// Get user information from GitHub
+	username, err := p.getUserInfo(ctx, token.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user info: %v", err)
+	}
+
+	// Get user's GitHub teams
+	teams, err := p.getUserTeams(ctx, token.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get teams of %s: %v", username, err)
+	}
+
+	return &Identity{Username: username, Teams: teams, AccessToken: token.AccessToken}, nil
+}
+
+// getUserInfo gets the user's GitHub username
+func (p *githubProvider) getUserInfo(ctx context.Context, accessToken string) (string, error) {
+	client := p.client
+	userReq, err := http.NewRequestWithContext(ctx, "GET", p.apiURL+"/user", nil)
+	if err != nil {
+		return "", err
+	}
+
+	userReq.Header.Set("Authorization", "Bearer "+accessToken)
+	userReq.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	userResp, err := client.Do(userReq)
+	if err != nil {
+		return "", err
+	}
+	defer userResp.Body.Close()
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(userResp.Body).Decode(&user); err != nil {
+		return "", err
+	}
+
+	slog.DebugContext(ctx, "Got GitHub user", "user", user.Login)
+	return user.Login, nil
+}
+
+func (p *githubProvider) getUserTeams(ctx context.Context, accessToken string) ([]string, error) {
+	// First get the user's login
+	client := p.client
+	userReq, err := http.NewRequestWithContext(ctx, "GET", p.apiURL+"/user", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating user request: %v", err)
+	}
+
+	userReq.Header.Set("Authorization", "Bearer "+accessToken)
+	userReq.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	userResp, err := client.Do(userReq)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user: %v", err)
+	}
+	defer userResp.Body.Close()
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.NewDecoder(userResp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("error decoding user response: %v", err)
+	}
+
+	// Check if GitHub org is configured
+	if p.org == "" {
+		slog.DebugContext(ctx, "No GitHub org configured, the user has no teams")
+		return []string{}, nil
+	}
+
+	// Check if user is a member of the organization
+	orgReq, err := http.NewRequestWithContext(ctx, "GET",
+		fmt.Sprintf("%s/orgs/%s/members/%s", p.apiURL, p.org, user.Login), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating org membership request: %v", err)
+	}
+
+	orgReq.Header.Set("Authorization", "Bearer "+accessToken)
+	orgReq.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	orgResp, err := client.Do(orgReq)
+	if err != nil {
+		return nil, fmt.Errorf("error checking org membership: %v", err)
+	}
+	defer orgResp.Body.Close()
+
+	slog.DebugContext(ctx, "Checked GitHub org membership", "user", user.Login, "org", p.org, "status", orgResp.StatusCode)
+
+	// If user is not a member of the org, return empty teams list
+	if orgResp.StatusCode != http.StatusNoContent {
+		slog.InfoContext(ctx, "User is not a member of the GitHub org", "user", user.Login, "org", p.org)
+		return []string{}, nil
+	}
+
+	// Fetch the user's teams in the organization
+	teamsReq, err := http.NewRequestWithContext(ctx, "GET",
+		p.apiURL+"/user/teams?per_page=100", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating teams request: %v", err)
+	}
+
+	teamsReq.Header.Set("Authorization", "Bearer "+accessToken)
+	teamsReq.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	teamsResp, err := client.Do(teamsReq)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching teams: %v", err)
+	}
+	defer teamsResp.Body.Close()
+
+	var teamsData []struct {
+		Name string `json:"name"`
+		Org  struct {
+			Login string `json:"login"`
+		} `json:"organization"`
+	}
+
+	if err := json.NewDecoder(teamsResp.Body).Decode(&teamsData); err != nil {
+		return nil, fmt.Errorf("error decoding teams response: %v", err)
+	}
+
+	// Filter teams to only include those from the configured organization
+	var teams []string
+	for _, team := range teamsData {
+		if team.Org.Login == p.org {
+			teams = append(teams, team.Name)
+		}
+	}
+
+	slog.DebugContext(ctx, "Got GitHub teams", "user", user.Login, "org", p.org, "teams", teams)
+
+	return teams, nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/metrics"
+)
+
+// githubTransport records the count, latency and rate limit of requests to GitHub
+type githubTransport struct {
+	base http.RoundTripper
+}
+
+func (t *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := githubEndpoint(req)
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	metrics.GitHubRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.GitHubRequests.WithLabelValues(endpoint, "error").Inc()
+		return nil, err
+	}
+	metrics.GitHubRequests.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+
+	// The OAuth endpoints of github.com are not rate limited like the API, and send no headers
+	resource := resp.Header.Get("X-RateLimit-Resource")
+	if resource == "" {
+		resource = "core"
+	}
+	if remaining, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Remaining"), 64); err == nil {
+		metrics.GitHubRateLimitRemaining.WithLabelValues(resource).Set(remaining)
+	}
+	if reset, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Reset"), 64); err == nil {
+		metrics.GitHubRateLimitReset.WithLabelValues(resource).Set(reset)
+	}
+	return resp, nil
+}
+
+// githubEndpoint names the endpoint of a request without the usernames and orgs in its path,
+// which would make a metric series per user
+func githubEndpoint(req *http.Request) string {
+	path := req.URL.Path
+	switch {
+	case req.URL.Host == "github.com" && strings.HasPrefix(path, "/login/oauth/"):
+		return path
+	case strings.HasPrefix(path, "/orgs/") && strings.Contains(path, "/members/"):
+		return "/orgs/{org}/members/{username}"
+	case path == "/user" || path == "/user/teams":
+		return path
+	default:
+		return "other"
+	}
+}
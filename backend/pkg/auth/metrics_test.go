@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/teamspace-app/backend/pkg/metrics"
+)
+
+func TestGitHubEndpoint(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://github.com/login/oauth/access_token":       "/login/oauth/access_token",
+		"https://api.github.com/user":                       "/user",
+		"https://api.github.com/user/teams?per_page=100":    "/user/teams",
+		"https://api.github.com/orgs/acme/members/octocat":  "/orgs/{org}/members/{username}",
+		"https://api.github.com/repos/acme/teamspace/pulls": "other",
+	} {
+		req := httptest.NewRequest("GET", url, nil)
+		if got := githubEndpoint(req); got != want {
+			t.Errorf("expected %s to be reported as %s, got %s", url, want, got)
+		}
+	}
+}
+
+func TestGitHubTransportRecordsRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Resource", "core")
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Header().Set("X-RateLimit-Reset", "1735830000")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &githubTransport{base: http.DefaultTransport}}
+	before := testutil.ToFloat64(metrics.GitHubRequests.WithLabelValues("/user", "200"))
+	resp, err := client.Get(server.URL + "/user")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := testutil.ToFloat64(metrics.GitHubRequests.WithLabelValues("/user", "200")); got != before+1 {
+		t.Errorf("expected the request to be counted, got %v after %v", got, before)
+	}
+	if got := testutil.ToFloat64(metrics.GitHubRateLimitRemaining.WithLabelValues("core")); got != 4999 {
+		t.Errorf("expected 4999 requests left, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.GitHubRateLimitReset.WithLabelValues("core")); got != 1735830000 {
+		t.Errorf("expected the reset time from the header, got %v", got)
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/teamspace-app/backend/pkg/config"
+	"golang.org/x/oauth2"
+)
+
+// oidcProvider logs users in through an OpenID Connect provider such as Keycloak or Dex, with
+// the groups of their ID token as teams
+type oidcProvider struct {
+	name          string
+	config        *oauth2.Config
+	verifier      *oidc.IDTokenVerifier
+	usernameClaim string
+	groupsClaim   string
+}
+
+// NewOIDCProvider discovers the endpoints and signing keys of the issuer in the config
+func NewOIDCProvider(ctx context.Context, appConfig *config.Config) (IdentityProvider, error) {
+	cfg := appConfig.OAuth.OIDC
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer %s: %v", cfg.IssuerURL, err)
+	}
+
+	return &oidcProvider{
+		name: cfg.DisplayName,
+		config: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  appConfig.OAuth.RedirectURL,
+			Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+			Endpoint:     provider.Endpoint(),
+		},
+		verifier:      provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		usernameClaim: cfg.UsernameClaim,
+		groupsClaim:   cfg.GroupsClaim,
+	}, nil
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) AuthCodeURL(state string, nonce string) string {
+	return p.config.AuthCodeURL(state, oidc.Nonce(nonce))
+}
+
+// ValidUsername accepts any claim, as providers let the username claim be an email or anything else
+func (p *oidcProvider) ValidUsername(username string) bool {
+	return validClaim(username)
+}
+
+func (p *oidcProvider) Identify(ctx context.Context, code string, nonce string) (*Identity, error) {
+	token, err := p.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %v", err)
+	}
+
+	// The ID token is checked against the keys of the issuer, the client and the nonce of the
+	// login, so a token issued for another client or replayed from another login is refused
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no ID token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ID token: %v", err)
+	}
+	if nonce == "" || idToken.Nonce != nonce {
+		return nil, fmt.Errorf("ID token nonce does not match the login")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode ID token claims: %v", err)
+	}
+	username, _ := claims[p.usernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("ID token has no %q claim", p.usernameClaim)
+	}
+	teams := groupsToTeams(claims[p.groupsClaim])
+
+	slog.DebugContext(ctx, "Got OIDC user", "user", username, "subject", idToken.Subject, "teams", teams)
+	return &Identity{Username: username, Teams: teams, AccessToken: token.AccessToken}, nil
+}
+
+// groupsToTeams reads a groups claim, a list or a single group. Keycloak writes the full path of
+// groups when configured to, such as "/platform/sre", which is matched without the leading slash.
+func groupsToTeams(claim interface{}) []string {
+	var groups []interface{}
+	switch value := claim.(type) {
+	case []interface{}:
+		groups = value
+	case string:
+		groups = []interface{}{value}
+	}
+
+	teams := []string{}
+	for _, group := range groups {
+		if name, ok := group.(string); ok && name != "" {
+			teams = append(teams, strings.TrimPrefix(name, "/"))
+		}
+	}
+	return teams
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/config"
+)
+
+// newFakeIssuer serves the discovery document, the signing keys and the token endpoint of an
+// OIDC provider. The code of a login is the index of its claims in logins.
+func newFakeIssuer(t *testing.T, logins []map[string]interface{}) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := http.NewServeMux()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	router.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                server.URL,
+			"authorization_endpoint":                server.URL + "/auth",
+			"token_endpoint":                        server.URL + "/token",
+			"jwks_uri":                              server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	router.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	router.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		login, err := strconv.Atoi(r.FormValue("code"))
+		if err != nil || login >= len(logins) {
+			http.Error(w, "invalid code", http.StatusBadRequest)
+			return
+		}
+		claims := map[string]interface{}{
+			"iss": server.URL,
+			"aud": "teamspace",
+			"sub": "1234",
+			"iat": time.Now().Unix(),
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for name, value := range logins[login] {
+			claims[name] = value
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token",
+			"token_type":   "Bearer",
+			"id_token":     signJWT(t, key, claims),
+		})
+	})
+	return server
+}
+
+// signJWT returns the claims as a JWT signed with RS256
+func signJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCProvider(t *testing.T) {
+	issuer := newFakeIssuer(t, []map[string]interface{}{
+		{"nonce": "n0", "preferred_username": "alice", "groups": []string{"/platform", "dev"}},
+		{"nonce": "other", "preferred_username": "alice"},
+		{"nonce": "n2", "preferred_username": "bob", "aud": "another-client"},
+		{"nonce": "n3", "email": "carol@example.com"},
+	})
+
+	appConfig := config.Default()
+	appConfig.OAuth.Provider = config.ProviderOIDC
+	appConfig.OAuth.RedirectURL = "https://teamspace.example.com/auth/callback"
+	appConfig.OAuth.OIDC.IssuerURL = issuer.URL
+	appConfig.OAuth.OIDC.ClientID = "teamspace"
+	appConfig.OAuth.OIDC.DisplayName = "Keycloak"
+	provider, err := NewIdentityProvider(t.Context(), appConfig)
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+	if provider.Name() != "Keycloak" {
+		t.Errorf("expected the display name of the config, got %q", provider.Name())
+	}
+
+	login, err := url.Parse(provider.AuthCodeURL("state", "n0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(login.String(), issuer.URL+"/auth?") {
+		t.Errorf("expected a redirect to the discovered authorization endpoint, got %s", login)
+	}
+	query := login.Query()
+	if query.Get("nonce") != "n0" || query.Get("state") != "state" || query.Get("scope") != "openid profile email" {
+		t.Errorf("expected the state, the nonce and the scopes in the redirect, got %s", query.Encode())
+	}
+
+	identity, err := provider.Identify(t.Context(), "0", "n0")
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	want := &Identity{Username: "alice", Teams: []string{"platform", "dev"}, AccessToken: "token"}
+	if !reflect.DeepEqual(identity, want) {
+		t.Errorf("expected %+v, got %+v", want, identity)
+	}
+
+	for code, reason := range map[string]string{
+		"1": "nonce does not match",
+		"2": "failed to verify",
+		"3": `no "preferred_username" claim`,
+	} {
+		if _, err := provider.Identify(t.Context(), code, "n"+code); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("expected login %s to fail as %q, got %v", code, reason, err)
+		}
+	}
+}
+
+func TestGroupsToTeams(t *testing.T) {
+	for _, test := range []struct {
+		claim interface{}
+		want  []string
+	}{
+		{nil, []string{}},
+		{"sre", []string{"sre"}},
+		{[]interface{}{"/org/sre", "dev", 42, ""}, []string{"org/sre", "dev"}},
+	} {
+		if got := groupsToTeams(test.claim); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("expected %v to map to %v, got %v", test.claim, test.want, got)
+		}
+	}
+}
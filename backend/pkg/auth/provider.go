@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/teamspace-app/backend/pkg/config"
+)
+
+// Identity is who logged in, with the teams allowed_teams and admin_teams are matched against
+type Identity struct {
+	Username string
+	Teams    []string
+	// AccessToken is the token the provider issued, kept in the session
+	AccessToken string
+}
+
+// IdentityProvider logs users in through the authorization code flow of OAuth 2.0
+type IdentityProvider interface {
+	// Name is shown on the login button, such as "GitHub"
+	Name() string
+	// AuthCodeURL is where the login redirects to. The nonce must be found in the ID token of
+	// providers that issue one.
+	AuthCodeURL(state string, nonce string) string
+	// Identify exchanges the code of the callback and returns who logged in
+	Identify(ctx context.Context, code string, nonce string) (*Identity, error)
+	// ValidUsername reports whether the username could be one of the provider, for users named
+	// before they log in, such as collaborators and the recipients of transfers
+	ValidUsername(username string) bool
+}
+
+// validClaim reports whether a username of a provider that puts no rules on them, such as an
+// email, could be one: any text without control characters
+func validClaim(username string) bool {
+	return username != "" && utf8.ValidString(username) && !strings.ContainsFunc(username, unicode.IsControl)
+}
+
+// NewIdentityProvider returns the provider selected in the config. OIDC providers are
+// discovered from their issuer, which must be reachable.
+func NewIdentityProvider(ctx context.Context, appConfig *config.Config) (IdentityProvider, error) {
+	switch appConfig.OAuth.Provider {
+	case config.ProviderGitHub:
+		return NewGitHubProvider(appConfig), nil
+	case config.ProviderOIDC:
+		return NewOIDCProvider(ctx, appConfig)
+	default:
+		return nil, fmt.Errorf("unknown identity provider %q", appConfig.OAuth.Provider)
+	}
+}
@@ -4,12 +4,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // Config represents the application configuration
 type Config struct {
 	Server struct {
 		Port int `json:"port"`
+		// MetricsPort serves /metrics apart from the API, so the public route doesn't expose it
+		MetricsPort int `json:"metrics_port"`
+		// ReadTimeout, WriteTimeout and IdleTimeout bound the requests and connections of the
+		// API server; watch streams are exempt from the write timeout
+		ReadTimeout  Duration `json:"read_timeout"`
+		WriteTimeout Duration `json:"write_timeout"`
+		IdleTimeout  Duration `json:"idle_timeout"`
+		// ShutdownTimeout is how long in-flight requests and background workers are given to
+		// finish on SIGTERM; keep it below the terminationGracePeriodSeconds of the pod
+		ShutdownTimeout Duration `json:"shutdown_timeout"`
 	} `json:"server"`
 
 	Session struct {
@@ -18,16 +38,259 @@ type Config struct {
 	} `json:"session"`
 
 	OAuth struct {
+		// Provider is the identity provider users log in with, "github" or "oidc"
+		Provider string `json:"provider,omitempty"`
+
 		GithubClientID     string `json:"github_client_id"`
 		GithubClientSecret string `json:"github_client_secret"`
 		RedirectURL        string `json:"redirect_url"`
+		// GithubURL and GithubAPIURL point to the web and API endpoints of GitHub, which differ
+		// on GitHub Enterprise Server
+		GithubURL    string `json:"github_url,omitempty"`
+		GithubAPIURL string `json:"github_api_url,omitempty"`
+
+		OIDC OIDCConfig `json:"oidc"`
 	} `json:"oauth"`
 
 	App struct {
 		FrontendURL  string   `json:"frontend_url"`
 		GithubOrg    string   `json:"github_org"`
 		AllowedTeams []string `json:"allowed_teams"`
+		// AdminTeams are the teams, or OIDC groups, whose members can manage every teamspace
+		AdminTeams []string `json:"admin_teams"`
 	} `json:"app"`
+
+	// Clusters are the management clusters teamspaces are provisioned in, picked by the placement
+	// engine unless the user names one. The first holds the quota ledgers and overrides. When none
+	// is listed, the cluster the backend runs in, or else the one of the default kubeconfig, is used.
+	Clusters []ClusterConfig `json:"clusters,omitempty"`
+
+	HyperShift HyperShiftConfig `json:"hypershift"`
+
+	Lifecycle LifecycleConfig `json:"lifecycle"`
+
+	Guardrails GuardrailsConfig `json:"guardrails"`
+
+	// Templates are the profiles users pick from when creating a teamspace
+	Templates []TemplateConfig `json:"templates,omitempty"`
+	// DefaultTemplate is used when a create request names no template
+	DefaultTemplate string `json:"default_template,omitempty"`
+
+	Quotas QuotasConfig `json:"quotas"`
+
+	Audit AuditConfig `json:"audit"`
+
+	Logging LoggingConfig `json:"logging"`
+}
+
+// ClusterConfig is a management cluster and the credentials to reach it
+type ClusterConfig struct {
+	// Name identifies the cluster in the API and on teamspaces, such as "us-east"
+	Name string `json:"name"`
+	// Kubeconfig is the path of a kubeconfig for the cluster. When empty, the default kubeconfig
+	// is used, or the in-cluster config when running in a pod and no context is set.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context selects a context of the kubeconfig other than its current context
+	Context string `json:"context,omitempty"`
+	// Region is matched against the region users prefer when creating a teamspace
+	Region string `json:"region,omitempty"`
+	// MaxTeamspaces and MaxNodes bound the teamspaces, and the nodes of their NodePools, placed
+	// in the cluster; zero means unlimited
+	MaxTeamspaces int `json:"max_teamspaces,omitempty"`
+	MaxNodes      int `json:"max_nodes,omitempty"`
+	// AllowedTeams, when set, restricts the cluster to members of these GitHub teams
+	AllowedTeams []string `json:"allowed_teams,omitempty"`
+	// DeniedTeams keeps members of these GitHub teams off the cluster, whatever their other teams
+	DeniedTeams []string `json:"denied_teams,omitempty"`
+}
+
+// DefaultClusterName names the cluster used when the config lists none
+const DefaultClusterName = "default"
+
+// Identity providers of the oauth section
+const (
+	ProviderGitHub = "github"
+	ProviderOIDC   = "oidc"
+)
+
+// OIDCConfig describes an OpenID Connect provider such as Keycloak or Dex. The redirect_url of
+// the oauth section is shared with GitHub.
+type OIDCConfig struct {
+	// IssuerURL is where the provider is discovered, under /.well-known/openid-configuration
+	IssuerURL    string `json:"issuer_url"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// DisplayName is shown on the login button
+	DisplayName string `json:"display_name,omitempty"`
+	// Scopes are requested on top of "openid". Dex only puts the groups in the ID token when
+	// the "groups" scope is requested.
+	Scopes []string `json:"scopes,omitempty"`
+	// UsernameClaim is the claim of the ID token users are known by
+	UsernameClaim string `json:"username_claim,omitempty"`
+	// GroupsClaim is the claim of the ID token holding the groups, which are matched against
+	// the teams of the config
+	GroupsClaim string `json:"groups_claim,omitempty"`
+}
+
+// LoggingConfig sets how much the server logs and in which format. The --log-level and
+// --log-format flags take precedence.
+type LoggingConfig struct {
+	// Level is "debug", "info", "warn" or "error"
+	Level string `json:"level"`
+	// Format is "json" or "text"
+	Format string `json:"format"`
+}
+
+// AuditConfig lists where audit records of API requests and logins are written
+type AuditConfig struct {
+	Sinks []AuditSinkConfig `json:"sinks"`
+}
+
+// AuditSinkConfig is one destination of audit records
+type AuditSinkConfig struct {
+	// Type is "stdout", "file" for a JSON lines file, or "events" for Kubernetes Events
+	Type string `json:"type"`
+	// Path is the file the "file" sink appends to
+	Path string `json:"path,omitempty"`
+	// Namespace is where the "events" sink creates Events
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// QuotasConfig bounds what each user can own. A limit left unset is taken from the user
+// override, then from the most generous of the user's GitHub teams, then from the default.
+type QuotasConfig struct {
+	Default QuotaLimits `json:"default"`
+	// Teams are keyed by GitHub team name, as in app.allowed_teams
+	Teams map[string]QuotaLimits `json:"teams,omitempty"`
+	// Users are keyed by GitHub username
+	Users map[string]QuotaLimits `json:"users,omitempty"`
+	// LedgerNamespace holds the ConfigMaps through which replicas agree on quota admissions
+	LedgerNamespace string `json:"ledger_namespace"`
+}
+
+// QuotaLimits are the limits set at one level of the quota config. A negative limit means
+// unlimited.
+type QuotaLimits struct {
+	// Teamspaces is the number of teamspaces a user can own
+	Teamspaces *int `json:"teamspaces,omitempty"`
+	// Nodes is the total NodePool size of the teamspaces a user owns
+	Nodes *int `json:"nodes,omitempty"`
+	// ClusterHours is the total lifetime left on the teamspaces a user owns
+	ClusterHours *float64 `json:"cluster_hours,omitempty"`
+}
+
+// TemplateConfig is a named teamspace profile. Settings left empty fall back to the
+// hypershift and guardrails sections.
+type TemplateConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Release is the release image used when the create request does not pick one
+	Release string `json:"release,omitempty"`
+	// NodePoolReplicas is the size of the default NodePool
+	NodePoolReplicas int `json:"node_pool_replicas,omitempty"`
+	// InstanceType is the machine type of the NodePool, set as aws.instanceType or azure.vmSize
+	InstanceType string `json:"instance_type,omitempty"`
+	// NodePoolPlatformSpec is merged over hypershift.node_pool_platform_spec
+	NodePoolPlatformSpec map[string]interface{} `json:"node_pool_platform_spec,omitempty"`
+
+	// ResourceQuota replaces guardrails.resource_quota for teamspaces created from the template
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resource_quota,omitempty"`
+	// Manifests are namespaced objects applied into the teamspace namespace
+	Manifests []map[string]interface{} `json:"manifests,omitempty"`
+}
+
+// bindableClusterRoles are the ClusterRoles that RoleBindings of template manifests may
+// reference, the ones the ClusterRole in k8s/rbac.yaml lets the backend bind
+var bindableClusterRoles = []string{"view", "edit"}
+
+// Template returns the template with the given name
+func (c *Config) Template(name string) (*TemplateConfig, bool) {
+	for i := range c.Templates {
+		if c.Templates[i].Name == name {
+			return &c.Templates[i], true
+		}
+	}
+	return nil, false
+}
+
+// GuardrailsConfig describes the objects applied to every teamspace namespace to bound its
+// footprint on the management cluster. The specs use the Kubernetes API field names.
+type GuardrailsConfig struct {
+	// ResourceQuota is applied as the teamspace-quota ResourceQuota; an empty object disables it
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resource_quota,omitempty"`
+	// LimitRange is applied as the teamspace-limits LimitRange; an empty object disables it
+	LimitRange *corev1.LimitRangeSpec `json:"limit_range,omitempty"`
+	// DefaultDeny adds a NetworkPolicy denying all traffic not allowed by NetworkPolicies
+	DefaultDeny *bool `json:"default_deny,omitempty"`
+	// NetworkPolicies are the allowances applied by name; an empty object disables them
+	NetworkPolicies map[string]networkingv1.NetworkPolicySpec `json:"network_policies,omitempty"`
+	// PodSecurity sets the Pod Security Admission levels of the namespace
+	PodSecurity struct {
+		Enforce string `json:"enforce"`
+		Audit   string `json:"audit"`
+		Warn    string `json:"warn"`
+	} `json:"pod_security"`
+}
+
+// LifecycleConfig controls how long teamspaces live before the reaper deletes them
+type LifecycleConfig struct {
+	// DefaultTTL is the lifetime of a teamspace created without an explicit ttl
+	DefaultTTL Duration `json:"default_ttl"`
+	// MaxTTL is the furthest in the future an expiry can be set, at creation or by extending it
+	MaxTTL Duration `json:"max_ttl"`
+	// ExpiryWarning is how long before the expiry the owner is warned
+	ExpiryWarning Duration `json:"expiry_warning"`
+	// ReapInterval is how often the reaper looks for expiring teamspaces
+	ReapInterval Duration `json:"reap_interval"`
+}
+
+// Duration is a time.Duration written as a string such as "72h" in the config file
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"72h\": %v", err)
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// HyperShiftConfig describes how the HostedCluster and NodePool of each teamspace are built
+type HyperShiftConfig struct {
+	// BaseDomain is the DNS base domain of the hosted clusters
+	BaseDomain string `json:"base_domain"`
+
+	// PullSecret is copied into every teamspace namespace and referenced by the HostedCluster
+	PullSecret struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"pull_secret"`
+
+	// Platform is the HyperShift platform type, e.g. "AWS", "KubeVirt" or "None"
+	Platform string `json:"platform"`
+	// PlatformSpec is copied verbatim under the platform section of the HostedCluster
+	PlatformSpec map[string]interface{} `json:"platform_spec,omitempty"`
+	// NodePoolPlatformSpec is copied verbatim under the platform section of the NodePool
+	NodePoolPlatformSpec map[string]interface{} `json:"node_pool_platform_spec,omitempty"`
+
+	// ServicePublishingStrategy is used for all control plane services, e.g. "Route" or "LoadBalancer"
+	ServicePublishingStrategy string `json:"service_publishing_strategy"`
+	// NodePoolReplicas is the size of the default NodePool
+	NodePoolReplicas int `json:"node_pool_replicas"`
 }
 
 // LoadFromFile loads configuration from a JSON file
@@ -51,6 +314,8 @@ func LoadFromFile(filePath string) (*Config, error) {
 		return nil, fmt.Errorf("could not parse config file: %v", err)
 	}
 
+	cfg.applyDefaults()
+
 	// Validate config
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -59,6 +324,14 @@ func LoadFromFile(filePath string) (*Config, error) {
 	return cfg, nil
 }
 
+// Default returns a configuration with every setting at its default, for running without a
+// config file
+func Default() *Config {
+	cfg := &Config{}
+	cfg.applyDefaults()
+	return cfg
+}
+
 // SaveToFile saves the configuration to a JSON file
 func (c *Config) SaveToFile(filePath string) error {
 	// Validate config before saving
@@ -80,6 +353,162 @@ func (c *Config) SaveToFile(filePath string) error {
 	return nil
 }
 
+// applyDefaults fills in optional settings that were left empty
+func (c *Config) applyDefaults() {
+	if c.Server.MetricsPort == 0 {
+		c.Server.MetricsPort = 9090
+	}
+	if c.Server.ReadTimeout.Duration == 0 {
+		c.Server.ReadTimeout.Duration = 30 * time.Second
+	}
+	if c.Server.WriteTimeout.Duration == 0 {
+		c.Server.WriteTimeout.Duration = 60 * time.Second
+	}
+	if c.Server.IdleTimeout.Duration == 0 {
+		c.Server.IdleTimeout.Duration = 120 * time.Second
+	}
+	if c.Server.ShutdownTimeout.Duration == 0 {
+		c.Server.ShutdownTimeout.Duration = 25 * time.Second
+	}
+	if c.OAuth.GithubURL == "" {
+		c.OAuth.GithubURL = "https://github.com"
+	}
+	if c.OAuth.GithubAPIURL == "" {
+		c.OAuth.GithubAPIURL = "https://api.github.com"
+	}
+	if c.OAuth.Provider == "" {
+		c.OAuth.Provider = ProviderGitHub
+	}
+	if c.OAuth.OIDC.DisplayName == "" {
+		c.OAuth.OIDC.DisplayName = "single sign-on"
+	}
+	if c.OAuth.OIDC.Scopes == nil {
+		c.OAuth.OIDC.Scopes = []string{"profile", "email"}
+	}
+	if c.OAuth.OIDC.UsernameClaim == "" {
+		c.OAuth.OIDC.UsernameClaim = "preferred_username"
+	}
+	if c.OAuth.OIDC.GroupsClaim == "" {
+		c.OAuth.OIDC.GroupsClaim = "groups"
+	}
+	if len(c.Clusters) == 0 {
+		c.Clusters = []ClusterConfig{{Name: DefaultClusterName}}
+	}
+	if c.HyperShift.Platform == "" {
+		c.HyperShift.Platform = "None"
+	}
+	if c.HyperShift.ServicePublishingStrategy == "" {
+		c.HyperShift.ServicePublishingStrategy = "Route"
+	}
+	if c.HyperShift.NodePoolReplicas == 0 {
+		c.HyperShift.NodePoolReplicas = 2
+	}
+	if c.Lifecycle.DefaultTTL.Duration == 0 {
+		c.Lifecycle.DefaultTTL.Duration = 72 * time.Hour
+	}
+	if c.Lifecycle.MaxTTL.Duration == 0 {
+		c.Lifecycle.MaxTTL.Duration = 14 * 24 * time.Hour
+	}
+	if c.Lifecycle.ExpiryWarning.Duration == 0 {
+		c.Lifecycle.ExpiryWarning.Duration = 24 * time.Hour
+	}
+	if c.Lifecycle.ReapInterval.Duration == 0 {
+		c.Lifecycle.ReapInterval.Duration = 5 * time.Minute
+	}
+	c.Guardrails.applyDefaults()
+	if c.Quotas.LedgerNamespace == "" {
+		c.Quotas.LedgerNamespace = "teamspaces"
+	}
+	if c.Quotas.Default.Teamspaces == nil {
+		teamspaces := 3
+		c.Quotas.Default.Teamspaces = &teamspaces
+	}
+	if len(c.Audit.Sinks) == 0 {
+		c.Audit.Sinks = []AuditSinkConfig{{Type: "stdout"}}
+	}
+	for i := range c.Audit.Sinks {
+		if c.Audit.Sinks[i].Type == "events" && c.Audit.Sinks[i].Namespace == "" {
+			c.Audit.Sinks[i].Namespace = c.Quotas.LedgerNamespace
+		}
+	}
+	if c.Logging.Level == "" {
+		c.Logging.Level = "info"
+	}
+	if c.Logging.Format == "" {
+		c.Logging.Format = "json"
+	}
+}
+
+// applyDefaults fills in the guardrails that were left out of the config file
+func (g *GuardrailsConfig) applyDefaults() {
+	if g.ResourceQuota == nil {
+		g.ResourceQuota = &corev1.ResourceQuotaSpec{
+			Hard: corev1.ResourceList{
+				corev1.ResourcePods:                   resource.MustParse("50"),
+				corev1.ResourceRequestsCPU:            resource.MustParse("16"),
+				corev1.ResourceRequestsMemory:         resource.MustParse("64Gi"),
+				corev1.ResourceLimitsCPU:              resource.MustParse("32"),
+				corev1.ResourceLimitsMemory:           resource.MustParse("128Gi"),
+				corev1.ResourcePersistentVolumeClaims: resource.MustParse("20"),
+			},
+		}
+	}
+	if g.LimitRange == nil {
+		// Containers without resources would be rejected by the quota on limits, so give them defaults
+		g.LimitRange = &corev1.LimitRangeSpec{
+			Limits: []corev1.LimitRangeItem{{
+				Type: corev1.LimitTypeContainer,
+				Default: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1"),
+					corev1.ResourceMemory: resource.MustParse("1Gi"),
+				},
+				DefaultRequest: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("100m"),
+					corev1.ResourceMemory: resource.MustParse("128Mi"),
+				},
+			}},
+		}
+	}
+	if g.DefaultDeny == nil {
+		defaultDeny := true
+		g.DefaultDeny = &defaultDeny
+	}
+	if g.NetworkPolicies == nil {
+		udp, tcp := corev1.ProtocolUDP, corev1.ProtocolTCP
+		dnsPorts := []networkingv1.NetworkPolicyPort{}
+		for _, port := range []int{53, 5353} {
+			p := intstr.FromInt32(int32(port))
+			dnsPorts = append(dnsPorts,
+				networkingv1.NetworkPolicyPort{Protocol: &udp, Port: &p},
+				networkingv1.NetworkPolicyPort{Protocol: &tcp, Port: &p},
+			)
+		}
+		g.NetworkPolicies = map[string]networkingv1.NetworkPolicySpec{
+			"teamspace-allow-same-namespace": {
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+				Ingress:     []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+				Egress:      []networkingv1.NetworkPolicyEgressRule{{To: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}},
+			},
+			"teamspace-allow-dns": {
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Egress: []networkingv1.NetworkPolicyEgressRule{{
+					To:    []networkingv1.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{}}},
+					Ports: dnsPorts,
+				}},
+			},
+		}
+	}
+	if g.PodSecurity.Enforce == "" {
+		g.PodSecurity.Enforce = "baseline"
+	}
+	if g.PodSecurity.Audit == "" {
+		g.PodSecurity.Audit = "restricted"
+	}
+	if g.PodSecurity.Warn == "" {
+		g.PodSecurity.Warn = "restricted"
+	}
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
 	// Ensure session keys are at least 32 bytes if provided
@@ -91,5 +520,117 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("session block key must be at least 32 bytes")
 	}
 
+	switch c.OAuth.Provider {
+	case "", ProviderGitHub:
+	case ProviderOIDC:
+		if c.OAuth.OIDC.IssuerURL == "" || c.OAuth.OIDC.ClientID == "" {
+			return fmt.Errorf("oidc provider needs an issuer_url and a client_id")
+		}
+	default:
+		return fmt.Errorf("oauth provider must be %q or %q, not %q", ProviderGitHub, ProviderOIDC, c.OAuth.Provider)
+	}
+
+	for _, timeout := range []Duration{c.Server.ReadTimeout, c.Server.WriteTimeout, c.Server.IdleTimeout, c.Server.ShutdownTimeout} {
+		if timeout.Duration < 0 {
+			return fmt.Errorf("server timeouts cannot be negative")
+		}
+	}
+
+	// Every teamspace gets a HostedCluster, which HyperShift cannot create without a pull secret
+	if c.HyperShift.PullSecret.Namespace == "" || c.HyperShift.PullSecret.Name == "" {
+		return fmt.Errorf("hypershift pull secret needs a namespace and a name")
+	}
+
+	if c.HyperShift.NodePoolReplicas < 0 {
+		return fmt.Errorf("hypershift node pool replicas cannot be negative")
+	}
+
+	clusters := map[string]bool{}
+	for _, cluster := range c.Clusters {
+		if errs := validation.IsDNS1123Label(cluster.Name); len(errs) > 0 {
+			return fmt.Errorf("cluster name %q is invalid: %s", cluster.Name, strings.Join(errs, ", "))
+		}
+		if clusters[cluster.Name] {
+			return fmt.Errorf("cluster %q is defined more than once", cluster.Name)
+		}
+		if cluster.MaxTeamspaces < 0 || cluster.MaxNodes < 0 {
+			return fmt.Errorf("capacity of cluster %q cannot be negative", cluster.Name)
+		}
+		clusters[cluster.Name] = true
+	}
+
+	names := map[string]bool{}
+	for _, template := range c.Templates {
+		if template.Name == "" {
+			return fmt.Errorf("templates must have a name")
+		}
+		if names[template.Name] {
+			return fmt.Errorf("template %q is defined more than once", template.Name)
+		}
+		names[template.Name] = true
+		if template.NodePoolReplicas < 0 {
+			return fmt.Errorf("template %q node pool replicas cannot be negative", template.Name)
+		}
+		if template.InstanceType != "" && c.HyperShift.Platform != "AWS" && c.HyperShift.Platform != "Azure" {
+			return fmt.Errorf("template %q instance type is only supported on the AWS and Azure platforms", template.Name)
+		}
+		for i, manifest := range template.Manifests {
+			if manifest["apiVersion"] == nil || manifest["kind"] == nil {
+				return fmt.Errorf("template %q manifest %d must have an apiVersion and a kind", template.Name, i)
+			}
+			if metadata, _ := manifest["metadata"].(map[string]interface{}); metadata == nil || metadata["name"] == nil {
+				return fmt.Errorf("template %q manifest %d must have a name", template.Name, i)
+			}
+			if manifest["kind"] == "RoleBinding" {
+				roleRef, _ := manifest["roleRef"].(map[string]interface{})
+				if name, _ := roleRef["name"].(string); roleRef["kind"] == "ClusterRole" && !slices.Contains(bindableClusterRoles, name) {
+					return fmt.Errorf("template %q manifest %d can only bind the ClusterRoles %s", template.Name, i, strings.Join(bindableClusterRoles, ", "))
+				}
+			}
+		}
+	}
+	if c.DefaultTemplate != "" && !names[c.DefaultTemplate] {
+		return fmt.Errorf("default template %q is not defined", c.DefaultTemplate)
+	}
+
+	if c.Lifecycle.DefaultTTL.Duration > c.Lifecycle.MaxTTL.Duration {
+		return fmt.Errorf("lifecycle default ttl cannot exceed the max ttl")
+	}
+
+	for _, level := range []string{c.Guardrails.PodSecurity.Enforce, c.Guardrails.PodSecurity.Audit, c.Guardrails.PodSecurity.Warn} {
+		switch level {
+		case "", "privileged", "baseline", "restricted":
+		default:
+			return fmt.Errorf("guardrails pod security level %q must be privileged, baseline or restricted", level)
+		}
+	}
+
+	if c.Lifecycle.ExpiryWarning.Duration < 0 || c.Lifecycle.ReapInterval.Duration < 0 {
+		return fmt.Errorf("lifecycle durations cannot be negative")
+	}
+
+	for _, sink := range c.Audit.Sinks {
+		switch sink.Type {
+		case "stdout", "events":
+		case "file":
+			if sink.Path == "" {
+				return fmt.Errorf("audit file sink must have a path")
+			}
+		default:
+			return fmt.Errorf("audit sink type %q must be stdout, file or events", sink.Type)
+		}
+	}
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("logging level %q must be debug, info, warn or error", c.Logging.Level)
+	}
+	switch c.Logging.Format {
+	case "json", "text":
+	default:
+		return fmt.Errorf("logging format %q must be json or text", c.Logging.Format)
+	}
+
 	return nil
 }
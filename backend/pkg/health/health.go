@@ -0,0 +1,111 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// checkTimeout bounds a readiness probe, below the timeout of the kubelet's probe
+const checkTimeout = 5 * time.Second
+
+// Check returns an error when a dependency of the server is not usable
+type Check func(ctx context.Context) error
+
+// Checker serves the liveness and readiness probes of the server
+type Checker struct {
+	mu           sync.Mutex
+	names        []string
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+// NewChecker returns a checker without readiness checks
+func NewChecker() *Checker {
+	return &Checker{checks: map[string]Check{}}
+}
+
+// AddReadinessCheck adds a check that must pass for the server to be ready
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// ShutDown fails readiness from now on, so that load balancers stop sending new requests
+// while in-flight ones drain
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// HandleLiveness reports that the process is serving requests. It checks no dependency, so
+// an unreachable cluster makes the server unready rather than restarted.
+func (c *Checker) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// Readiness is the body of the readiness probe
+type Readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// HandleReadiness runs every readiness check and answers 503 when one fails or the server is
+// shutting down
+func (c *Checker) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	readiness := c.Ready(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if readiness.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(readiness)
+}
+
+// Ready runs the readiness checks concurrently and reports the result of each
+func (c *Checker) Ready(ctx context.Context) Readiness {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	c.mu.Lock()
+	names := append([]string(nil), c.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.Unlock()
+
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	readiness := Readiness{Status: "ok", Checks: map[string]string{}}
+	if c.shuttingDown.Load() {
+		readiness.Status = "shutting down"
+	}
+	for i, name := range names {
+		if results[i] != nil {
+			readiness.Checks[name] = results[i].Error()
+			if readiness.Status == "ok" {
+				readiness.Status = "unavailable"
+			}
+			continue
+		}
+		readiness.Checks[name] = "ok"
+	}
+	return readiness
+}
@@ -0,0 +1,64 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func readiness(t *testing.T, c *Checker) (int, Readiness) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c.HandleReadiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body Readiness
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, body
+}
+
+func TestReadiness(t *testing.T) {
+	informersSynced := false
+	c := NewChecker()
+	c.AddReadinessCheck("kubernetes", func(ctx context.Context) error { return nil })
+	c.AddReadinessCheck("informers", func(ctx context.Context) error {
+		if !informersSynced {
+			return errors.New("informers have not synced")
+		}
+		return nil
+	})
+
+	code, body := readiness(t, c)
+	if code != http.StatusServiceUnavailable || body.Status != "unavailable" {
+		t.Errorf("expected 503 while the informers sync, got %d %q", code, body.Status)
+	}
+	if body.Checks["kubernetes"] != "ok" || body.Checks["informers"] != "informers have not synced" {
+		t.Errorf("unexpected checks %v", body.Checks)
+	}
+
+	informersSynced = true
+	if code, body := readiness(t, c); code != http.StatusOK || body.Status != "ok" {
+		t.Errorf("expected 200 once every check passes, got %d %q", code, body.Status)
+	}
+
+	c.ShutDown()
+	if code, body := readiness(t, c); code != http.StatusServiceUnavailable || body.Status != "shutting down" {
+		t.Errorf("expected 503 once shutting down, got %d %q", code, body.Status)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	c := NewChecker()
+	c.AddReadinessCheck("kubernetes", func(ctx context.Context) error { return errors.New("connection refused") })
+	c.ShutDown()
+
+	rec := httptest.NewRecorder()
+	c.HandleLiveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected liveness to ignore the readiness checks, got %d", rec.Code)
+	}
+}
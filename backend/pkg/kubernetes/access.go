@@ -0,0 +1,262 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+// userIndex indexes Teamspace objects by the lowercased username of everyone who can access them
+const userIndex = "user"
+
+// Role is the access a user has to a teamspace, from none to owner
+type Role string
+
+const (
+	RoleNone   Role = ""
+	RoleViewer Role = Role(v1alpha1.RoleViewer)
+	RoleEditor Role = Role(v1alpha1.RoleEditor)
+	RoleAdmin  Role = Role(v1alpha1.RoleAdmin)
+	RoleOwner  Role = "owner"
+)
+
+var roleRank = map[Role]int{
+	RoleNone:   0,
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// AtLeast reports whether the role grants everything the required role does
+func (r Role) AtLeast(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+// ErrInvalidCollaborator is returned when a collaborator cannot be added
+var ErrInvalidCollaborator = errors.New("invalid collaborator")
+
+// Collaborator is a user a teamspace is shared with, as returned by the API
+type Collaborator struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+}
+
+// roleOf returns the role of the user on the teamspace. GitHub usernames are case insensitive.
+func roleOf(ts *v1alpha1.Teamspace, username string) Role {
+	if username == "" {
+		return RoleNone
+	}
+	if strings.EqualFold(ts.Spec.Owner, username) {
+		return RoleOwner
+	}
+	for _, collaborator := range ts.Spec.Collaborators {
+		if strings.EqualFold(collaborator.Username, username) {
+			if _, known := roleRank[Role(collaborator.Role)]; known {
+				return Role(collaborator.Role)
+			}
+			return RoleNone
+		}
+	}
+	return RoleNone
+}
+
+// isTransferRecipient reports whether the teamspace is waiting for the user to accept it
+func isTransferRecipient(ts *v1alpha1.Teamspace, username string) bool {
+	return username != "" && ts.Spec.Transfer != nil && strings.EqualFold(ts.Spec.Transfer.To, username)
+}
+
+// visibleTo reports whether the teamspace is listed for the user. The recipient of a pending
+// transfer sees the teamspace so they can accept it, without any access to it.
+func visibleTo(ts *v1alpha1.Teamspace, username string) bool {
+	return roleOf(ts, username) != RoleNone || isTransferRecipient(ts, username)
+}
+
+// indexByUser returns everyone a Teamspace object is listed for
+func indexByUser(obj interface{}) ([]string, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	ts, err := v1alpha1.FromUnstructured(u)
+	if err != nil {
+		return nil, nil
+	}
+
+	var users []string
+	if ts.Spec.Owner != "" {
+		users = append(users, strings.ToLower(ts.Spec.Owner))
+	}
+	for _, collaborator := range ts.Spec.Collaborators {
+		users = append(users, strings.ToLower(collaborator.Username))
+	}
+	if ts.Spec.Transfer != nil {
+		users = append(users, strings.ToLower(ts.Spec.Transfer.To))
+	}
+	return users, nil
+}
+
+// TeamspaceRole returns the role the user has on the named teamspace, looked up in the named
+// cluster or, when empty, in every cluster
+func (m *TeamspaceManager) TeamspaceRole(name string, clusterName string, username string) (Role, error) {
+	ts, _, err := m.getTeamspace(name, clusterName)
+	if err != nil {
+		return RoleNone, err
+	}
+	return roleOf(ts, username), nil
+}
+
+// TransferRecipient returns the user the named teamspace waits to be accepted by, if any
+func (m *TeamspaceManager) TransferRecipient(name string) (string, error) {
+	ts, _, err := m.getTeamspace(name, "")
+	if err != nil {
+		return "", err
+	}
+	if ts.Spec.Transfer == nil {
+		return "", nil
+	}
+	return ts.Spec.Transfer.To, nil
+}
+
+// ListTeamspacesForUser lists the teamspaces the user owns, collaborates on or is offered, with
+// the user's role on each
+func (m *TeamspaceManager) ListTeamspacesForUser(username string) ([]*Teamspace, error) {
+	if !m.HasSynced() {
+		return nil, ErrCacheNotSynced
+	}
+	var teamspaces []*Teamspace
+	for _, cluster := range m.clusters {
+		objs, err := cluster.cache.teamspaces.GetIndexer().ByIndex(userIndex, strings.ToLower(username))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list teamspaces: %v", err)
+		}
+		cached, err := cachedTeamspaces(objs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ts := range cached {
+			teamspace := toTeamspace(ts, cluster.name)
+			teamspace.Role = roleOf(ts, username)
+			teamspaces = append(teamspaces, teamspace)
+		}
+	}
+	return teamspaces, nil
+}
+
+// SetCollaborator shares the teamspace with a user, or changes the role of an existing collaborator
+func (m *TeamspaceManager) SetCollaborator(name string, username string, role Role) (*Teamspace, error) {
+	if role != RoleViewer && role != RoleEditor && role != RoleAdmin {
+		return nil, fmt.Errorf("%w: role must be one of %s, %s or %s", ErrInvalidCollaborator, RoleViewer, RoleEditor, RoleAdmin)
+	}
+
+	ts, cluster, err := m.updateTeamspace(name, "", func(ts *v1alpha1.Teamspace) error {
+		if strings.EqualFold(ts.Spec.Owner, username) {
+			return fmt.Errorf("%w: %s already owns the teamspace", ErrInvalidCollaborator, username)
+		}
+		for i, collaborator := range ts.Spec.Collaborators {
+			if strings.EqualFold(collaborator.Username, username) {
+				ts.Spec.Collaborators[i].Role = v1alpha1.CollaboratorRole(role)
+				return nil
+			}
+		}
+		ts.Spec.Collaborators = append(ts.Spec.Collaborators, v1alpha1.Collaborator{
+			Username: username,
+			Role:     v1alpha1.CollaboratorRole(role),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Collaborator set", "teamspace", name, "collaborator", username, "role", role)
+	return toTeamspace(ts, cluster.name), nil
+}
+
+// RemoveCollaborator stops sharing the teamspace with a user
+func (m *TeamspaceManager) RemoveCollaborator(name string, username string) (*Teamspace, error) {
+	ts, cluster, err := m.updateTeamspace(name, "", func(ts *v1alpha1.Teamspace) error {
+		var kept []v1alpha1.Collaborator
+		for _, collaborator := range ts.Spec.Collaborators {
+			if !strings.EqualFold(collaborator.Username, username) {
+				kept = append(kept, collaborator)
+			}
+		}
+		if len(kept) == len(ts.Spec.Collaborators) {
+			return fmt.Errorf("%w: %s is not a collaborator", ErrInvalidCollaborator, username)
+		}
+		ts.Spec.Collaborators = kept
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Collaborator removed", "teamspace", name, "collaborator", username)
+	return toTeamspace(ts, cluster.name), nil
+}
+
+// updateTeamspace applies a change to the spec of the live Teamspace object, retrying on conflicts,
+// and returns it with the cluster it lives in. An empty clusterName looks in every cluster.
+func (m *TeamspaceManager) updateTeamspace(name string, clusterName string, mutate func(*v1alpha1.Teamspace) error) (*v1alpha1.Teamspace, *managementCluster, error) {
+	_, cluster, err := m.getTeamspace(name, clusterName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := context.TODO()
+	teamspaces := cluster.dynamic.Resource(v1alpha1.TeamspaceResource)
+
+	// Errors returned by mutate, or about the state of the teamspace, are passed through unwrapped
+	var updated *v1alpha1.Teamspace
+	var rejected error
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		obj, err := teamspaces.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			rejected = fmt.Errorf("%w: %s", ErrTeamspaceNotFound, name)
+			return rejected
+		}
+		if err != nil {
+			return err
+		}
+		ts, err := v1alpha1.FromUnstructured(obj)
+		if err != nil {
+			return err
+		}
+		if ts.DeletionTimestamp != nil {
+			rejected = fmt.Errorf("%w: teamspace %s is being deleted", ErrInvalidState, name)
+			return rejected
+		}
+		if err := mutate(ts); err != nil {
+			rejected = err
+			return rejected
+		}
+
+		obj, err = ts.ToUnstructured()
+		if err != nil {
+			return err
+		}
+		obj, err = teamspaces.Update(ctx, obj, metav1.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		updated, err = v1alpha1.FromUnstructured(obj)
+		return err
+	})
+	if rejected != nil {
+		return nil, nil, rejected
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update teamspace %s: %v", name, err)
+	}
+	return updated, cluster, nil
+}
@@ -0,0 +1,109 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// TeamspaceFilter selects teamspaces in the admin list; empty fields match every teamspace
+type TeamspaceFilter struct {
+	// Owner matches the GitHub username of the owner, case insensitively
+	Owner string
+	// Cluster matches the name of the management cluster
+	Cluster string
+	// Release matches teamspaces whose release image contains it, such as "4.19"
+	Release string
+	Phase   v1alpha1.TeamspacePhase
+	// MinAge and MaxAge bound how long ago the teamspace was created
+	MinAge time.Duration
+	MaxAge time.Duration
+}
+
+// Matches reports whether the teamspace passes the filter at the given time
+func (f TeamspaceFilter) Matches(teamspace *Teamspace, now time.Time) bool {
+	if f.Owner != "" && !strings.EqualFold(teamspace.Owner, f.Owner) {
+		return false
+	}
+	if f.Cluster != "" && teamspace.Cluster != f.Cluster {
+		return false
+	}
+	if f.Release != "" && !strings.Contains(teamspace.Release, f.Release) {
+		return false
+	}
+	if f.Phase != "" && !strings.EqualFold(string(teamspace.Phase), string(f.Phase)) {
+		return false
+	}
+	age := now.Sub(teamspace.CreatedAt)
+	if f.MinAge > 0 && age < f.MinAge {
+		return false
+	}
+	if f.MaxAge > 0 && age > f.MaxAge {
+		return false
+	}
+	return true
+}
+
+// FilterTeamspaces lists every teamspace matching the filter from the cache, oldest first
+func (m *TeamspaceManager) FilterTeamspaces(filter TeamspaceFilter) ([]*Teamspace, error) {
+	all, err := m.ListTeamspaces()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	teamspaces := []*Teamspace{}
+	for _, teamspace := range all {
+		if filter.Matches(teamspace, now) {
+			teamspaces = append(teamspaces, teamspace)
+		}
+	}
+	sort.Slice(teamspaces, func(i, j int) bool {
+		return teamspaces[i].CreatedAt.Before(teamspaces[j].CreatedAt)
+	})
+	return teamspaces, nil
+}
+
+// ForceDeleteTeamspace deletes the teamspace without waiting for its HostedCluster to be torn
+// down, which can hang on the cloud resources behind it. The controller deletes the namespace
+// and releases the Teamspace object straight away, so it also unblocks a teamspace stuck in
+// deletion. The teamspace is looked up in the named cluster or, when empty, in every cluster.
+func (m *TeamspaceManager) ForceDeleteTeamspace(name string, clusterName string) error {
+	_, cluster, err := m.getTeamspace(name, clusterName)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+	teamspaces := cluster.dynamic.Resource(v1alpha1.TeamspaceResource)
+
+	// updateTeamspace refuses teamspaces being deleted, so the annotation is patched directly
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{forceDeleteAnnotation: "true"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = teamspaces.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s", ErrTeamspaceNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mark teamspace %s for forced deletion: %v", name, err)
+	}
+
+	if err := teamspaces.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete teamspace %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+)
+
+func TestTeamspaceFilterMatches(t *testing.T) {
+	now := time.Now()
+	teamspace := &Teamspace{
+		Owner:     "Octocat",
+		Cluster:   "east",
+		Release:   "quay.io/openshift-release-dev/ocp-release:4.19.0-x86_64",
+		Phase:     v1alpha1.PhaseReady,
+		CreatedAt: now.Add(-48 * time.Hour),
+	}
+
+	tests := []struct {
+		name   string
+		filter TeamspaceFilter
+		want   bool
+	}{
+		{name: "empty filter", filter: TeamspaceFilter{}, want: true},
+		{name: "owner in another case", filter: TeamspaceFilter{Owner: "octocat"}, want: true},
+		{name: "other owner", filter: TeamspaceFilter{Owner: "hubot"}, want: false},
+		{name: "cluster", filter: TeamspaceFilter{Cluster: "east"}, want: true},
+		{name: "other cluster", filter: TeamspaceFilter{Cluster: "west"}, want: false},
+		{name: "release version", filter: TeamspaceFilter{Release: "4.19"}, want: true},
+		{name: "other release", filter: TeamspaceFilter{Release: "4.18"}, want: false},
+		{name: "phase", filter: TeamspaceFilter{Phase: "ready"}, want: true},
+		{name: "other phase", filter: TeamspaceFilter{Phase: v1alpha1.PhaseFailed}, want: false},
+		{name: "older than a day", filter: TeamspaceFilter{MinAge: 24 * time.Hour}, want: true},
+		{name: "older than a week", filter: TeamspaceFilter{MinAge: 7 * 24 * time.Hour}, want: false},
+		{name: "younger than a day", filter: TeamspaceFilter{MaxAge: 24 * time.Hour}, want: false},
+		{name: "everything", filter: TeamspaceFilter{Owner: "octocat", Release: "4.19", Phase: v1alpha1.PhaseReady, MinAge: time.Hour, MaxAge: 72 * time.Hour}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(teamspace, now); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ownerIndex indexes Teamspace objects by the lowercased username of their owner, as usernames
+// are case insensitive
+const ownerIndex = "owner"
+
+// ErrCacheNotSynced is returned by reads issued before the informer caches have synced
+var ErrCacheNotSynced = errors.New("teamspace cache is not synced yet")
+
+var secretResource = corev1.SchemeGroupVersion.WithResource("secrets")
+
+// teamspaceCache holds the informers serving every read of the manager
+type teamspaceCache struct {
+	teamspaces    cache.SharedIndexInformer
+	namespaces    cache.SharedIndexInformer
+	namespaceList corelisters.NamespaceLister
+	// Namespaces still labelled with schema version 1, until the label migration rewrites them
+	legacyNamespaces    cache.SharedIndexInformer
+	legacyNamespaceList corelisters.NamespaceLister
+	secrets             cache.SharedIndexInformer
+	hostedClusters      cache.SharedIndexInformer
+	nodePools           cache.SharedIndexInformer
+
+	// Guardrails applied into teamspace namespaces, watched so that edits and deletions are reverted
+	resourceQuotas    cache.SharedIndexInformer
+	limitRanges       cache.SharedIndexInformer
+	networkPolicies   cache.SharedIndexInformer
+	networkPolicyList networkinglisters.NetworkPolicyLister
+
+	// The quota overrides are only watched in the default cluster, which holds them
+	ledgerFactory     informers.SharedInformerFactory
+	quotaOverrides    corelisters.ConfigMapNamespaceLister
+	quotaOverrideSync cache.InformerSynced
+
+	// watchHostedClusters is set when the cluster serves HostedClusters and their informer runs
+	watchHostedClusters bool
+	// watchNodePools is set when the cluster serves NodePools and their informer runs
+	watchNodePools bool
+
+	kubeFactory      informers.SharedInformerFactory
+	legacyFactory    informers.SharedInformerFactory
+	guardrailFactory informers.SharedInformerFactory
+	// running tracks the informers started outside of a factory
+	running sync.WaitGroup
+}
+
+// newTeamspaceCache builds the informers of the cluster without starting them
+func (m *managementCluster) newTeamspaceCache() *teamspaceCache {
+	c := &teamspaceCache{}
+
+	c.teamspaces = dynamicinformer.NewFilteredDynamicInformer(
+		m.dynamic, v1alpha1.TeamspaceResource, metav1.NamespaceAll, resyncPeriod,
+		cache.Indexers{ownerIndex: indexByOwner, userIndex: indexByUser}, nil,
+	).Informer()
+
+	// Only namespaces that back a teamspace are of interest
+	c.kubeFactory = informers.NewSharedInformerFactoryWithOptions(m.clientset, resyncPeriod,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = fmt.Sprintf("%s=%s", teamspaceLabel, teamspaceLabelEnabled)
+		}),
+	)
+	namespaceInformer := c.kubeFactory.Core().V1().Namespaces()
+	c.namespaces = namespaceInformer.Informer()
+	c.namespaceList = namespaceInformer.Lister()
+
+	c.legacyFactory = informers.NewSharedInformerFactoryWithOptions(m.clientset, resyncPeriod,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = legacyTeamspaceSelector
+		}),
+	)
+	legacyNamespaceInformer := c.legacyFactory.Core().V1().Namespaces()
+	c.legacyNamespaces = legacyNamespaceInformer.Informer()
+	c.legacyNamespaceList = legacyNamespaceInformer.Lister()
+
+	// Only the metadata of the secrets the controller manages is cached, never their contents
+	c.secrets = metadatainformer.NewFilteredMetadataInformer(
+		m.metadata, secretResource, metav1.NamespaceAll, resyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		func(opts *metav1.ListOptions) { opts.LabelSelector = teamspaceNameLabel },
+	).Informer()
+
+	// Only the guardrails the controller manages are of interest
+	c.guardrailFactory = informers.NewSharedInformerFactoryWithOptions(m.clientset, resyncPeriod,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = teamspaceNameLabel
+		}),
+	)
+	c.resourceQuotas = c.guardrailFactory.Core().V1().ResourceQuotas().Informer()
+	c.limitRanges = c.guardrailFactory.Core().V1().LimitRanges().Informer()
+	c.networkPolicies = c.guardrailFactory.Networking().V1().NetworkPolicies().Informer()
+	c.networkPolicyList = c.guardrailFactory.Networking().V1().NetworkPolicies().Lister()
+
+	c.hostedClusters = dynamicinformer.NewFilteredDynamicInformer(
+		m.dynamic, hostedClusterResource, metav1.NamespaceAll, resyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil,
+	).Informer()
+	c.nodePools = dynamicinformer.NewFilteredDynamicInformer(
+		m.dynamic, nodePoolResource, metav1.NamespaceAll, resyncPeriod,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, nil,
+	).Informer()
+
+	return c
+}
+
+// watchQuotaOverrides adds an informer for the quota overrides ConfigMap of the ledger namespace
+func (m *managementCluster) watchQuotaOverrides(namespace string) {
+	m.cache.ledgerFactory = informers.NewSharedInformerFactoryWithOptions(m.clientset, resyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", quotaOverridesName).String()
+		}),
+	)
+	configMaps := m.cache.ledgerFactory.Core().V1().ConfigMaps()
+	m.cache.quotaOverrides = configMaps.Lister().ConfigMaps(namespace)
+	m.cache.quotaOverrideSync = configMaps.Informer().HasSynced
+}
+
+// Start runs the informers of every cluster until the context is cancelled
+func (m *TeamspaceManager) Start(ctx context.Context) {
+	for _, cluster := range m.clusters {
+		cluster.start(ctx)
+	}
+}
+
+func (m *managementCluster) start(ctx context.Context) {
+	// HyperShift may not be installed yet; only watch HostedClusters when the API is served
+	if m.servesResource(hostedClusterResource) {
+		m.cache.watchHostedClusters = true
+		m.cache.run(ctx, m.cache.hostedClusters)
+	} else {
+		slog.Warn("HostedClusters are not served by the cluster and will be read live", "cluster", m.name, "resource", hostedClusterResource.GroupResource().String())
+	}
+	if m.servesResource(nodePoolResource) {
+		m.cache.watchNodePools = true
+		m.cache.run(ctx, m.cache.nodePools)
+	}
+
+	m.cache.run(ctx, m.cache.teamspaces)
+	m.cache.run(ctx, m.cache.secrets)
+	m.cache.kubeFactory.Start(ctx.Done())
+	m.cache.legacyFactory.Start(ctx.Done())
+	m.cache.guardrailFactory.Start(ctx.Done())
+	if m.cache.ledgerFactory != nil {
+		m.cache.ledgerFactory.Start(ctx.Done())
+	}
+
+	close(m.started)
+}
+
+func (c *teamspaceCache) run(ctx context.Context, informer cache.SharedIndexInformer) {
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		informer.Run(ctx.Done())
+	}()
+}
+
+// Shutdown waits for the informers to stop after the context passed to Start is cancelled, and
+// flushes the Events still to be recorded
+func (m *TeamspaceManager) Shutdown() {
+	for _, cluster := range m.clusters {
+		cluster.cache.running.Wait()
+		cluster.cache.kubeFactory.Shutdown()
+		cluster.cache.legacyFactory.Shutdown()
+		cluster.cache.guardrailFactory.Shutdown()
+		if cluster.cache.ledgerFactory != nil {
+			cluster.cache.ledgerFactory.Shutdown()
+		}
+		cluster.broadcaster.Shutdown()
+	}
+}
+
+// WaitForCacheSync blocks until the informers of every cluster have synced or the context is
+// cancelled
+func (m *TeamspaceManager) WaitForCacheSync(ctx context.Context) bool {
+	for _, cluster := range m.clusters {
+		if !cluster.waitForCacheSync(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *managementCluster) waitForCacheSync(ctx context.Context) bool {
+	select {
+	case <-m.started:
+	case <-ctx.Done():
+		return false
+	}
+	return cache.WaitForCacheSync(ctx.Done(), m.cacheSyncFuncs()...)
+}
+
+// HasSynced reports whether reads can be served from the caches. Teamspaces of every cluster
+// count against the quota of their owner, so no read is served before all of them have synced.
+func (m *TeamspaceManager) HasSynced() bool {
+	for _, cluster := range m.clusters {
+		if !cluster.hasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *managementCluster) hasSynced() bool {
+	select {
+	case <-m.started:
+	default:
+		return false
+	}
+	for _, synced := range m.cacheSyncFuncs() {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *managementCluster) cacheSyncFuncs() []cache.InformerSynced {
+	synced := []cache.InformerSynced{
+		m.cache.teamspaces.HasSynced,
+		m.cache.namespaces.HasSynced,
+		m.cache.legacyNamespaces.HasSynced,
+		m.cache.secrets.HasSynced,
+		m.cache.resourceQuotas.HasSynced,
+		m.cache.limitRanges.HasSynced,
+		m.cache.networkPolicies.HasSynced,
+	}
+	if m.cache.watchHostedClusters {
+		synced = append(synced, m.cache.hostedClusters.HasSynced)
+	}
+	if m.cache.watchNodePools {
+		synced = append(synced, m.cache.nodePools.HasSynced)
+	}
+	if m.cache.quotaOverrideSync != nil {
+		synced = append(synced, m.cache.quotaOverrideSync)
+	}
+	return synced
+}
+
+// servesResource asks the discovery API whether the cluster serves the given resource
+func (m *managementCluster) servesResource(gvr schema.GroupVersionResource) bool {
+	resources, err := m.clientset.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == gvr.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+// indexByOwner returns the lowercased owner of a Teamspace object
+func indexByOwner(obj interface{}) ([]string, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	owner, _, _ := unstructured.NestedString(u.Object, "spec", "owner")
+	if owner == "" {
+		return nil, nil
+	}
+	return []string{strings.ToLower(owner)}, nil
+}
+
+// cachedTeamspaces converts the cached objects returned by an informer into Teamspaces
+func cachedTeamspaces(objs []interface{}) ([]*v1alpha1.Teamspace, error) {
+	var teamspaces []*v1alpha1.Teamspace
+	for _, obj := range objs {
+		ts, err := v1alpha1.FromUnstructured(obj.(*unstructured.Unstructured))
+		if err != nil {
+			return nil, err
+		}
+		teamspaces = append(teamspaces, ts)
+	}
+	return teamspaces, nil
+}
+
+// cachedNamespace returns the namespace from the cache, or nil if it does not exist
+func (m *managementCluster) cachedNamespace(name string) (*corev1.Namespace, error) {
+	ns, err := m.cache.namespaceList.Get(name)
+	if apierrors.IsNotFound(err) {
+		ns, err = m.cache.legacyNamespaceList.Get(name)
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return ns, err
+}
+
+// cachedNodePool returns the teamspace NodePool, or nil if it does not exist or NodePools are
+// not served by the cluster
+func (m *managementCluster) cachedNodePool(namespace string) (*unstructured.Unstructured, error) {
+	if !m.cache.watchNodePools {
+		return nil, nil
+	}
+	obj, exists, err := m.cache.nodePools.GetIndexer().GetByKey(namespace + "/" + hostedClusterName)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return obj.(*unstructured.Unstructured), nil
+}
+
+// cachedHostedCluster returns the teamspace HostedCluster, or nil if it does not exist
+func (m *managementCluster) cachedHostedCluster(ctx context.Context, namespace string) (*unstructured.Unstructured, error) {
+	if !m.cache.watchHostedClusters {
+		hc, err := m.dynamic.Resource(hostedClusterResource).Namespace(namespace).Get(ctx, hostedClusterName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return hc, err
+	}
+
+	obj, exists, err := m.cache.hostedClusters.GetIndexer().GetByKey(namespace + "/" + hostedClusterName)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return obj.(*unstructured.Unstructured), nil
+}
+
+// hasCachedSecret reports whether a managed secret exists
+func (m *managementCluster) hasCachedSecret(namespace, name string) bool {
+	_, exists, _ := m.cache.secrets.GetIndexer().GetByKey(namespace + "/" + name)
+	return exists
+}
@@ -0,0 +1,160 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+)
+
+// ErrUnknownCluster is returned when a create request names a cluster that is not configured
+var ErrUnknownCluster = errors.New("unknown cluster")
+
+// Cluster is a management cluster teamspaces can be created in, as returned by the API
+type Cluster struct {
+	Name    string `json:"name"`
+	Region  string `json:"region,omitempty"`
+	Default bool   `json:"default,omitempty"`
+}
+
+// managementCluster is a cluster teamspaces are provisioned in, with its own clients and
+// informers. Teamspace objects live in the cluster that provisions them.
+type managementCluster struct {
+	name      string
+	config    config.ClusterConfig
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	metadata  metadata.Interface
+
+	cache       *teamspaceCache
+	started     chan struct{}
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	mapper      meta.ResettableRESTMapper
+}
+
+// Clients are the clients of a management cluster the manager works through
+type Clients struct {
+	Kubernetes kubernetes.Interface
+	Dynamic    dynamic.Interface
+	Metadata   metadata.Interface
+}
+
+// NewClients connects to the cluster with the credentials of its config
+func NewClients(cfg config.ClusterConfig) (Clients, error) {
+	restConfig, err := restConfigFor(cfg)
+	if err != nil {
+		return Clients{}, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create clientset: %v", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+
+	metadataClient, err := metadata.NewForConfig(restConfig)
+	if err != nil {
+		return Clients{}, fmt.Errorf("failed to create metadata client: %v", err)
+	}
+
+	return Clients{Kubernetes: clientset, Dynamic: dynamicClient, Metadata: metadataClient}, nil
+}
+
+// newManagementCluster sets up the cluster over its clients, without starting its informers
+func newManagementCluster(cfg config.ClusterConfig, clients Clients) *managementCluster {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clients.Kubernetes.CoreV1().Events("")})
+
+	c := &managementCluster{
+		name:        cfg.Name,
+		config:      cfg,
+		clientset:   clients.Kubernetes,
+		dynamic:     clients.Dynamic,
+		metadata:    clients.Metadata,
+		started:     make(chan struct{}),
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "teamspace-app"}),
+		mapper:      restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clients.Kubernetes.Discovery())),
+	}
+	c.cache = c.newTeamspaceCache()
+
+	return c
+}
+
+// restConfigFor loads the credentials of the cluster from its kubeconfig, falling back to the
+// in-cluster config and then to the default kubeconfig when it names none
+func restConfigFor(cfg config.ClusterConfig) (*rest.Config, error) {
+	if cfg.Kubeconfig == "" && cfg.Context == "" {
+		if restConfig, err := rest.InClusterConfig(); err == nil {
+			return restConfig, nil
+		}
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if cfg.Kubeconfig != "" {
+		loadingRules.ExplicitPath = cfg.Kubeconfig
+	}
+	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: cfg.Context}
+	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+	restConfig, err := kubeConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes config: %v", err)
+	}
+	return restConfig, nil
+}
+
+// ListClusters returns the management clusters in the order they are configured, the default first
+func (m *TeamspaceManager) ListClusters() []Cluster {
+	clusters := []Cluster{}
+	for i, cluster := range m.clusters {
+		clusters = append(clusters, Cluster{Name: cluster.name, Region: cluster.config.Region, Default: i == 0})
+	}
+	return clusters
+}
+
+// defaultCluster returns the first cluster, which holds what is shared by every cluster
+func (m *TeamspaceManager) defaultCluster() *managementCluster {
+	return m.clusters[0]
+}
+
+// resolveCluster returns the named cluster, falling back to the default
+func (m *TeamspaceManager) resolveCluster(name string) (*managementCluster, error) {
+	if name == "" {
+		return m.defaultCluster(), nil
+	}
+	for _, cluster := range m.clusters {
+		if cluster.name == name {
+			return cluster, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCluster, name)
+}
+
+// recordEvent records a Kubernetes event about the Teamspace object in its cluster
+func (m *managementCluster) recordEvent(ts *v1alpha1.Teamspace, eventType, reason, message string) {
+	m.recorder.Event(&corev1.ObjectReference{
+		APIVersion:      v1alpha1.SchemeGroupVersion.String(),
+		Kind:            v1alpha1.Kind,
+		Name:            ts.Name,
+		UID:             ts.UID,
+		ResourceVersion: ts.ResourceVersion,
+	}, eventType, reason, message)
+}
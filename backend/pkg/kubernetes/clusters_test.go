@@ -0,0 +1,52 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+)
+
+// newTestManager returns a manager of clusters without clients, for what only needs their names
+func newTestManager(names ...string) *TeamspaceManager {
+	m := &TeamspaceManager{}
+	for _, name := range names {
+		m.clusters = append(m.clusters, &managementCluster{name: name})
+	}
+	return m
+}
+
+func TestResolveCluster(t *testing.T) {
+	m := newTestManager("east", "west")
+
+	if cluster, err := m.resolveCluster(""); err != nil || cluster.name != "east" {
+		t.Errorf("expected the first cluster to be the default, got %v, %v", cluster, err)
+	}
+	if cluster, err := m.resolveCluster("west"); err != nil || cluster.name != "west" {
+		t.Errorf("expected west, got %v, %v", cluster, err)
+	}
+	if _, err := m.resolveCluster("north"); !errors.Is(err, ErrUnknownCluster) {
+		t.Errorf("expected an unknown cluster to be rejected, got %v", err)
+	}
+
+	clusters := m.ListClusters()
+	if len(clusters) != 2 || !clusters[0].Default || clusters[1].Default {
+		t.Errorf("expected only the first of 2 clusters to be the default, got %v", clusters)
+	}
+}
+
+func TestWatchCursor(t *testing.T) {
+	m := newTestManager("east", "west")
+
+	cursor := map[string]string{"east": "123", "west": "456"}
+	resourceVersion := encodeCursor(cursor)
+	parsed := m.parseCursor(resourceVersion)
+	if parsed["east"] != "123" || parsed["west"] != "456" {
+		t.Errorf("expected %s to round trip, got %v", resourceVersion, parsed)
+	}
+
+	// Resource versions of a single cluster, or of another set of clusters, start from a snapshot
+	for _, resourceVersion := range []string{"", "123", "east=123", "east=123&north=456", "%zz"} {
+		if parsed := m.parseCursor(resourceVersion); parsed != nil {
+			t.Errorf("expected %q not to resume the watch, got %v", resourceVersion, parsed)
+		}
+	}
+}
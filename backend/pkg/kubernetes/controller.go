@@ -0,0 +1,623 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// resyncPeriod is how often every Teamspace is reconciled even without changes
+	resyncPeriod = 10 * time.Minute
+	// provisioningRequeue is how often a teamspace is checked while its HostedCluster comes up
+	provisioningRequeue = 30 * time.Second
+	// namespaceDeletionRequeue is how long to wait before checking again on a terminating namespace
+	namespaceDeletionRequeue = 5 * time.Second
+)
+
+// TeamspaceController reconciles Teamspace objects into the namespace and everything in it
+type TeamspaceController struct {
+	manager  *TeamspaceManager
+	cluster  *managementCluster
+	informer cache.SharedIndexInformer
+	queue    workqueue.TypedRateLimitingInterface[string]
+}
+
+// NewTeamspaceController creates a controller for the Teamspace objects of the named cluster,
+// sharing the manager's clients and informers of that cluster
+func NewTeamspaceController(manager *TeamspaceManager, clusterName string) (*TeamspaceController, error) {
+	cluster, err := manager.resolveCluster(clusterName)
+	if err != nil {
+		return nil, err
+	}
+	c := &TeamspaceController{
+		manager:  manager,
+		cluster:  cluster,
+		informer: cluster.cache.teamspaces,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "teamspaces/" + cluster.name},
+		),
+	}
+
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+		DeleteFunc: c.enqueue,
+	})
+
+	// Changes to the objects a teamspace is made of requeue the teamspace they belong to
+	related := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueOwningTeamspace,
+		UpdateFunc: func(_, obj interface{}) { c.enqueueOwningTeamspace(obj) },
+		DeleteFunc: c.enqueueOwningTeamspace,
+	}
+	c.cluster.cache.namespaces.AddEventHandler(related)
+	c.cluster.cache.legacyNamespaces.AddEventHandler(related)
+	c.cluster.cache.secrets.AddEventHandler(related)
+	c.cluster.cache.hostedClusters.AddEventHandler(related)
+	c.cluster.cache.resourceQuotas.AddEventHandler(related)
+	c.cluster.cache.limitRanges.AddEventHandler(related)
+	c.cluster.cache.networkPolicies.AddEventHandler(related)
+
+	return c, nil
+}
+
+func (c *TeamspaceController) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		slog.Error("Failed to compute key for object", "error", err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// enqueueOwningTeamspace enqueues the teamspace owning a namespace or an object inside it
+func (c *TeamspaceController) enqueueOwningTeamspace(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+
+	if ns, ok := obj.(*corev1.Namespace); ok {
+		if name := metadataValue(ns.Labels, nameLabel); name != "" {
+			c.queue.Add(name)
+		}
+		return
+	}
+
+	if name := accessor.GetLabels()[teamspaceNameLabel]; name != "" {
+		c.queue.Add(name)
+		return
+	}
+	if ns, err := c.cluster.cachedNamespace(accessor.GetNamespace()); err == nil && ns != nil {
+		if name := metadataValue(ns.Labels, nameLabel); name != "" {
+			c.queue.Add(name)
+		}
+	}
+}
+
+// Run starts the workers once the manager's caches have synced, and blocks until the context is
+// cancelled and the workers have stopped
+func (c *TeamspaceController) Run(ctx context.Context, workers int) {
+	defer c.queue.ShutDown()
+
+	slog.Info("Starting teamspace controller", "cluster", c.cluster.name)
+	if !c.cluster.waitForCacheSync(ctx) {
+		slog.Error("Timed out waiting for caches to sync", "cluster", c.cluster.name)
+		return
+	}
+
+	if err := c.adoptLegacyNamespaces(ctx); err != nil {
+		slog.Error("Failed to adopt legacy teamspace namespaces", "cluster", c.cluster.name, "error", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(ctx, c.runWorker, time.Second)
+		}()
+	}
+
+	<-ctx.Done()
+	slog.Info("Stopping teamspace controller", "cluster", c.cluster.name)
+	c.queue.ShutDown()
+	wg.Wait()
+	slog.Info("Teamspace controller stopped", "cluster", c.cluster.name)
+}
+
+// runWorker processes teamspaces until the context is cancelled. The teamspace being reconciled
+// then is finished rather than left half done, so its calls don't get the cancellation.
+func (c *TeamspaceController) runWorker(ctx context.Context) {
+	for ctx.Err() == nil && c.processNextItem(context.WithoutCancel(ctx)) {
+	}
+}
+
+func (c *TeamspaceController) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	requeueAfter, err := c.reconcile(ctx, key)
+	switch {
+	case err != nil:
+		slog.Error("Failed to reconcile teamspace", "teamspace", key, "cluster", c.cluster.name, "error", err)
+		c.queue.AddRateLimited(key)
+	case requeueAfter > 0:
+		c.queue.Forget(key)
+		c.queue.AddAfter(key, requeueAfter)
+	default:
+		c.queue.Forget(key)
+	}
+
+	return true
+}
+
+// reconcile drives a single Teamspace towards its desired state
+func (c *TeamspaceController) reconcile(ctx context.Context, key string) (time.Duration, error) {
+	obj, exists, err := c.informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	// The conversion produces a copy, so the informer cache is never mutated
+	ts, err := v1alpha1.FromUnstructured(obj.(*unstructured.Unstructured))
+	if err != nil {
+		return 0, err
+	}
+
+	if ts.DeletionTimestamp != nil {
+		return c.finalize(ctx, ts)
+	}
+
+	if !hasString(ts.Finalizers, teamspaceFinalizer) {
+		ts.Finalizers = append(ts.Finalizers, teamspaceFinalizer)
+		return 0, c.update(ctx, ts)
+	}
+
+	previousPhase := ts.Status.Phase
+	status := ts.Status.DeepCopy()
+	status.Namespace = namespaceName(ts.Name)
+	status.ObservedGeneration = ts.Generation
+
+	ns, err := c.cluster.cachedNamespace(status.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	hibernated := isHibernated(ns)
+
+	ready, reconcileErr := c.provision(ctx, ts, status, hibernated)
+	status.LastError = ""
+	switch {
+	case reconcileErr != nil:
+		status.Phase = v1alpha1.PhaseFailed
+		status.LastError = reconcileErr.Error()
+	case hibernated:
+		status.Phase = v1alpha1.PhaseHibernated
+	case ready:
+		status.Phase = v1alpha1.PhaseReady
+	default:
+		status.Phase = v1alpha1.PhaseProvisioning
+	}
+
+	provisioned := markProvisioned(ts, status)
+
+	if err := c.updateStatus(ctx, ts, status); err != nil {
+		return 0, err
+	}
+	// Metrics are recorded once the status is stored, so a retried reconcile doesn't count twice
+	if provisioned {
+		metrics.ProvisioningDuration.Observe(status.ProvisionedAt.Sub(ts.CreationTimestamp.Time).Seconds())
+	}
+	if status.Phase == v1alpha1.PhaseFailed && previousPhase != v1alpha1.PhaseFailed {
+		metrics.ProvisioningFailures.WithLabelValues(failureReason(status)).Inc()
+	}
+
+	if reconcileErr == nil && !ready {
+		return provisioningRequeue, nil
+	}
+	return 0, reconcileErr
+}
+
+// markProvisioned records when the teamspace first became ready, and reports whether that is
+// now. Teamspaces that were ready before the field existed get it without counting as newly
+// provisioned.
+func markProvisioned(ts *v1alpha1.Teamspace, status *v1alpha1.TeamspaceStatus) bool {
+	if status.ProvisionedAt != nil {
+		return false
+	}
+	switch {
+	case ts.Status.Phase == v1alpha1.PhaseReady || ts.Status.Phase == v1alpha1.PhaseHibernated:
+		now := metav1.Now()
+		status.ProvisionedAt = &now
+		return false
+	case status.Phase == v1alpha1.PhaseReady:
+		now := metav1.Now()
+		status.ProvisionedAt = &now
+		return true
+	}
+	return false
+}
+
+// failureReason returns the reason of the first condition that is not met, which provision
+// sets to the step that failed
+func failureReason(status *v1alpha1.TeamspaceStatus) string {
+	for _, conditionType := range []string{v1alpha1.ConditionNamespaceReady, v1alpha1.ConditionHostedClusterReady} {
+		if condition := meta.FindStatusCondition(status.Conditions, conditionType); condition != nil && condition.Status != metav1.ConditionTrue {
+			return condition.Reason
+		}
+	}
+	return "Unknown"
+}
+
+// provision creates everything that belongs to the teamspace, recording progress as conditions.
+// It reports whether the teamspace is ready for use or, when hibernated, fully scaled down.
+func (c *TeamspaceController) provision(ctx context.Context, ts *v1alpha1.Teamspace, status *v1alpha1.TeamspaceStatus, hibernated bool) (bool, error) {
+	if err := c.ensureNamespace(ctx, ts, status.Namespace); err != nil {
+		setCondition(status, ts, v1alpha1.ConditionNamespaceReady, false, "NamespaceFailed", err.Error())
+		return false, err
+	}
+	if err := c.ensureGuardrails(ctx, ts, status.Namespace); err != nil {
+		setCondition(status, ts, v1alpha1.ConditionNamespaceReady, false, "GuardrailsFailed", err.Error())
+		return false, err
+	}
+	if err := c.ensureTemplateManifests(ctx, ts, status.Namespace); err != nil {
+		setCondition(status, ts, v1alpha1.ConditionNamespaceReady, false, "TemplateFailed", err.Error())
+		return false, err
+	}
+	setCondition(status, ts, v1alpha1.ConditionNamespaceReady, true, "NamespaceActive", "")
+
+	hc, err := c.ensureHostedCluster(ctx, ts, status.Namespace)
+	if err != nil {
+		setCondition(status, ts, v1alpha1.ConditionHostedClusterReady, false, "HostedClusterFailed", err.Error())
+		return false, err
+	}
+
+	// A hibernated cluster is expected to be unavailable, so its health is not evaluated
+	if hibernated {
+		done, err := c.hibernate(ctx, status.Namespace)
+		if err != nil {
+			setCondition(status, ts, v1alpha1.ConditionHostedClusterReady, false, "HibernationFailed", err.Error())
+			return false, err
+		}
+		if !done {
+			setCondition(status, ts, v1alpha1.ConditionHostedClusterReady, false, "Hibernating", "Waiting for the NodePools to scale down")
+			return false, nil
+		}
+		setCondition(status, ts, v1alpha1.ConditionHostedClusterReady, false, "Hibernated", "The hosted cluster is hibernated")
+		return true, nil
+	}
+	if failure := hostedClusterFailure(hc); failure != "" {
+		setCondition(status, ts, v1alpha1.ConditionHostedClusterReady, false, "HostedClusterFailed", failure)
+		return false, fmt.Errorf("HostedCluster is failing: %s", failure)
+	}
+	if available, message := hostedClusterAvailable(hc); available {
+		setCondition(status, ts, v1alpha1.ConditionHostedClusterReady, true, "HostedClusterAvailable", message)
+	} else {
+		setCondition(status, ts, v1alpha1.ConditionHostedClusterReady, false, "HostedClusterProvisioning", message)
+	}
+
+	published, err := c.ensureKubeconfig(ctx, ts, status.Namespace, hc)
+	if err != nil {
+		setCondition(status, ts, v1alpha1.ConditionKubeconfigReady, false, "KubeconfigFailed", err.Error())
+		return false, err
+	}
+	if !published {
+		setCondition(status, ts, v1alpha1.ConditionKubeconfigReady, false, "WaitingForHostedCluster", "The HostedCluster has not published its admin kubeconfig yet")
+		return false, nil
+	}
+	setCondition(status, ts, v1alpha1.ConditionKubeconfigReady, true, "KubeconfigPublished", "")
+
+	return meta.IsStatusConditionTrue(status.Conditions, v1alpha1.ConditionHostedClusterReady), nil
+}
+
+// ensureNamespace creates the teamspace namespace or brings its metadata back in line with the spec
+func (c *TeamspaceController) ensureNamespace(ctx context.Context, ts *v1alpha1.Teamspace, name string) error {
+	labels := map[string]string{
+		teamspaceLabel: teamspaceLabelEnabled,
+		ownerLabel:     usernameHash(ts.Spec.Owner),
+		nameLabel:      ts.Name,
+	}
+	for k, v := range c.podSecurityLabels() {
+		labels[k] = v
+	}
+	annotations := map[string]string{
+		releaseAnnotation:       ts.Spec.Release,
+		featureSetAnnotation:    ts.Spec.FeatureSet,
+		schemaVersionAnnotation: labelSchemaVersion,
+		ownerAnnotation:         ts.Spec.Owner,
+	}
+
+	namespaces := c.cluster.clientset.CoreV1().Namespaces()
+	ns, err := namespaces.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		slog.Info("Creating namespace", "teamspace", ts.Name, "namespace", name)
+		_, err = namespaces.Create(ctx, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Labels:          labels,
+				Annotations:     annotations,
+				OwnerReferences: []metav1.OwnerReference{ownerReference(ts)},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create namespace: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get namespace: %v", err)
+	}
+
+	if ns.DeletionTimestamp != nil {
+		return fmt.Errorf("namespace %s is terminating", name)
+	}
+
+	// Refuse to take over a namespace that belongs to another teamspace or to nobody
+	if !isTeamspaceNamespace(ns) || metadataValue(ns.Labels, nameLabel) != ts.Name {
+		return fmt.Errorf("namespace %s already exists and is not managed by this teamspace", name)
+	}
+
+	changed := migrateMetadata(ns)
+	for k, v := range labels {
+		if ns.Labels[k] != v {
+			ns.Labels[k] = v
+			changed = true
+		}
+	}
+	if ns.Annotations == nil {
+		ns.Annotations = map[string]string{}
+	}
+	for k, v := range annotations {
+		if ns.Annotations[k] != v {
+			ns.Annotations[k] = v
+			changed = true
+		}
+	}
+	if !hasOwnerReference(ns.OwnerReferences, ts) {
+		ns.OwnerReferences = append(ns.OwnerReferences, ownerReference(ts))
+		changed = true
+	}
+
+	if changed {
+		if _, err := namespaces.Update(ctx, ns, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update namespace: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// finalize deletes the HostedCluster and the namespace, and releases the finalizer once it is gone
+func (c *TeamspaceController) finalize(ctx context.Context, ts *v1alpha1.Teamspace) (time.Duration, error) {
+	if !hasString(ts.Finalizers, teamspaceFinalizer) {
+		return 0, nil
+	}
+
+	name := ts.Status.Namespace
+	if name == "" {
+		name = namespaceName(ts.Name)
+	}
+
+	namespaces := c.cluster.clientset.CoreV1().Namespaces()
+	ns, err := namespaces.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 0, fmt.Errorf("failed to get namespace: %v", err)
+	}
+
+	if ts.Annotations[forceDeleteAnnotation] == "true" {
+		return 0, c.forceFinalize(ctx, ts, ns)
+	}
+
+	if err == nil && metadataValue(ns.Labels, nameLabel) == ts.Name {
+		if ts.Status.Phase != v1alpha1.PhaseDeleting {
+			status := ts.Status.DeepCopy()
+			status.Phase = v1alpha1.PhaseDeleting
+			if err := c.updateStatus(ctx, ts, status); err != nil {
+				return 0, err
+			}
+		}
+
+		gone, err := c.deleteHostedCluster(ctx, name)
+		if err != nil {
+			return 0, err
+		}
+		if !gone {
+			return namespaceDeletionRequeue, nil
+		}
+
+		if ns.DeletionTimestamp == nil {
+			slog.Info("Deleting namespace", "teamspace", ts.Name, "namespace", name)
+			if err := namespaces.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				return 0, fmt.Errorf("failed to delete namespace: %v", err)
+			}
+		}
+
+		return namespaceDeletionRequeue, nil
+	}
+
+	slog.Info("Namespace is gone, releasing teamspace", "teamspace", ts.Name, "namespace", name)
+	ts.Finalizers = removeString(ts.Finalizers, teamspaceFinalizer)
+	return 0, c.update(ctx, ts)
+}
+
+// forceFinalize requests the deletion of the namespace without waiting for the HostedCluster,
+// then releases the Teamspace object. Whatever the HostedCluster leaves behind in the namespace
+// is left to the HyperShift operator.
+func (c *TeamspaceController) forceFinalize(ctx context.Context, ts *v1alpha1.Teamspace, ns *corev1.Namespace) error {
+	if ns != nil && metadataValue(ns.Labels, nameLabel) == ts.Name && ns.DeletionTimestamp == nil {
+		slog.Warn("Force deleting namespace", "teamspace", ts.Name, "namespace", ns.Name)
+		if err := c.cluster.clientset.CoreV1().Namespaces().Delete(ctx, ns.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete namespace: %v", err)
+		}
+	}
+
+	c.cluster.recordEvent(ts, corev1.EventTypeWarning, "ForceDeleted", "The teamspace was deleted without waiting for its HostedCluster")
+	slog.Warn("Releasing force deleted teamspace", "teamspace", ts.Name)
+	ts.Finalizers = removeString(ts.Finalizers, teamspaceFinalizer)
+	return c.update(ctx, ts)
+}
+
+// adoptLegacyNamespaces creates Teamspace objects for namespaces created before the CRD existed
+func (c *TeamspaceController) adoptLegacyNamespaces(ctx context.Context) error {
+	// Namespaces the label migration has not rewritten yet are adopted too
+	var namespaces []corev1.Namespace
+	for _, selector := range []string{fmt.Sprintf("%s=%s", teamspaceLabel, teamspaceLabelEnabled), legacyTeamspaceSelector} {
+		list, err := c.cluster.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return fmt.Errorf("failed to list namespaces: %v", err)
+		}
+		namespaces = append(namespaces, list.Items...)
+	}
+
+	for _, ns := range namespaces {
+		name := metadataValue(ns.Labels, nameLabel)
+		if name == "" || ns.DeletionTimestamp != nil || namespaceName(name) != ns.Name {
+			continue
+		}
+		if _, exists, _ := c.informer.GetIndexer().GetByKey(name); exists {
+			continue
+		}
+
+		// Namespaces labelled before usernames were hashed have the owner in the label
+		owner := ns.Annotations[ownerAnnotation]
+		if owner == "" {
+			owner = metadataValue(ns.Labels, ownerLabel)
+		}
+		slog.Info("Adopting legacy namespace", "teamspace", name, "namespace", ns.Name)
+		// The teamspace gets the default lifetime from its adoption
+		expiresAt := time.Now().Add(c.manager.config.Lifecycle.DefaultTTL.Duration).Truncate(time.Second)
+		ts := &v1alpha1.Teamspace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      map[string]string{ownerLabel: usernameHash(owner)},
+				Annotations: map[string]string{schemaVersionAnnotation: labelSchemaVersion},
+			},
+			Spec: v1alpha1.TeamspaceSpec{
+				DisplayName: name,
+				Owner:       owner,
+				Release:     metadataValue(ns.Annotations, releaseAnnotation),
+				FeatureSet:  metadataValue(ns.Annotations, featureSetAnnotation),
+				ExpiresAt:   &metav1.Time{Time: expiresAt},
+			},
+		}
+		obj, err := ts.ToUnstructured()
+		if err != nil {
+			return err
+		}
+		_, err = c.cluster.dynamic.Resource(v1alpha1.TeamspaceResource).Create(ctx, obj, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to adopt namespace %s: %v", ns.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *TeamspaceController) update(ctx context.Context, ts *v1alpha1.Teamspace) error {
+	obj, err := ts.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	_, err = c.cluster.dynamic.Resource(v1alpha1.TeamspaceResource).Update(ctx, obj, metav1.UpdateOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to update teamspace %s: %v", ts.Name, err)
+	}
+	return nil
+}
+
+// updateStatus writes the status subresource if it changed
+func (c *TeamspaceController) updateStatus(ctx context.Context, ts *v1alpha1.Teamspace, status *v1alpha1.TeamspaceStatus) error {
+	if equality.Semantic.DeepEqual(ts.Status, *status) {
+		return nil
+	}
+
+	ts.Status = *status
+	obj, err := ts.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	_, err = c.cluster.dynamic.Resource(v1alpha1.TeamspaceResource).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to update status of teamspace %s: %v", ts.Name, err)
+	}
+	return nil
+}
+
+// setCondition records a condition on the status being built
+func setCondition(status *v1alpha1.TeamspaceStatus, ts *v1alpha1.Teamspace, conditionType string, ok bool, reason, message string) {
+	conditionStatus := metav1.ConditionFalse
+	if ok {
+		conditionStatus = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ts.Generation,
+	})
+}
+
+func ownerReference(ts *v1alpha1.Teamspace) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Kind:       v1alpha1.Kind,
+		Name:       ts.Name,
+		UID:        ts.UID,
+		Controller: &controller,
+	}
+}
+
+func hasOwnerReference(refs []metav1.OwnerReference, ts *v1alpha1.Teamspace) bool {
+	for _, ref := range refs {
+		if ref.UID == ts.UID {
+			return true
+		}
+	}
+	return false
+}
+
+func hasString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,306 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+// devKubeconfigSecretName is the Secret simulated HostedClusters publish their admin kubeconfig in
+const devKubeconfigSecretName = hostedClusterName + "-admin-kubeconfig"
+
+// InCluster reports whether the backend runs in a pod, with the credentials of its service account
+func InCluster() bool {
+	_, err := rest.InClusterConfig()
+	return err == nil
+}
+
+// DevCluster is an in-memory management cluster for local development. Fake clients stand in
+// for the API server, and a simulation of HyperShift makes HostedClusters available and scales
+// NodePools after a delay, so teamspaces go through their phases without a cluster.
+type DevCluster struct {
+	kube     *fake.Clientset
+	dynamic  *dynamicfake.FakeDynamicClient
+	metadata *metadatafake.FakeMetadataClient
+	// delay is how long a HostedCluster takes to become available
+	delay time.Duration
+
+	mu sync.Mutex
+	// simulating holds the objects a simulation is running for, by resource and key
+	simulating map[string]bool
+}
+
+// NewDevCluster creates an empty cluster holding the pull secret of the config
+func NewDevCluster(appConfig *config.Config, delay time.Duration) *DevCluster {
+	kube := fake.NewClientset()
+	// HyperShift is installed, so HostedClusters are watched like on a real cluster
+	kube.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{{
+		GroupVersion: hostedClusterResource.GroupVersion().String(),
+		APIResources: []metav1.APIResource{
+			{Name: hostedClusterResource.Resource, Kind: "HostedCluster", Namespaced: true},
+			{Name: nodePoolResource.Resource, Kind: "NodePool", Namespaced: true},
+		},
+	}}
+
+	pullSecret := appConfig.HyperShift.PullSecret
+	if pullSecret.Name != "" {
+		kube.Tracker().Add(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: pullSecret.Name, Namespace: pullSecret.Namespace},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{}}`)},
+		})
+	}
+
+	dynamic := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		v1alpha1.TeamspaceResource: "TeamspaceList",
+		hostedClusterResource:      "HostedClusterList",
+		nodePoolResource:           "NodePoolList",
+	})
+	kube.PrependReactor("create", "*", setCreationTimestamp)
+	dynamic.PrependReactor("create", "*", setCreationTimestamp)
+
+	return &DevCluster{
+		kube:       kube,
+		dynamic:    dynamic,
+		metadata:   metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme()),
+		delay:      delay,
+		simulating: map[string]bool{},
+	}
+}
+
+// Clients returns the clients the manager works through
+func (d *DevCluster) Clients() Clients {
+	return Clients{Kubernetes: d.kube, Dynamic: d.dynamic, Metadata: d.metadata}
+}
+
+// Run simulates HyperShift until the context is cancelled
+func (d *DevCluster) Run(ctx context.Context) {
+	dynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(d.dynamic, resyncPeriod)
+	for _, resource := range []schema.GroupVersionResource{hostedClusterResource, nodePoolResource} {
+		dynamicFactory.ForResource(resource).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { d.observe(ctx, resource, obj) },
+			UpdateFunc: func(_, obj interface{}) { d.observe(ctx, resource, obj) },
+		})
+	}
+
+	// The fake clients keep objects apart, so the Secrets written through the clientset are
+	// copied to the metadata client the cache reads them from
+	kubeFactory := informers.NewSharedInformerFactory(d.kube, resyncPeriod)
+	kubeFactory.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { d.mirrorSecret(obj, false) },
+		UpdateFunc: func(_, obj interface{}) { d.mirrorSecret(obj, false) },
+		DeleteFunc: func(obj interface{}) { d.mirrorSecret(obj, true) },
+	})
+
+	dynamicFactory.Start(ctx.Done())
+	kubeFactory.Start(ctx.Done())
+	<-ctx.Done()
+	dynamicFactory.Shutdown()
+	kubeFactory.Shutdown()
+}
+
+// observe starts the simulation of a HostedCluster that is not available yet or of a NodePool
+// that is not at its desired size, unless one is already running
+func (d *DevCluster) observe(ctx context.Context, resource schema.GroupVersionResource, obj interface{}) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok || u.GetDeletionTimestamp() != nil {
+		return
+	}
+
+	var simulate func(context.Context, string, string)
+	switch resource {
+	case hostedClusterResource:
+		if available, _ := hostedClusterAvailable(u); available {
+			return
+		}
+		simulate = d.provisionHostedCluster
+	case nodePoolResource:
+		desired, _, _ := unstructured.NestedInt64(u.Object, "spec", "replicas")
+		current, _, _ := unstructured.NestedInt64(u.Object, "status", "replicas")
+		if desired == current {
+			return
+		}
+		simulate = d.scaleNodePool
+	}
+
+	key := resource.Resource + "/" + u.GetNamespace() + "/" + u.GetName()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.simulating[key] {
+		return
+	}
+	d.simulating[key] = true
+	go func() {
+		simulate(ctx, u.GetNamespace(), u.GetName())
+		d.mu.Lock()
+		delete(d.simulating, key)
+		d.mu.Unlock()
+	}()
+}
+
+// provisionHostedCluster reports the control plane as progressing halfway through the delay,
+// then publishes the admin kubeconfig and reports the HostedCluster available
+func (d *DevCluster) provisionHostedCluster(ctx context.Context, namespace, name string) {
+	if !sleep(ctx, d.delay/2) {
+		return
+	}
+	d.updateHostedCluster(ctx, namespace, name, func(hc *unstructured.Unstructured) {
+		unstructured.SetNestedSlice(hc.Object, []interface{}{
+			devCondition("Available", metav1.ConditionFalse, "WaitingForControlPlane", "The hosted control plane is starting"),
+			devCondition("Progressing", metav1.ConditionTrue, "Provisioning", "Simulated provisioning in progress"),
+		}, "status", "conditions")
+	})
+
+	if !sleep(ctx, d.delay-d.delay/2) {
+		return
+	}
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: https://api.%[1]s.dev.invalid:6443
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: admin
+current-context: %[1]s
+users:
+- name: admin
+  user:
+    token: development
+`, namespace)
+	_, err := d.kube.CoreV1().Secrets(namespace).Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: devKubeconfigSecretName, Namespace: namespace},
+		Data:       map[string][]byte{"kubeconfig": []byte(kubeconfig)},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		slog.Error("Failed to publish simulated kubeconfig", "namespace", namespace, "error", err)
+		return
+	}
+	d.updateHostedCluster(ctx, namespace, name, func(hc *unstructured.Unstructured) {
+		unstructured.SetNestedSlice(hc.Object, []interface{}{
+			devCondition("Available", metav1.ConditionTrue, "AsExpected", "The hosted control plane is available"),
+			devCondition("Progressing", metav1.ConditionFalse, "AsExpected", "Simulated provisioning completed"),
+		}, "status", "conditions")
+		unstructured.SetNestedMap(hc.Object, map[string]interface{}{
+			"host": fmt.Sprintf("api.%s.dev.invalid", namespace),
+			"port": int64(6443),
+		}, "status", "controlPlaneEndpoint")
+		unstructured.SetNestedField(hc.Object, devKubeconfigSecretName, "status", "kubeConfig", "name")
+	})
+	slog.Info("Simulated HostedCluster is available", "namespace", namespace, "name", name)
+}
+
+// scaleNodePool brings the NodePool to its desired size after a share of the delay
+func (d *DevCluster) scaleNodePool(ctx context.Context, namespace, name string) {
+	if !sleep(ctx, d.delay/4) {
+		return
+	}
+	nodePools := d.dynamic.Resource(nodePoolResource).Namespace(namespace)
+	np, err := nodePools.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	desired, _, _ := unstructured.NestedInt64(np.Object, "spec", "replicas")
+	unstructured.SetNestedField(np.Object, desired, "status", "replicas")
+	if _, err := nodePools.Update(ctx, np, metav1.UpdateOptions{}); err != nil {
+		slog.Error("Failed to scale simulated NodePool", "namespace", namespace, "name", name, "error", err)
+	}
+}
+
+// updateHostedCluster applies the change to the current HostedCluster, if it still exists
+func (d *DevCluster) updateHostedCluster(ctx context.Context, namespace, name string, change func(*unstructured.Unstructured)) {
+	hostedClusters := d.dynamic.Resource(hostedClusterResource).Namespace(namespace)
+	hc, err := hostedClusters.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	change(hc)
+	if _, err := hostedClusters.Update(ctx, hc, metav1.UpdateOptions{}); err != nil {
+		slog.Error("Failed to update simulated HostedCluster", "namespace", namespace, "name", name, "error", err)
+	}
+}
+
+// mirrorSecret copies the metadata of the Secret to the metadata client, or removes it
+func (d *DevCluster) mirrorSecret(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+
+	tracker := d.metadata.Tracker()
+	var err error
+	if deleted {
+		err = tracker.Delete(secretResource, secret.Namespace, secret.Name)
+	} else {
+		partial := &metav1.PartialObjectMetadata{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: *secret.ObjectMeta.DeepCopy(),
+		}
+		if _, getErr := tracker.Get(secretResource, secret.Namespace, secret.Name); getErr == nil {
+			err = tracker.Update(secretResource, partial, secret.Namespace)
+		} else {
+			err = tracker.Create(secretResource, partial, secret.Namespace)
+		}
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		slog.Error("Failed to mirror simulated Secret", "namespace", secret.Namespace, "name", secret.Name, "error", err)
+	}
+}
+
+// devCondition builds a HostedCluster condition as HyperShift reports it
+func devCondition(conditionType string, status metav1.ConditionStatus, reason, message string) interface{} {
+	return map[string]interface{}{
+		"type":               conditionType,
+		"status":             string(status),
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// setCreationTimestamp stamps created objects like the API server does, which the fake clients
+// leave to the caller, and lets the default reactor store them
+func setCreationTimestamp(action k8stesting.Action) (bool, runtime.Object, error) {
+	if obj, ok := action.(k8stesting.CreateAction).GetObject().(metav1.Object); ok {
+		if created := obj.GetCreationTimestamp(); created.IsZero() {
+			obj.SetCreationTimestamp(metav1.Now())
+		}
+	}
+	return false, nil, nil
+}
+
+// sleep waits for the duration and reports whether the context is still running
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
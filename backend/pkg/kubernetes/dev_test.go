@@ -0,0 +1,56 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+)
+
+func TestDevClusterProvisions(t *testing.T) {
+	appConfig := config.Default()
+	appConfig.HyperShift.PullSecret.Namespace = "teamspaces"
+	appConfig.HyperShift.PullSecret.Name = "pull-secret"
+
+	cluster := NewDevCluster(appConfig, 200*time.Millisecond)
+	m, err := NewTeamspaceManagerForClients(appConfig, []Clients{cluster.Clients()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller, err := NewTeamspaceController(m, config.DefaultClusterName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go cluster.Run(t.Context())
+	go controller.Run(t.Context(), 1)
+	m.Start(t.Context())
+	t.Cleanup(m.Shutdown)
+	if !m.WaitForCacheSync(t.Context()) {
+		t.Fatal("the cache did not sync")
+	}
+
+	teamspace, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The teamspace goes through provisioning to ready, and its kubeconfig can be downloaded
+	seen := map[v1alpha1.TeamspacePhase]bool{}
+	deadline := time.Now().Add(10 * time.Second)
+	for !seen[v1alpha1.PhaseReady] {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the teamspace to be ready, saw %v", seen)
+		}
+		if current, err := m.GetTeamspace(teamspace.ID, ""); err == nil {
+			seen[current.Phase] = true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !seen[v1alpha1.PhaseProvisioning] {
+		t.Errorf("expected the teamspace to be provisioning before it was ready, saw %v", seen)
+	}
+	if kubeconfig, err := m.GetKubeconfig(teamspace.ID); err != nil || len(kubeconfig) == 0 {
+		t.Errorf("expected the kubeconfig of a ready teamspace, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// minTTL is the shortest lifetime a teamspace can be given. The reaper also waits at least this
+// long between warning the owner and deleting the teamspace.
+const minTTL = time.Hour
+
+// ErrInvalidTTL is returned when a requested lifetime is outside the configured bounds
+var ErrInvalidTTL = errors.New("invalid ttl")
+
+// expiryFor returns the expiry of a teamspace created now with the given ttl, or the default ttl when zero
+func (m *TeamspaceManager) expiryFor(now time.Time, ttl time.Duration) (time.Time, error) {
+	if ttl == 0 {
+		ttl = m.config.Lifecycle.DefaultTTL.Duration
+	}
+	if ttl < minTTL {
+		return time.Time{}, fmt.Errorf("%w: must be at least %s", ErrInvalidTTL, minTTL)
+	}
+	if maxTTL := m.config.Lifecycle.MaxTTL.Duration; ttl > maxTTL {
+		return time.Time{}, fmt.Errorf("%w: cannot exceed %s", ErrInvalidTTL, maxTTL)
+	}
+	return now.Add(ttl), nil
+}
+
+// ExtendTeamspace pushes the expiry of a teamspace back by ttl, or by the default ttl when zero.
+// The new expiry is capped at the max ttl from now, and the added cluster-hours must fit in the
+// quota of the owner. username and teams identify who is extending the teamspace.
+func (m *TeamspaceManager) ExtendTeamspace(name string, ttl time.Duration, username string, teams []string) (*Teamspace, error) {
+	if ttl == 0 {
+		ttl = m.config.Lifecycle.DefaultTTL.Duration
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("%w: cannot be negative", ErrInvalidTTL)
+	}
+	_, cluster, err := m.getTeamspace(name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	extended, cluster, err := m.updateTeamspace(name, "", func(ts *v1alpha1.Teamspace) error {
+		now := time.Now()
+		from := now
+		if ts.Spec.ExpiresAt != nil && ts.Spec.ExpiresAt.After(now) {
+			from = ts.Spec.ExpiresAt.Time
+		}
+		expiresAt := from.Add(ttl)
+		if limit := now.Add(m.config.Lifecycle.MaxTTL.Duration); expiresAt.After(limit) {
+			expiresAt = limit
+		}
+		expiresAt = expiresAt.Truncate(time.Second)
+
+		// The ledger holds the new expiry until the cache observes it
+		owner := ts.Spec.Owner
+		reserved := reservation{Name: displayName(ts), Nodes: m.teamspaceNodes(cluster, ts), ExpiresAt: expiresAt, ReservedAt: now}
+		limits, err := m.limitsOf(owner, username, teams)
+		if err != nil {
+			return err
+		}
+		err = m.ledger.reserve(context.TODO(), owner, ts.Name, reserved, limits, func() (map[string]reservation, error) {
+			return m.observedReservations(owner)
+		})
+		if err != nil {
+			return err
+		}
+		ts.Spec.ExpiresAt = &metav1.Time{Time: expiresAt}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Teamspace extended", "teamspace", name, "expires_at", extended.Spec.ExpiresAt.Time)
+	return toTeamspace(extended, cluster.name), nil
+}
+
+// reaperLease is the Lease held by the replica that runs the reaper
+const reaperLease = "teamspace-reaper"
+
+// RunReaper warns the owners of expiring teamspaces and deletes expired ones until the context
+// is cancelled. Only the replica holding the reaper lease reaps, the others stand by.
+func (m *TeamspaceManager) RunReaper(ctx context.Context) {
+	if !m.WaitForCacheSync(ctx) {
+		return
+	}
+	m.runAsLeader(ctx, reaperLease, func(ctx context.Context) {
+		slog.Info("Starting reaper", "interval", m.config.Lifecycle.ReapInterval.Duration)
+		wait.UntilWithContext(ctx, m.reap, m.config.Lifecycle.ReapInterval.Duration)
+	})
+}
+
+func (m *TeamspaceManager) reap(ctx context.Context) {
+	now := time.Now()
+	for _, cluster := range m.clusters {
+		teamspaces, err := cachedTeamspaces(cluster.cache.teamspaces.GetIndexer().List())
+		if err != nil {
+			slog.Error("Failed to list teamspaces to reap", "cluster", cluster.name, "error", err)
+			continue
+		}
+
+		for _, ts := range teamspaces {
+			if ts.DeletionTimestamp != nil {
+				continue
+			}
+			if ts.Spec.ExpiresAt == nil {
+				// Teamspaces adopted before they were given an expiry get the default lifetime from now
+				if err := m.setDefaultExpiry(ctx, cluster, ts, now); err != nil {
+					slog.Error("Failed to set the expiry of teamspace", "teamspace", ts.Name, "cluster", cluster.name, "error", err)
+				}
+				continue
+			}
+			if err := m.reapTeamspace(ctx, cluster, ts, now); err != nil {
+				slog.Error("Failed to reap teamspace", "teamspace", ts.Name, "cluster", cluster.name, "error", err)
+			}
+		}
+	}
+}
+
+// reapTeamspace moves a single teamspace along its expiry: the owner is warned once the expiry
+// is within the warning period, and the teamspace is deleted once it has expired and the warning
+// has been out for at least minTTL
+func (m *TeamspaceManager) reapTeamspace(ctx context.Context, cluster *managementCluster, ts *v1alpha1.Teamspace, now time.Time) error {
+	expiresAt := ts.Spec.ExpiresAt.Time
+	warning := meta.FindStatusCondition(ts.Status.Conditions, v1alpha1.ConditionExpiring)
+	warned := warning != nil && warning.Status == metav1.ConditionTrue
+
+	switch {
+	case now.Before(expiresAt.Add(-m.config.Lifecycle.ExpiryWarning.Duration)):
+		// The expiry was extended after the owner was warned
+		if warned {
+			return cluster.setExpiringCondition(ctx, ts, false, "ExpiryExtended", fmt.Sprintf("The teamspace expires at %s", expiresAt.Format(time.RFC3339)))
+		}
+		return nil
+
+	case !warned:
+		message := fmt.Sprintf("The teamspace expires at %s unless it is extended", expiresAt.Format(time.RFC3339))
+		if err := cluster.setExpiringCondition(ctx, ts, true, "ExpiryApproaching", message); err != nil {
+			return err
+		}
+		cluster.recordEvent(ts, corev1.EventTypeWarning, "ExpiryApproaching", message)
+		slog.Info("Warned owner of expiring teamspace", "teamspace", ts.Name, "owner", ts.Spec.Owner, "expires_at", expiresAt)
+		return nil
+
+	case now.Before(expiresAt) || now.Before(warning.LastTransitionTime.Add(minTTL)):
+		return nil
+	}
+
+	cluster.recordEvent(ts, corev1.EventTypeNormal, "Expired", fmt.Sprintf("The teamspace expired at %s and is being deleted", expiresAt.Format(time.RFC3339)))
+	slog.Info("Deleting expired teamspace", "teamspace", ts.Name, "owner", ts.Spec.Owner)
+	if err := cluster.dynamic.Resource(v1alpha1.TeamspaceResource).Delete(ctx, ts.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete expired teamspace %s: %v", ts.Name, err)
+	}
+	return nil
+}
+
+// setDefaultExpiry gives a teamspace without an expiry the default lifetime, counted from now
+func (m *TeamspaceManager) setDefaultExpiry(ctx context.Context, cluster *managementCluster, ts *v1alpha1.Teamspace, now time.Time) error {
+	expiresAt := now.Add(m.config.Lifecycle.DefaultTTL.Duration).Truncate(time.Second)
+	ts.Spec.ExpiresAt = &metav1.Time{Time: expiresAt}
+	obj, err := ts.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	// A conflict means the teamspace changed since it was cached; the next pass retries with the new version
+	_, err = cluster.dynamic.Resource(v1alpha1.TeamspaceResource).Update(ctx, obj, metav1.UpdateOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to set expiry of teamspace %s: %v", ts.Name, err)
+	}
+	slog.Info("Set expiry of teamspace", "teamspace", ts.Name, "owner", ts.Spec.Owner, "expires_at", expiresAt)
+	return nil
+}
+
+// setExpiringCondition records whether the owner has been warned of the expiry
+func (m *managementCluster) setExpiringCondition(ctx context.Context, ts *v1alpha1.Teamspace, warned bool, reason, message string) error {
+	status := ts.Status.DeepCopy()
+	setCondition(status, ts, v1alpha1.ConditionExpiring, warned, reason, message)
+	ts.Status = *status
+
+	obj, err := ts.ToUnstructured()
+	if err != nil {
+		return err
+	}
+	// A conflict means the teamspace changed since it was cached; the next pass retries with the new version
+	_, err = m.dynamic.Resource(v1alpha1.TeamspaceResource).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to update expiry status of teamspace %s: %v", ts.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package kubernetes
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReaperGivesAdoptedTeamspacesTheDefaultLifetime(t *testing.T) {
+	appConfig := config.Default()
+	m := newFakeManager(t, appConfig)
+	cluster := m.defaultCluster()
+
+	// A teamspace adopted before adoption set an expiry
+	adopted := &v1alpha1.Teamspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy"},
+		Spec:       v1alpha1.TeamspaceSpec{DisplayName: "legacy", Owner: "alice"},
+	}
+	createCachedTeamspace(t, cluster, adopted)
+
+	now := time.Now()
+	m.reap(t.Context())
+
+	obj, err := cluster.dynamic.Resource(v1alpha1.TeamspaceResource).Get(t.Context(), "legacy", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reaped, err := v1alpha1.FromUnstructured(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := now.Add(appConfig.Lifecycle.DefaultTTL.Duration)
+	if reaped.Spec.ExpiresAt == nil || reaped.Spec.ExpiresAt.Sub(want).Abs() > time.Minute {
+		t.Errorf("expected the teamspace to expire around %s, got %v", want, reaped.Spec.ExpiresAt)
+	}
+}
+
+func TestOnlyTheLeaseHolderRuns(t *testing.T) {
+	m := newFakeManager(t, config.Default())
+
+	var running atomic.Int32
+	started := make(chan struct{}, 2)
+	run := func(ctx context.Context) {
+		if running.Add(1) > 1 {
+			t.Error("expected a single replica to run at a time")
+		}
+		started <- struct{}{}
+		<-ctx.Done()
+		running.Add(-1)
+	}
+
+	first, stopFirst := context.WithCancel(t.Context())
+	firstDone := make(chan struct{})
+	go func() {
+		defer close(firstDone)
+		m.runAsLeader(first, "test", run)
+	}()
+	<-started
+
+	secondDone := make(chan struct{})
+	go func() {
+		defer close(secondDone)
+		m.runAsLeader(t.Context(), "test", run)
+	}()
+	t.Cleanup(func() { <-secondDone })
+	select {
+	case <-started:
+		t.Fatal("expected the second replica to wait for the lease")
+	case <-time.After(2 * retryPeriod):
+	}
+
+	// The first replica releases the lease as it stops, which lets the second one take over
+	stopFirst()
+	<-firstDone
+	select {
+	case <-started:
+	case <-time.After(2 * leaseDuration):
+		t.Fatal("expected the second replica to take over the released lease")
+	}
+}
@@ -0,0 +1,148 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// fieldManager owns the fields of the guardrails applied with server-side apply
+	fieldManager = "teamspace-app"
+
+	resourceQuotaName     = "teamspace-quota"
+	limitRangeName        = "teamspace-limits"
+	defaultDenyPolicyName = "teamspace-default-deny"
+)
+
+// podSecurityLabels returns the Pod Security Admission labels of teamspace namespaces
+func (c *TeamspaceController) podSecurityLabels() map[string]string {
+	podSecurity := c.manager.config.Guardrails.PodSecurity
+	psaLabels := map[string]string{}
+	for mode, level := range map[string]string{"enforce": podSecurity.Enforce, "audit": podSecurity.Audit, "warn": podSecurity.Warn} {
+		if level != "" {
+			psaLabels["pod-security.kubernetes.io/"+mode] = level
+		}
+	}
+	return psaLabels
+}
+
+// ensureGuardrails applies the configured ResourceQuota, LimitRange and NetworkPolicies into the
+// teamspace namespace, with the quota of the teamspace template taking precedence. Server-side
+// apply reverts edits to the fields the config sets, and the controller watches the objects so
+// deleted ones are recreated.
+func (c *TeamspaceController) ensureGuardrails(ctx context.Context, ts *v1alpha1.Teamspace, namespace string) error {
+	guardrails := c.manager.config.Guardrails
+	if template := c.manager.templateOf(ts); template != nil && template.ResourceQuota != nil {
+		guardrails.ResourceQuota = template.ResourceQuota
+	}
+	clientset := c.cluster.clientset
+	typeAndObjectMeta := func(kind, apiVersion, name string) (metav1.TypeMeta, metav1.ObjectMeta) {
+		return metav1.TypeMeta{Kind: kind, APIVersion: apiVersion}, metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{teamspaceNameLabel: ts.Name},
+		}
+	}
+
+	quotas := clientset.CoreV1().ResourceQuotas(namespace)
+	if guardrails.ResourceQuota != nil && len(guardrails.ResourceQuota.Hard) > 0 {
+		quota := &corev1.ResourceQuota{Spec: *guardrails.ResourceQuota}
+		quota.TypeMeta, quota.ObjectMeta = typeAndObjectMeta("ResourceQuota", "v1", resourceQuotaName)
+		if err := apply(quota, func(data []byte, opts metav1.PatchOptions) error {
+			_, err := quotas.Patch(ctx, resourceQuotaName, types.ApplyPatchType, data, opts)
+			return err
+		}); err != nil {
+			return err
+		}
+	} else if c.managesGuardrail(c.cluster.cache.resourceQuotas, namespace, resourceQuotaName) {
+		if err := quotas.Delete(ctx, resourceQuotaName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete ResourceQuota: %v", err)
+		}
+	}
+
+	limitRanges := clientset.CoreV1().LimitRanges(namespace)
+	if guardrails.LimitRange != nil && len(guardrails.LimitRange.Limits) > 0 {
+		limitRange := &corev1.LimitRange{Spec: *guardrails.LimitRange}
+		limitRange.TypeMeta, limitRange.ObjectMeta = typeAndObjectMeta("LimitRange", "v1", limitRangeName)
+		if err := apply(limitRange, func(data []byte, opts metav1.PatchOptions) error {
+			_, err := limitRanges.Patch(ctx, limitRangeName, types.ApplyPatchType, data, opts)
+			return err
+		}); err != nil {
+			return err
+		}
+	} else if c.managesGuardrail(c.cluster.cache.limitRanges, namespace, limitRangeName) {
+		if err := limitRanges.Delete(ctx, limitRangeName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete LimitRange: %v", err)
+		}
+	}
+
+	policies := map[string]networkingv1.NetworkPolicySpec{}
+	for name, spec := range guardrails.NetworkPolicies {
+		policies[name] = spec
+	}
+	if guardrails.DefaultDeny != nil && *guardrails.DefaultDeny {
+		policies[defaultDenyPolicyName] = networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		}
+	}
+
+	networkPolicies := clientset.NetworkingV1().NetworkPolicies(namespace)
+	for name, spec := range policies {
+		policy := &networkingv1.NetworkPolicy{Spec: spec}
+		policy.TypeMeta, policy.ObjectMeta = typeAndObjectMeta("NetworkPolicy", "networking.k8s.io/v1", name)
+		if err := apply(policy, func(data []byte, opts metav1.PatchOptions) error {
+			_, err := networkPolicies.Patch(ctx, name, types.ApplyPatchType, data, opts)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Remove the policies that were dropped from the config
+	existing, err := c.cluster.cache.networkPolicyList.NetworkPolicies(namespace).List(labels.SelectorFromSet(labels.Set{teamspaceNameLabel: ts.Name}))
+	if err != nil {
+		return fmt.Errorf("failed to list NetworkPolicies: %v", err)
+	}
+	for _, policy := range existing {
+		if _, desired := policies[policy.Name]; desired {
+			continue
+		}
+		slog.Info("Deleting NetworkPolicy that is no longer configured", "namespace", namespace, "name", policy.Name)
+		if err := networkPolicies.Delete(ctx, policy.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete NetworkPolicy %s: %v", policy.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// managesGuardrail reports whether a guardrail the controller applied is still in the cache
+func (c *TeamspaceController) managesGuardrail(informer cache.SharedIndexInformer, namespace, name string) bool {
+	_, exists, _ := informer.GetIndexer().GetByKey(namespace + "/" + name)
+	return exists
+}
+
+// apply sends the object as a server-side apply patch, taking ownership of conflicting fields
+func apply(obj metav1.Object, patch func([]byte, metav1.PatchOptions) error) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", obj.GetName(), err)
+	}
+	force := true
+	if err := patch(data, metav1.PatchOptions{FieldManager: fieldManager, Force: &force}); err != nil {
+		return fmt.Errorf("failed to apply %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+	}
+	return nil
+}
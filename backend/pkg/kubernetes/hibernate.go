@@ -0,0 +1,466 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+// Annotations on the teamspace namespace recording a hibernation, so that it can be resumed
+// after a restart of the backend
+const (
+	// hibernatedAnnotation holds the time the teamspace was hibernated
+	hibernatedAnnotation = v1alpha1.GroupName + "/hibernated"
+	// nodePoolReplicasAnnotation holds the replicas of each NodePool before hibernation
+	nodePoolReplicasAnnotation = v1alpha1.GroupName + "/nodepool-replicas"
+	// nodePoolAutoScalingAnnotation holds the autoscaling bounds of each NodePool before hibernation
+	nodePoolAutoScalingAnnotation = v1alpha1.GroupName + "/nodepool-autoscaling"
+	// controlPlaneReplicasAnnotation holds the replicas of each control plane workload before hibernation
+	controlPlaneReplicasAnnotation = v1alpha1.GroupName + "/control-plane-replicas"
+)
+
+// nodePoolAutoScaling is the spec.autoScaling of a NodePool, which replaces its replicas when set
+type nodePoolAutoScaling struct {
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+// autoScalingOf returns the autoscaling bounds of a NodePool, or nil when it has a fixed size
+func autoScalingOf(np *unstructured.Unstructured) *nodePoolAutoScaling {
+	bounds, found, _ := unstructured.NestedMap(np.Object, "spec", "autoScaling")
+	if !found {
+		return nil
+	}
+	minimum, _, _ := unstructured.NestedInt64(bounds, "min")
+	maximum, _, _ := unstructured.NestedInt64(bounds, "max")
+	return &nodePoolAutoScaling{Min: minimum, Max: maximum}
+}
+
+// Kinds of the control plane workloads scaled down during hibernation
+const (
+	deploymentKind  = "Deployment"
+	statefulSetKind = "StatefulSet"
+)
+
+// ErrInvalidState is returned when a teamspace cannot make the requested transition
+var ErrInvalidState = errors.New("invalid teamspace state")
+
+// controlPlaneNamespace returns the namespace HyperShift runs the hosted control plane in
+func controlPlaneNamespace(namespace string) string {
+	return fmt.Sprintf("%s-%s", namespace, hostedClusterName)
+}
+
+// isHibernated reports whether the teamspace namespace is marked as hibernated
+func isHibernated(ns *corev1.Namespace) bool {
+	return ns != nil && ns.Annotations[hibernatedAnnotation] != ""
+}
+
+// HibernateTeamspace scales the NodePools of a teamspace to zero and marks it as hibernated.
+// The controller pauses and scales down the control plane once the nodes are gone.
+func (m *TeamspaceManager) HibernateTeamspace(name string) (*Teamspace, error) {
+	ctx := context.TODO()
+
+	ts, cluster, err := m.getTeamspace(name, "")
+	if err != nil {
+		return nil, err
+	}
+	if ts.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("%w: teamspace %s is being deleted", ErrInvalidState, name)
+	}
+	teamspace := toTeamspace(ts, cluster.name)
+
+	nodePools, err := cluster.dynamic.Resource(nodePoolResource).Namespace(teamspace.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list NodePools: %v", err)
+	}
+
+	// Record the replicas before touching anything, so a failure part way can always be resumed
+	err = cluster.updateNamespace(ctx, teamspace.Namespace, func(ns *corev1.Namespace) error {
+		if isHibernated(ns) {
+			return fmt.Errorf("%w: teamspace %s is already hibernated", ErrInvalidState, name)
+		}
+		replicas := replicaAnnotation(ns, nodePoolReplicasAnnotation)
+		autoScaling := autoScalingAnnotation(ns)
+		for _, np := range nodePools.Items {
+			if bounds := autoScalingOf(&np); bounds != nil {
+				autoScaling[np.GetName()] = *bounds
+			} else if count, _, _ := unstructured.NestedInt64(np.Object, "spec", "replicas"); count > 0 {
+				replicas[np.GetName()] = int32(count)
+			}
+		}
+		if err := setReplicaAnnotation(ns, nodePoolReplicasAnnotation, replicas); err != nil {
+			return err
+		}
+		if err := setAutoScalingAnnotation(ns, autoScaling); err != nil {
+			return err
+		}
+		ns.Annotations[hibernatedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, np := range nodePools.Items {
+		if err := cluster.scaleNodePool(ctx, teamspace.Namespace, np.GetName(), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Info("Teamspace is hibernating", "teamspace", name)
+	teamspace.Phase = v1alpha1.PhaseHibernated
+	return teamspace, nil
+}
+
+// ResumeTeamspace restores the control plane and the NodePools of a hibernated teamspace
+func (m *TeamspaceManager) ResumeTeamspace(name string) (*Teamspace, error) {
+	ctx := context.TODO()
+
+	ts, cluster, err := m.getTeamspace(name, "")
+	if err != nil {
+		return nil, err
+	}
+	if ts.DeletionTimestamp != nil {
+		return nil, fmt.Errorf("%w: teamspace %s is being deleted", ErrInvalidState, name)
+	}
+	teamspace := toTeamspace(ts, cluster.name)
+
+	// Clear the marker first so the controller stops scaling the control plane down,
+	// but keep the recorded replicas until they have been restored
+	var controlPlaneReplicas, nodePoolReplicas map[string]int32
+	var nodePoolAutoScaling map[string]nodePoolAutoScaling
+	err = cluster.updateNamespace(ctx, teamspace.Namespace, func(ns *corev1.Namespace) error {
+		controlPlaneReplicas = replicaAnnotation(ns, controlPlaneReplicasAnnotation)
+		nodePoolReplicas = replicaAnnotation(ns, nodePoolReplicasAnnotation)
+		nodePoolAutoScaling = autoScalingAnnotation(ns)
+		if !isHibernated(ns) && len(controlPlaneReplicas) == 0 && len(nodePoolReplicas) == 0 && len(nodePoolAutoScaling) == 0 {
+			return fmt.Errorf("%w: teamspace %s is not hibernated", ErrInvalidState, name)
+		}
+		delete(ns.Annotations, hibernatedAnnotation)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Bring the control plane back before the nodes that need it
+	for key, replicas := range controlPlaneReplicas {
+		kind, workload, err := splitWorkloadKey(key)
+		if err != nil {
+			slog.Warn("Skipping workload to resume", "teamspace", name, "error", err)
+			continue
+		}
+		if err := cluster.scaleWorkload(ctx, controlPlaneNamespace(teamspace.Namespace), kind, workload, replicas); err != nil {
+			return nil, err
+		}
+	}
+	if err := cluster.setHostedClusterPaused(ctx, teamspace.Namespace, false); err != nil {
+		return nil, err
+	}
+	for nodePool, replicas := range nodePoolReplicas {
+		if err := cluster.scaleNodePool(ctx, teamspace.Namespace, nodePool, replicas); err != nil {
+			return nil, err
+		}
+	}
+	for nodePool, bounds := range nodePoolAutoScaling {
+		if err := cluster.autoScaleNodePool(ctx, teamspace.Namespace, nodePool, bounds); err != nil {
+			return nil, err
+		}
+	}
+
+	err = cluster.updateNamespace(ctx, teamspace.Namespace, func(ns *corev1.Namespace) error {
+		delete(ns.Annotations, controlPlaneReplicasAnnotation)
+		delete(ns.Annotations, nodePoolReplicasAnnotation)
+		delete(ns.Annotations, nodePoolAutoScalingAnnotation)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Teamspace is resuming", "teamspace", name)
+	teamspace.Phase = v1alpha1.PhaseProvisioning
+	return teamspace, nil
+}
+
+// hibernate finishes the hibernation started by HibernateTeamspace: once the NodePools have no
+// nodes left, the HostedCluster is paused and the control plane workloads are scaled to zero.
+// It reports whether the control plane is fully scaled down.
+func (c *TeamspaceController) hibernate(ctx context.Context, namespace string) (bool, error) {
+	m := c.cluster
+
+	nodePools, err := m.dynamic.Resource(nodePoolResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list NodePools: %v", err)
+	}
+	drained := true
+	for _, np := range nodePools.Items {
+		desired, _, _ := unstructured.NestedInt64(np.Object, "spec", "replicas")
+		current, _, _ := unstructured.NestedInt64(np.Object, "status", "replicas")
+		if desired > 0 || autoScalingOf(&np) != nil {
+			if err := m.scaleNodePool(ctx, namespace, np.GetName(), 0); err != nil {
+				return false, err
+			}
+		}
+		if desired > 0 || current > 0 {
+			drained = false
+		}
+	}
+	if !drained {
+		return false, nil
+	}
+
+	// Pause reconciliation so HyperShift does not scale the control plane back up
+	if err := m.setHostedClusterPaused(ctx, namespace, true); err != nil {
+		return false, err
+	}
+
+	controlPlane := controlPlaneNamespace(namespace)
+	workloads := map[string]int32{}
+	deployments, err := m.clientset.AppsV1().Deployments(controlPlane).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list control plane deployments: %v", err)
+	}
+	for _, d := range deployments.Items {
+		if d.Spec.Replicas != nil && *d.Spec.Replicas > 0 {
+			workloads[workloadKey(deploymentKind, d.Name)] = *d.Spec.Replicas
+		}
+	}
+	statefulSets, err := m.clientset.AppsV1().StatefulSets(controlPlane).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list control plane statefulsets: %v", err)
+	}
+	for _, s := range statefulSets.Items {
+		if s.Spec.Replicas != nil && *s.Spec.Replicas > 0 {
+			workloads[workloadKey(statefulSetKind, s.Name)] = *s.Spec.Replicas
+		}
+	}
+	if len(workloads) == 0 {
+		return true, nil
+	}
+
+	// Record the replicas before scaling down; the update fails if the teamspace was resumed meanwhile
+	err = m.updateNamespace(ctx, namespace, func(ns *corev1.Namespace) error {
+		if !isHibernated(ns) {
+			return fmt.Errorf("%w: teamspace was resumed while hibernating", ErrInvalidState)
+		}
+		replicas := replicaAnnotation(ns, controlPlaneReplicasAnnotation)
+		for key, count := range workloads {
+			replicas[key] = count
+		}
+		return setReplicaAnnotation(ns, controlPlaneReplicasAnnotation, replicas)
+	})
+	if errors.Is(err, ErrInvalidState) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for key := range workloads {
+		kind, workload, _ := splitWorkloadKey(key)
+		if err := m.scaleWorkload(ctx, controlPlane, kind, workload, 0); err != nil {
+			return false, err
+		}
+	}
+
+	slog.Info("Scaled down control plane workloads", "namespace", controlPlane, "workloads", len(workloads))
+	return true, nil
+}
+
+// updateNamespace applies a change to the teamspace namespace, retrying on conflicts
+func (m *managementCluster) updateNamespace(ctx context.Context, name string, mutate func(*corev1.Namespace) error) error {
+	namespaces := m.clientset.CoreV1().Namespaces()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ns, err := namespaces.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("%w: namespace %s does not exist yet", ErrInvalidState, name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get namespace: %v", err)
+		}
+		if ns.Annotations == nil {
+			ns.Annotations = map[string]string{}
+		}
+		if err := mutate(ns); err != nil {
+			return err
+		}
+		_, err = namespaces.Update(ctx, ns, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// scaleNodePool sets the replicas of a NodePool, turning off its autoscaling, which HyperShift
+// does not allow together with replicas
+func (m *managementCluster) scaleNodePool(ctx context.Context, namespace, name string, replicas int32) error {
+	nodePools := m.dynamic.Resource(nodePoolResource).Namespace(namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		np, err := nodePools.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		current, found, _ := unstructured.NestedInt64(np.Object, "spec", "replicas")
+		if found && current == int64(replicas) && autoScalingOf(np) == nil {
+			return nil
+		}
+		unstructured.RemoveNestedField(np.Object, "spec", "autoScaling")
+		if err := unstructured.SetNestedField(np.Object, int64(replicas), "spec", "replicas"); err != nil {
+			return err
+		}
+		_, err = nodePools.Update(ctx, np, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to scale NodePool %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// autoScaleNodePool restores the autoscaling bounds of a NodePool in place of its replicas
+func (m *managementCluster) autoScaleNodePool(ctx context.Context, namespace, name string, bounds nodePoolAutoScaling) error {
+	nodePools := m.dynamic.Resource(nodePoolResource).Namespace(namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		np, err := nodePools.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if current := autoScalingOf(np); current != nil && *current == bounds {
+			return nil
+		}
+		unstructured.RemoveNestedField(np.Object, "spec", "replicas")
+		autoScaling := map[string]interface{}{"min": bounds.Min, "max": bounds.Max}
+		if err := unstructured.SetNestedMap(np.Object, autoScaling, "spec", "autoScaling"); err != nil {
+			return err
+		}
+		_, err = nodePools.Update(ctx, np, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to autoscale NodePool %s/%s: %v", namespace, name, err)
+	}
+	return nil
+}
+
+// setHostedClusterPaused pauses or unpauses the reconciliation of the teamspace HostedCluster
+func (m *managementCluster) setHostedClusterPaused(ctx context.Context, namespace string, paused bool) error {
+	hostedClusters := m.dynamic.Resource(hostedClusterResource).Namespace(namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		hc, err := hostedClusters.Get(ctx, hostedClusterName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		pausedUntil, _, _ := unstructured.NestedString(hc.Object, "spec", "pausedUntil")
+		if paused == (pausedUntil == "true") {
+			return nil
+		}
+		if paused {
+			err = unstructured.SetNestedField(hc.Object, "true", "spec", "pausedUntil")
+		} else {
+			unstructured.RemoveNestedField(hc.Object, "spec", "pausedUntil")
+		}
+		if err != nil {
+			return err
+		}
+		_, err = hostedClusters.Update(ctx, hc, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to update HostedCluster %s/%s: %v", namespace, hostedClusterName, err)
+	}
+	return nil
+}
+
+// scaleWorkload sets the replicas of a control plane deployment or statefulset through its scale subresource
+func (m *managementCluster) scaleWorkload(ctx context.Context, namespace, kind, name string, replicas int32) error {
+	scale := &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       autoscalingv1.ScaleSpec{Replicas: replicas},
+	}
+
+	var err error
+	switch kind {
+	case deploymentKind:
+		_, err = m.clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+	case statefulSetKind:
+		_, err = m.clientset.AppsV1().StatefulSets(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+	default:
+		err = fmt.Errorf("unsupported kind %s", kind)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to scale %s %s/%s: %v", kind, namespace, name, err)
+	}
+	return nil
+}
+
+// workloadKey identifies a control plane workload in the replicas annotation
+func workloadKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+func splitWorkloadKey(key string) (string, string, error) {
+	kind, name, found := strings.Cut(key, "/")
+	if !found {
+		return "", "", fmt.Errorf("malformed workload %q", key)
+	}
+	return kind, name, nil
+}
+
+// replicaAnnotation decodes a replicas annotation, returning an empty map when it is missing or malformed
+func replicaAnnotation(ns *corev1.Namespace, key string) map[string]int32 {
+	replicas := map[string]int32{}
+	if value := ns.Annotations[key]; value != "" {
+		if err := json.Unmarshal([]byte(value), &replicas); err != nil {
+			slog.Warn("Ignoring malformed annotation", "namespace", ns.Name, "annotation", key, "error", err)
+		}
+	}
+	return replicas
+}
+
+func setReplicaAnnotation(ns *corev1.Namespace, key string, replicas map[string]int32) error {
+	if len(replicas) == 0 {
+		delete(ns.Annotations, key)
+		return nil
+	}
+	value, err := json.Marshal(replicas)
+	if err != nil {
+		return err
+	}
+	ns.Annotations[key] = string(value)
+	return nil
+}
+
+// autoScalingAnnotation decodes the autoscaling annotation, returning an empty map when it is missing or malformed
+func autoScalingAnnotation(ns *corev1.Namespace) map[string]nodePoolAutoScaling {
+	autoScaling := map[string]nodePoolAutoScaling{}
+	if value := ns.Annotations[nodePoolAutoScalingAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &autoScaling); err != nil {
+			slog.Warn("Ignoring malformed annotation", "namespace", ns.Name, "annotation", nodePoolAutoScalingAnnotation, "error", err)
+		}
+	}
+	return autoScaling
+}
+
+func setAutoScalingAnnotation(ns *corev1.Namespace, autoScaling map[string]nodePoolAutoScaling) error {
+	if len(autoScaling) == 0 {
+		delete(ns.Annotations, nodePoolAutoScalingAnnotation)
+		return nil
+	}
+	value, err := json.Marshal(autoScaling)
+	if err != nil {
+		return err
+	}
+	ns.Annotations[nodePoolAutoScalingAnnotation] = string(value)
+	return nil
+}
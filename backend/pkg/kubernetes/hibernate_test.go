@@ -0,0 +1,54 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/teamspace-app/backend/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHibernationTurnsAutoscalingOffAndBackOn(t *testing.T) {
+	m := newFakeManager(t, config.Default())
+	cluster := m.defaultCluster()
+	nodePools := cluster.dynamic.Resource(nodePoolResource).Namespace("teamspace-demo")
+
+	np := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "hypershift.openshift.io/v1beta1",
+		"kind":       "NodePool",
+		"metadata":   map[string]interface{}{"name": hostedClusterName, "namespace": "teamspace-demo"},
+		"spec": map[string]interface{}{
+			"autoScaling": map[string]interface{}{"min": int64(1), "max": int64(3)},
+		},
+	}}
+	if _, err := nodePools.Create(t.Context(), np, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	bounds := autoScalingOf(np)
+	if bounds == nil || *bounds != (nodePoolAutoScaling{Min: 1, Max: 3}) {
+		t.Fatalf("expected the autoscaling bounds of the NodePool, got %+v", bounds)
+	}
+
+	if err := cluster.scaleNodePool(t.Context(), "teamspace-demo", hostedClusterName, 0); err != nil {
+		t.Fatal(err)
+	}
+	hibernated, err := nodePools.Get(t.Context(), hostedClusterName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas, found, _ := unstructured.NestedInt64(hibernated.Object, "spec", "replicas")
+	if !found || replicas != 0 || autoScalingOf(hibernated) != nil {
+		t.Errorf("expected the NodePool to be scaled to zero without autoscaling, got %v", hibernated.Object["spec"])
+	}
+
+	if err := cluster.autoScaleNodePool(t.Context(), "teamspace-demo", hostedClusterName, *bounds); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := nodePools.Get(t.Context(), hostedClusterName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := unstructured.NestedInt64(resumed.Object, "spec", "replicas"); found || autoScalingOf(resumed) == nil || *autoScalingOf(resumed) != *bounds {
+		t.Errorf("expected the NodePool to autoscale again without replicas, got %v", resumed.Object["spec"])
+	}
+}
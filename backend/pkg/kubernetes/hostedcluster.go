@@ -0,0 +1,355 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// hostedClusterName is the name of the HostedCluster and NodePool created in every teamspace.
+	// Their DNS names are prefixed with the teamspace ID instead, so they are unique.
+	hostedClusterName = "dev"
+	// pullSecretName is the name of the pull secret copied into every teamspace namespace
+	pullSecretName = "pull-secret"
+	// teamspaceNameLabel marks the objects the controller creates inside a teamspace namespace
+	teamspaceNameLabel = v1alpha1.GroupName + "/teamspace"
+)
+
+var (
+	hostedClusterResource = schema.GroupVersionResource{Group: "hypershift.openshift.io", Version: "v1beta1", Resource: "hostedclusters"}
+	nodePoolResource      = schema.GroupVersionResource{Group: "hypershift.openshift.io", Version: "v1beta1", Resource: "nodepools"}
+)
+
+// kubeconfigSecretName returns the name of the secret served by GetKubeconfig
+func kubeconfigSecretName(name string) string {
+	return fmt.Sprintf("teamspace-%s-kubeconfig", name)
+}
+
+// ensurePullSecret copies the configured pull secret into the teamspace namespace
+func (c *TeamspaceController) ensurePullSecret(ctx context.Context, ts *v1alpha1.Teamspace, namespace string) error {
+	source := c.manager.config.HyperShift.PullSecret
+	if source.Name == "" {
+		return fmt.Errorf("no pull secret configured")
+	}
+
+	secrets := c.cluster.clientset.CoreV1().Secrets(namespace)
+	if _, err := secrets.Get(ctx, pullSecretName, metav1.GetOptions{}); err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get pull secret: %v", err)
+	}
+
+	original, err := c.cluster.clientset.CoreV1().Secrets(source.Namespace).Get(ctx, source.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get source pull secret %s/%s: %v", source.Namespace, source.Name, err)
+	}
+
+	_, err = secrets.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pullSecretName,
+			Namespace: namespace,
+			Labels:    map[string]string{teamspaceNameLabel: ts.Name},
+		},
+		Type: original.Type,
+		Data: original.Data,
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create pull secret: %v", err)
+	}
+
+	return nil
+}
+
+// ensureHostedCluster creates the HostedCluster and its default NodePool if they don't exist yet.
+// Existing objects are left alone so users can annotate and tweak them freely.
+func (c *TeamspaceController) ensureHostedCluster(ctx context.Context, ts *v1alpha1.Teamspace, namespace string) (*unstructured.Unstructured, error) {
+	if err := c.ensurePullSecret(ctx, ts, namespace); err != nil {
+		return nil, err
+	}
+
+	hostedClusters := c.cluster.dynamic.Resource(hostedClusterResource).Namespace(namespace)
+	hc, err := hostedClusters.Get(ctx, hostedClusterName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		slog.Info("Creating HostedCluster", "teamspace", ts.Name, "namespace", namespace, "name", hostedClusterName)
+		hc, err = hostedClusters.Create(ctx, c.buildHostedCluster(ts, namespace), metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensure HostedCluster: %v", err)
+	}
+
+	nodePools := c.cluster.dynamic.Resource(nodePoolResource).Namespace(namespace)
+	_, err = nodePools.Get(ctx, hostedClusterName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		slog.Info("Creating NodePool", "teamspace", ts.Name, "namespace", namespace, "name", hostedClusterName)
+		_, err = nodePools.Create(ctx, c.buildNodePool(ts, namespace), metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensure NodePool: %v", err)
+	}
+
+	return hc, nil
+}
+
+// ensureKubeconfig copies the HostedCluster admin kubeconfig into the secret served to users.
+// It reports false while the HostedCluster hasn't published its kubeconfig yet.
+func (c *TeamspaceController) ensureKubeconfig(ctx context.Context, ts *v1alpha1.Teamspace, namespace string, hc *unstructured.Unstructured) (bool, error) {
+	sourceName, _, _ := unstructured.NestedString(hc.Object, "status", "kubeConfig", "name")
+	if sourceName == "" {
+		return false, nil
+	}
+
+	secrets := c.cluster.clientset.CoreV1().Secrets(namespace)
+	source, err := secrets.Get(ctx, sourceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get HostedCluster kubeconfig: %v", err)
+	}
+
+	kubeconfig := source.Data["kubeconfig"]
+	if len(kubeconfig) == 0 {
+		return false, nil
+	}
+
+	name := kubeconfigSecretName(ts.Name)
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		slog.Info("Publishing kubeconfig Secret", "teamspace", ts.Name, "namespace", namespace, "name", name)
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{teamspaceNameLabel: ts.Name},
+			},
+			Data: map[string][]byte{"kubeconfig": kubeconfig},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to create kubeconfig secret: %v", err)
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get kubeconfig secret: %v", err)
+	}
+
+	// Keep the copy current when HyperShift rotates the admin kubeconfig, and label
+	// secrets created by hand before the controller existed so the cache can see them
+	if string(existing.Data["kubeconfig"]) != string(kubeconfig) || existing.Labels[teamspaceNameLabel] != ts.Name {
+		existing.Data = map[string][]byte{"kubeconfig": kubeconfig}
+		if existing.Labels == nil {
+			existing.Labels = map[string]string{}
+		}
+		existing.Labels[teamspaceNameLabel] = ts.Name
+		if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return false, fmt.Errorf("failed to update kubeconfig secret: %v", err)
+		}
+	}
+
+	return true, nil
+}
+
+// hostedClusterFailureConditions are the HostedCluster conditions that signal a problem the
+// HostedCluster will not recover from on its own, keyed by the status that signals the problem
+var hostedClusterFailureConditions = map[string]string{
+	"Degraded":           string(metav1.ConditionTrue),
+	"ValidConfiguration": string(metav1.ConditionFalse),
+	"ValidReleaseImage":  string(metav1.ConditionFalse),
+}
+
+// hostedClusterFailure returns the message of the first condition reporting a problem, if any
+func hostedClusterFailure(hc *unstructured.Unstructured) string {
+	conditions, _, _ := unstructured.NestedSlice(hc.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditionType, _ := condition["type"].(string)
+		if failing, ok := hostedClusterFailureConditions[conditionType]; ok && condition["status"] == failing {
+			message, _ := condition["message"].(string)
+			return fmt.Sprintf("%s: %s", conditionType, message)
+		}
+	}
+	return ""
+}
+
+// hostedClusterAPIServerURL returns the URL of the hosted API server once it is published
+func hostedClusterAPIServerURL(hc *unstructured.Unstructured) string {
+	host, _, _ := unstructured.NestedString(hc.Object, "status", "controlPlaneEndpoint", "host")
+	port, _, _ := unstructured.NestedInt64(hc.Object, "status", "controlPlaneEndpoint", "port")
+	if host == "" {
+		return ""
+	}
+	if port == 0 {
+		port = 443
+	}
+	return fmt.Sprintf("https://%s:%d", host, port)
+}
+
+// hostedClusterConsoleURL returns the URL of the console on the default ingress of the hosted
+// cluster. HyperShift prefixes the base domain with the name of the HostedCluster unless its
+// spec sets a prefix, as it does for teamspaces created since their DNS names are unique.
+func hostedClusterConsoleURL(hc *unstructured.Unstructured) string {
+	baseDomain, _, _ := unstructured.NestedString(hc.Object, "spec", "dns", "baseDomain")
+	if baseDomain == "" {
+		return ""
+	}
+	prefix, _, _ := unstructured.NestedString(hc.Object, "spec", "dns", "baseDomainPrefix")
+	if prefix == "" {
+		prefix = hc.GetName()
+	}
+	return fmt.Sprintf("https://console-openshift-console.apps.%s.%s", prefix, baseDomain)
+}
+
+// hostedClusterAvailable reports the Available condition of a HostedCluster and its message
+func hostedClusterAvailable(hc *unstructured.Unstructured) (bool, string) {
+	conditions, _, _ := unstructured.NestedSlice(hc.Object, "status", "conditions")
+	for _, item := range conditions {
+		condition, ok := item.(map[string]interface{})
+		if !ok || condition["type"] != "Available" {
+			continue
+		}
+		message, _ := condition["message"].(string)
+		return condition["status"] == string(metav1.ConditionTrue), message
+	}
+	return false, "The HostedCluster has not reported its availability yet"
+}
+
+// deleteHostedCluster deletes the HostedCluster and reports whether it is gone.
+// HyperShift needs the HostedCluster to be deleted before the namespace to clean up its infrastructure.
+func (c *TeamspaceController) deleteHostedCluster(ctx context.Context, namespace string) (bool, error) {
+	hostedClusters := c.cluster.dynamic.Resource(hostedClusterResource).Namespace(namespace)
+	hc, err := hostedClusters.Get(ctx, hostedClusterName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get HostedCluster: %v", err)
+	}
+
+	if hc.GetDeletionTimestamp() == nil {
+		slog.Info("Deleting HostedCluster", "namespace", namespace, "name", hostedClusterName)
+		if err := hostedClusters.Delete(ctx, hostedClusterName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to delete HostedCluster: %v", err)
+		}
+	}
+
+	return false, nil
+}
+
+func (c *TeamspaceController) buildHostedCluster(ts *v1alpha1.Teamspace, namespace string) *unstructured.Unstructured {
+	cfg := c.manager.config.HyperShift
+
+	var services []interface{}
+	for _, service := range []string{"APIServer", "OAuthServer", "Konnectivity", "Ignition"} {
+		services = append(services, map[string]interface{}{
+			"service": service,
+			"servicePublishingStrategy": map[string]interface{}{
+				"type": cfg.ServicePublishingStrategy,
+			},
+		})
+	}
+
+	spec := map[string]interface{}{
+		"release":    map[string]interface{}{"image": ts.Spec.Release},
+		"pullSecret": map[string]interface{}{"name": pullSecretName},
+		// Every HostedCluster has the same name, so the ID of the teamspace keeps its ingress
+		// and API domains apart from those of the others
+		"dns": map[string]interface{}{"baseDomain": cfg.BaseDomain, "baseDomainPrefix": ts.Name},
+		"networking": map[string]interface{}{
+			"networkType":    "OVNKubernetes",
+			"clusterNetwork": []interface{}{map[string]interface{}{"cidr": "10.132.0.0/14"}},
+			"serviceNetwork": []interface{}{map[string]interface{}{"cidr": "172.31.0.0/16"}},
+		},
+		"platform":                     platformSpec(cfg.Platform, cfg.PlatformSpec),
+		"services":                     services,
+		"controllerAvailabilityPolicy": "SingleReplica",
+	}
+
+	if ts.Spec.FeatureSet != "" {
+		spec["configuration"] = map[string]interface{}{
+			"featureGate": map[string]interface{}{"featureSet": ts.Spec.FeatureSet},
+		}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": hostedClusterResource.GroupVersion().String(),
+		"kind":       "HostedCluster",
+		"metadata": map[string]interface{}{
+			"name":      hostedClusterName,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{teamspaceNameLabel: ts.Name},
+		},
+		"spec": spec,
+	}}
+}
+
+func (c *TeamspaceController) buildNodePool(ts *v1alpha1.Teamspace, namespace string) *unstructured.Unstructured {
+	cfg := c.manager.config.HyperShift
+	template := c.manager.templateOf(ts)
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": nodePoolResource.GroupVersion().String(),
+		"kind":       "NodePool",
+		"metadata": map[string]interface{}{
+			"name":      hostedClusterName,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{teamspaceNameLabel: ts.Name},
+		},
+		"spec": map[string]interface{}{
+			"clusterName": hostedClusterName,
+			"replicas":    int64(c.manager.nodePoolReplicas(template)),
+			"release":     map[string]interface{}{"image": ts.Spec.Release},
+			"management": map[string]interface{}{
+				"upgradeType": "Replace",
+			},
+			"platform": platformSpec(cfg.Platform, nodePoolPlatformSettings(cfg.Platform, cfg.NodePoolPlatformSpec, template)),
+		},
+	}}
+}
+
+// platformSpec builds the platform section shared by HostedClusters and NodePools.
+// The platform specific settings live under the lowercased type, e.g. "aws" or "kubevirt".
+func platformSpec(platformType string, settings map[string]interface{}) map[string]interface{} {
+	platform := map[string]interface{}{"type": platformType}
+	if len(settings) > 0 {
+		platform[strings.ToLower(platformType)] = copyJSONValue(settings)
+	}
+	return platform
+}
+
+// copyJSONValue copies config values so built objects never alias the shared config
+func copyJSONValue(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = copyJSONValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyJSONValue(item)
+		}
+		return out
+	case float64:
+		// encoding/json decodes numbers as float64, which unstructured objects don't accept
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+		return v
+	default:
+		return v
+	}
+}
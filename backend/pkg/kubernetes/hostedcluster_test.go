@@ -0,0 +1,24 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHostedClustersHaveTheirOwnDomain(t *testing.T) {
+	appConfig := config.Default()
+	appConfig.HyperShift.BaseDomain = "example.com"
+	c := &TeamspaceController{manager: &TeamspaceManager{config: appConfig}}
+
+	for _, id := range []string{"demo-1a2b3c4d", "demo-5e6f7a8b"} {
+		ts := &v1alpha1.Teamspace{ObjectMeta: metav1.ObjectMeta{Name: id}}
+		hc := c.buildHostedCluster(ts, namespaceName(id))
+		want := "https://console-openshift-console.apps." + id + ".example.com"
+		if console := hostedClusterConsoleURL(hc); console != want {
+			t.Errorf("expected the console of %s at %s, got %s", id, want, console)
+		}
+	}
+}
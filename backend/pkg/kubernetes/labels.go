@@ -0,0 +1,192 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// Labels and annotations stamped on teamspace namespaces and Teamspace objects
+const (
+	teamspaceLabel          = v1alpha1.GroupName + "/managed"
+	ownerLabel              = v1alpha1.GroupName + "/owner"
+	ownerAnnotation         = v1alpha1.GroupName + "/owner"
+	nameLabel               = v1alpha1.GroupName + "/name"
+	releaseAnnotation       = v1alpha1.GroupName + "/release"
+	featureSetAnnotation    = v1alpha1.GroupName + "/feature-set"
+	schemaVersionAnnotation = v1alpha1.GroupName + "/schema-version"
+	teamspaceLabelEnabled   = "true"
+
+	// labelSchemaVersion is the version of the label schema written by this backend
+	labelSchemaVersion = "2"
+
+	// usernameHashLength is how many hex characters of its hash stand in for a username
+	usernameHashLength = 32
+)
+
+// usernameHash encodes a username for label values and object names, which can't hold the
+// emails and other usernames of OIDC providers. Usernames are case insensitive. The username
+// itself is kept in the spec or an annotation of the object.
+func usernameHash(username string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(username)))
+	return hex.EncodeToString(sum[:])[:usernameHashLength]
+}
+
+// legacyKeys maps the keys of the current schema to the unprefixed keys of schema version 1
+var legacyKeys = map[string]string{
+	teamspaceLabel:       "teamspace",
+	ownerLabel:           "owner",
+	nameLabel:            "name",
+	releaseAnnotation:    "release",
+	featureSetAnnotation: "feature-set",
+}
+
+// legacyTeamspaceSelector selects the namespaces still labelled with schema version 1
+var legacyTeamspaceSelector = fmt.Sprintf("%s=%s", legacyKeys[teamspaceLabel], teamspaceLabelEnabled)
+
+// metadataValue returns the value of a label or annotation, falling back to its schema version 1
+// key on objects the migrator has not rewritten yet
+func metadataValue(values map[string]string, key string) string {
+	if value, ok := values[key]; ok {
+		return value
+	}
+	return values[legacyKeys[key]]
+}
+
+// migrateMetadata moves the labels and annotations of schema version 1 to their prefixed keys and
+// records the schema version. It reports whether anything changed.
+func migrateMetadata(obj metav1.Object) bool {
+	labels := obj.GetLabels()
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	changed := false
+	for _, values := range []map[string]string{labels, annotations} {
+		for key, legacy := range legacyKeys {
+			value, ok := values[legacy]
+			if !ok {
+				continue
+			}
+			if _, set := values[key]; !set {
+				values[key] = value
+			}
+			delete(values, legacy)
+			changed = true
+		}
+	}
+	if annotations[schemaVersionAnnotation] != labelSchemaVersion {
+		annotations[schemaVersionAnnotation] = labelSchemaVersion
+		changed = true
+	}
+
+	obj.SetLabels(labels)
+	obj.SetAnnotations(annotations)
+	return changed
+}
+
+// MigrateLabels rewrites the namespaces and Teamspace objects labelled with schema version 1 to
+// the current schema in every cluster. Reads understand both schemas, so teamspaces keep working
+// while it runs.
+func (m *TeamspaceManager) MigrateLabels(ctx context.Context) error {
+	for _, cluster := range m.clusters {
+		if err := cluster.migrateLabels(ctx); err != nil {
+			return fmt.Errorf("cluster %s: %v", cluster.name, err)
+		}
+	}
+	return nil
+}
+
+func (m *managementCluster) migrateLabels(ctx context.Context) error {
+	// Objects already migrated by another replica, or deleted meanwhile, are skipped
+	migrated, skipped := 0, 0
+
+	namespaces := m.clientset.CoreV1().Namespaces()
+	legacy, err := namespaces.List(ctx, metav1.ListOptions{LabelSelector: legacyTeamspaceSelector})
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces: %v", err)
+	}
+	for _, ns := range legacy.Items {
+		updated := false
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			updated = false
+			latest, err := namespaces.Get(ctx, ns.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if !migrateMetadata(latest) {
+				return nil
+			}
+			if _, err := namespaces.Update(ctx, latest, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+			updated = true
+			return nil
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to migrate namespace %s: %v", ns.Name, err)
+		}
+		if !updated {
+			skipped++
+			continue
+		}
+		migrated++
+		slog.Info("Migrated namespace labels", "namespace", ns.Name, "schema_version", labelSchemaVersion)
+	}
+
+	teamspaces := m.dynamic.Resource(v1alpha1.TeamspaceResource)
+	list, err := teamspaces.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list teamspaces: %v", err)
+	}
+	for _, item := range list.Items {
+		if item.GetAnnotations()[schemaVersionAnnotation] == labelSchemaVersion {
+			continue
+		}
+		updated := false
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			updated = false
+			latest, err := teamspaces.Get(ctx, item.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if !migrateMetadata(latest) {
+				return nil
+			}
+			if _, err := teamspaces.Update(ctx, latest, metav1.UpdateOptions{}); err != nil {
+				return err
+			}
+			updated = true
+			return nil
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to migrate teamspace %s: %v", item.GetName(), err)
+		}
+		if !updated {
+			skipped++
+			continue
+		}
+		migrated++
+		slog.Info("Migrated teamspace labels", "teamspace", item.GetName(), "schema_version", labelSchemaVersion)
+	}
+
+	if migrated > 0 || skipped > 0 {
+		slog.Info("Finished label migration", "cluster", m.name, "migrated", migrated, "skipped", skipped)
+	}
+	return nil
+}
+
+// isTeamspaceNamespace reports whether the namespace backs a teamspace, in either schema
+func isTeamspaceNamespace(ns *corev1.Namespace) bool {
+	return metadataValue(ns.Labels, teamspaceLabel) == teamspaceLabelEnabled
+}
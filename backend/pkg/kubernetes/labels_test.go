@@ -0,0 +1,64 @@
+package kubernetes
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestMigrateMetadata(t *testing.T) {
+	obj := &metav1.ObjectMeta{
+		Labels: map[string]string{
+			"teamspace":                    "true",
+			"owner":                        "octocat",
+			"name":                         "demo",
+			"pod-security.kubernetes.io/x": "restricted",
+		},
+		Annotations: map[string]string{"release": "quay.io/release:4.19", "feature-set": ""},
+	}
+	if !migrateMetadata(obj) {
+		t.Fatalf("expected the legacy labels to be migrated")
+	}
+
+	for key, want := range map[string]string{teamspaceLabel: "true", ownerLabel: "octocat", nameLabel: "demo", "pod-security.kubernetes.io/x": "restricted"} {
+		if got := obj.Labels[key]; got != want {
+			t.Errorf("expected label %s=%q, got %q", key, want, got)
+		}
+	}
+	for _, legacy := range []string{"teamspace", "owner", "name"} {
+		if _, ok := obj.Labels[legacy]; ok {
+			t.Errorf("expected legacy label %s to be removed", legacy)
+		}
+	}
+	if obj.Annotations[releaseAnnotation] != "quay.io/release:4.19" || obj.Annotations[schemaVersionAnnotation] != labelSchemaVersion {
+		t.Errorf("unexpected annotations %v", obj.Annotations)
+	}
+
+	if migrateMetadata(obj) {
+		t.Errorf("expected a migrated object to be left alone")
+	}
+}
+
+func TestMetadataValueReadsBothSchemas(t *testing.T) {
+	if got := metadataValue(map[string]string{"owner": "octocat"}, ownerLabel); got != "octocat" {
+		t.Errorf("expected the legacy owner label to be read, got %q", got)
+	}
+	if got := metadataValue(map[string]string{"owner": "stale", ownerLabel: "octocat"}, ownerLabel); got != "octocat" {
+		t.Errorf("expected the prefixed owner label to win, got %q", got)
+	}
+}
+
+func TestUsernameHash(t *testing.T) {
+	for _, username := range []string{"octocat", "jane@example.com", "John_Doe", "Ünal Öztürk"} {
+		if errs := validation.IsValidLabelValue(usernameHash(username)); len(errs) > 0 {
+			t.Errorf("expected the hash of %q to be a valid label value: %v", username, errs)
+		}
+		if errs := validation.IsDNS1123Subdomain(ledgerName(username)); len(errs) > 0 {
+			t.Errorf("expected the ledger of %q to have a valid name: %v", username, errs)
+		}
+	}
+	if usernameHash("Octocat") != usernameHash("octocat") {
+		t.Errorf("expected usernames to be case insensitive")
+	}
+}
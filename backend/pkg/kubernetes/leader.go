@@ -0,0 +1,72 @@
+package kubernetes
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Timings of the leader election, the defaults of the Kubernetes controller manager
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// runAsLeader runs the function only while this replica holds the named Lease in the ledger
+// namespace of the default cluster, so that a single replica does the work. The function gets a
+// context that is cancelled when the lease is lost, after which the replica stands for election
+// again until ctx is cancelled.
+func (m *TeamspaceManager) runAsLeader(ctx context.Context, name string, run func(context.Context)) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "teamspace-app"
+	}
+	// The pod name is unique, the suffix also tells apart replicas run outside a cluster
+	identity := hostname + "_" + string(uuid.NewUUID())
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: m.config.Quotas.LedgerNamespace, Name: name},
+		Client:     m.defaultCluster().clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	// The election does not wait for the function, which may still be running after the lease is
+	// lost. It holds the mutex while it runs, so that terms never overlap and the function has
+	// returned once this does.
+	var running sync.Mutex
+	defer func() {
+		running.Lock()
+		running.Unlock()
+	}()
+	for ctx.Err() == nil {
+		leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					running.Lock()
+					defer running.Unlock()
+					// A term that starts late is already over
+					if ctx.Err() != nil {
+						return
+					}
+					slog.Info("Acquired lease", "lease", name, "identity", identity)
+					run(ctx)
+					slog.Info("Lost lease", "lease", name, "identity", identity)
+				},
+				OnStoppedLeading: func() {},
+			},
+		})
+	}
+}
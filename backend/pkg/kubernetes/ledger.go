@@ -0,0 +1,203 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/quota"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// quotaLedgerPrefix names the ConfigMap holding the reservations of an owner
+	quotaLedgerPrefix = "teamspace-quota-"
+	// quotaOwnerLabel marks quota ledgers with the hash of the owner they belong to, and
+	// quotaOwnerAnnotation with the owner
+	quotaOwnerLabel      = v1alpha1.GroupName + "/quota-owner"
+	quotaOwnerAnnotation = v1alpha1.GroupName + "/quota-owner"
+
+	// reservationGrace is how long a reservation counts against the quota. The caches observe a
+	// new or extended teamspace well within it, after which they are authoritative again.
+	reservationGrace = 5 * time.Minute
+)
+
+// ledgerBackoff allows for every replica, and every concurrent request of the owner, to race
+// for the ledger
+var ledgerBackoff = wait.Backoff{
+	Steps:    30,
+	Duration: 10 * time.Millisecond,
+	Factor:   1.5,
+	Jitter:   1,
+	Cap:      time.Second,
+}
+
+// reservation is what a teamspace counts against the quota of its owner
+type reservation struct {
+	// Name is the display name of the teamspace, unique among the teamspaces of the owner
+	Name       string    `json:"name,omitempty"`
+	Nodes      int       `json:"nodes"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	ReservedAt time.Time `json:"reservedAt"`
+}
+
+// usage returns the usage of the reserved teamspace at the given time
+func (r reservation) usage(now time.Time) quota.Usage {
+	usage := quota.Usage{Teamspaces: 1, Nodes: r.Nodes}
+	if r.ExpiresAt.After(now) {
+		usage.ClusterHours = r.ExpiresAt.Sub(now).Hours()
+	}
+	return usage
+}
+
+// quotaLedger admits teamspaces against the quota of their owner. The informer caches lag
+// behind writes and every replica has its own, so admissions are also recorded as
+// reservations in a ConfigMap per owner. Writes to it carry its resourceVersion, so concurrent
+// admissions for the same owner are serialized by the API server.
+type quotaLedger struct {
+	configMaps corev1client.ConfigMapsGetter
+	namespace  string
+}
+
+// ledgerName returns the name of the ConfigMap of the owner, from the hash of the username
+func ledgerName(owner string) string {
+	return quotaLedgerPrefix + usernameHash(owner)
+}
+
+// reserve records the reservation of the named teamspace if it fits in the limits, together with
+// the teamspaces observed in the cache and the reservations of the owner. Reserving an existing
+// teamspace, as extending it does, only checks the difference. observed is called on every
+// attempt, so each one sees the latest state of the cache.
+func (l *quotaLedger) reserve(ctx context.Context, owner, name string, r reservation, limits quota.Limits, observed func() (map[string]reservation, error)) error {
+	configMaps := l.configMaps.ConfigMaps(l.namespace)
+
+	// Errors about the quota are passed through unwrapped
+	var rejected error
+	err := retry.OnError(ledgerBackoff, isLedgerConflict, func() error {
+		cm, err := configMaps.Get(ctx, ledgerName(owner), metav1.GetOptions{})
+		exists := err == nil
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:        ledgerName(owner),
+				Namespace:   l.namespace,
+				Labels:      map[string]string{quotaOwnerLabel: usernameHash(owner)},
+				Annotations: map[string]string{quotaOwnerAnnotation: owner},
+			}}
+		} else if err != nil {
+			return err
+		}
+
+		teamspaces, err := observed()
+		if err != nil {
+			rejected = err
+			return rejected
+		}
+		pending := pendingReservations(cm, r.ReservedAt)
+		for key, value := range pending {
+			teamspaces[key] = value
+		}
+
+		var usage quota.Usage
+		for _, value := range teamspaces {
+			usage = usage.Add(value.usage(r.ReservedAt))
+		}
+		requested := r.usage(r.ReservedAt)
+		if previous, ok := teamspaces[name]; ok {
+			requested = requested.Sub(previous.usage(r.ReservedAt))
+		} else if r.Name != "" {
+			for key, value := range teamspaces {
+				if key != name && strings.EqualFold(value.Name, r.Name) {
+					rejected = fmt.Errorf("%w: %s already has a teamspace named %s", ErrTeamspaceExists, owner, r.Name)
+					return rejected
+				}
+			}
+		}
+		if err := limits.Check(usage, requested); err != nil {
+			rejected = err
+			return rejected
+		}
+
+		pending[name] = r
+		if cm.Data, err = encodeReservations(pending); err != nil {
+			rejected = err
+			return rejected
+		}
+		if exists {
+			_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		} else {
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+		}
+		return err
+	})
+	if rejected != nil {
+		return rejected
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reserve quota for teamspace %s: %v", name, err)
+	}
+	return nil
+}
+
+// release drops the reservation of the named teamspace, when creating it failed
+func (l *quotaLedger) release(ctx context.Context, owner, name string) error {
+	configMaps := l.configMaps.ConfigMaps(l.namespace)
+	err := retry.OnError(ledgerBackoff, isLedgerConflict, func() error {
+		cm, err := configMaps.Get(ctx, ledgerName(owner), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if _, ok := cm.Data[name]; !ok {
+			return nil
+		}
+		delete(cm.Data, name)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to release quota of teamspace %s: %v", name, err)
+	}
+	return nil
+}
+
+// pendingReservations decodes the reservations of the ledger still within their grace period.
+// The others are left out, so they are pruned on the next write.
+func pendingReservations(cm *corev1.ConfigMap, now time.Time) map[string]reservation {
+	pending := map[string]reservation{}
+	for key, value := range cm.Data {
+		var r reservation
+		if err := json.Unmarshal([]byte(value), &r); err != nil {
+			slog.Warn("Dropping malformed quota reservation", "ledger", cm.Name, "reservation", key, "error", err)
+			continue
+		}
+		if now.Sub(r.ReservedAt) < reservationGrace {
+			pending[key] = r
+		}
+	}
+	return pending
+}
+
+func encodeReservations(reservations map[string]reservation) (map[string]string, error) {
+	data := make(map[string]string, len(reservations))
+	for key, r := range reservations {
+		value, err := json.Marshal(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode reservation of %s: %v", key, err)
+		}
+		data[key] = string(value)
+	}
+	return data, nil
+}
+
+// isLedgerConflict reports whether another writer got to the ledger first
+func isLedgerConflict(err error) bool {
+	return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+}
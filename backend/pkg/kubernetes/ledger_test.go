@@ -0,0 +1,199 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/quota"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const ledgerNamespace = "teamspaces"
+
+var configMapResource = corev1.SchemeGroupVersion.WithResource("configmaps")
+
+// newLedgerClient returns a fake clientset that, like the API server, rejects ConfigMap updates
+// carrying a stale resourceVersion. The fake tracker alone accepts any update.
+func newLedgerClient() *fake.Clientset {
+	client := fake.NewClientset()
+	client.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		cm := action.(k8stesting.CreateAction).GetObject().(*corev1.ConfigMap)
+		cm.ResourceVersion = "1"
+		return false, nil, nil
+	})
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		cm := action.(k8stesting.UpdateAction).GetObject().(*corev1.ConfigMap)
+		current, err := client.Tracker().Get(configMapResource, cm.Namespace, cm.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		version := current.(*corev1.ConfigMap).ResourceVersion
+		if cm.ResourceVersion != version {
+			return true, nil, apierrors.NewConflict(configMapResource.GroupResource(), cm.Name, errors.New("the object has been modified"))
+		}
+		next, _ := strconv.Atoi(version)
+		cm.ResourceVersion = strconv.Itoa(next + 1)
+		return false, nil, nil
+	})
+	return client
+}
+
+func limit(n int) *int {
+	return &n
+}
+
+func noneObserved() (map[string]reservation, error) {
+	return map[string]reservation{}, nil
+}
+
+// reserveInParallel fires one reservation per name at the same time and returns how many were
+// admitted, failing the test on errors other than the quota being exceeded or the name taken
+func reserveInParallel(t *testing.T, ledger *quotaLedger, names []string, r reservation, limits quota.Limits, observed func() (map[string]reservation, error)) int {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(names))
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- ledger.reserve(context.Background(), "octocat", name, r, limits, observed)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	admitted := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			admitted++
+		case !errors.Is(err, quota.ErrExceeded) && !errors.Is(err, ErrTeamspaceExists):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	return admitted
+}
+
+func TestReserveHoldsLimitOnParallelCreates(t *testing.T) {
+	client := newLedgerClient()
+	ledger := &quotaLedger{configMaps: client.CoreV1(), namespace: ledgerNamespace}
+	now := time.Now()
+
+	var names []string
+	for i := 0; i < 20; i++ {
+		names = append(names, fmt.Sprintf("demo-%d", i))
+	}
+	r := reservation{Nodes: 2, ExpiresAt: now.Add(72 * time.Hour), ReservedAt: now}
+	admitted := reserveInParallel(t, ledger, names, r, quota.Limits{Teamspaces: limit(3)}, noneObserved)
+	if admitted != 3 {
+		t.Errorf("expected 3 teamspaces to be admitted, got %d", admitted)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(ledgerNamespace).Get(context.Background(), ledgerName("octocat"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get ledger: %v", err)
+	}
+	if len(cm.Data) != 3 {
+		t.Errorf("expected 3 reservations in the ledger, got %d", len(cm.Data))
+	}
+}
+
+func TestReserveHoldsNamesUniqueOnParallelCreates(t *testing.T) {
+	client := newLedgerClient()
+	ledger := &quotaLedger{configMaps: client.CoreV1(), namespace: ledgerNamespace}
+	now := time.Now()
+
+	var ids []string
+	for i := 0; i < 10; i++ {
+		ids = append(ids, teamspaceID("demo"))
+	}
+	r := reservation{Name: "demo", Nodes: 2, ExpiresAt: now.Add(72 * time.Hour), ReservedAt: now}
+	admitted := reserveInParallel(t, ledger, ids, r, quota.Limits{}, noneObserved)
+	if admitted != 1 {
+		t.Errorf("expected a single teamspace named demo to be admitted, got %d", admitted)
+	}
+}
+
+func TestReserveHoldsNodeLimitOnParallelCreates(t *testing.T) {
+	client := newLedgerClient()
+	ledger := &quotaLedger{configMaps: client.CoreV1(), namespace: ledgerNamespace}
+	now := time.Now()
+
+	// One teamspace of 2 nodes already exists, leaving room for two more
+	observed := func() (map[string]reservation, error) {
+		return map[string]reservation{
+			"existing": {Nodes: 2, ExpiresAt: now.Add(time.Hour), ReservedAt: now.Add(-time.Hour)},
+		}, nil
+	}
+	var names []string
+	for i := 0; i < 10; i++ {
+		names = append(names, fmt.Sprintf("demo-%d", i))
+	}
+	r := reservation{Nodes: 2, ExpiresAt: now.Add(time.Hour), ReservedAt: now}
+	admitted := reserveInParallel(t, ledger, names, r, quota.Limits{Nodes: limit(6)}, observed)
+	if admitted != 2 {
+		t.Errorf("expected 2 teamspaces to be admitted, got %d", admitted)
+	}
+}
+
+func TestReservePrunesExpiredReservations(t *testing.T) {
+	client := newLedgerClient()
+	ledger := &quotaLedger{configMaps: client.CoreV1(), namespace: ledgerNamespace}
+	ctx := context.Background()
+	limits := quota.Limits{Teamspaces: limit(1)}
+	then := time.Now().Add(-2 * reservationGrace)
+
+	// A reservation whose teamspace never showed up in the cache stops counting after the grace period
+	if err := ledger.reserve(ctx, "octocat", "abandoned", reservation{ReservedAt: then}, limits, noneObserved); err != nil {
+		t.Fatalf("failed to reserve: %v", err)
+	}
+	if err := ledger.reserve(ctx, "octocat", "demo", reservation{ReservedAt: time.Now()}, limits, noneObserved); err != nil {
+		t.Fatalf("expected the abandoned reservation to be pruned, got: %v", err)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps(ledgerNamespace).Get(ctx, ledgerName("octocat"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get ledger: %v", err)
+	}
+	if _, ok := cm.Data["abandoned"]; ok || len(cm.Data) != 1 {
+		t.Errorf("expected only the demo reservation in the ledger, got %v", cm.Data)
+	}
+}
+
+func TestReserveChecksOnlyTheExtension(t *testing.T) {
+	client := newLedgerClient()
+	ledger := &quotaLedger{configMaps: client.CoreV1(), namespace: ledgerNamespace}
+	ctx := context.Background()
+	now := time.Now()
+	limits := quota.Limits{Teamspaces: limit(1), ClusterHours: limit64(100)}
+	observed := func() (map[string]reservation, error) {
+		return map[string]reservation{
+			"demo": {Nodes: 2, ExpiresAt: now.Add(72 * time.Hour), ReservedAt: now.Add(-time.Hour)},
+		}, nil
+	}
+
+	// Extending does not count the teamspace again
+	extended := reservation{Nodes: 2, ExpiresAt: now.Add(96 * time.Hour), ReservedAt: now}
+	if err := ledger.reserve(ctx, "octocat", "demo", extended, limits, observed); err != nil {
+		t.Fatalf("failed to extend: %v", err)
+	}
+	extended.ExpiresAt = now.Add(120 * time.Hour)
+	if err := ledger.reserve(ctx, "octocat", "demo", extended, limits, observed); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("expected the cluster-hours limit to be exceeded, got: %v", err)
+	}
+}
+
+func limit64(n float64) *float64 {
+	return &n
+}
@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+)
+
+var (
+	teamspacesByPhaseDesc = prometheus.NewDesc("teamspace_teamspaces_by_phase",
+		"Teamspaces by phase.", []string{"phase"}, nil)
+	teamspacesByOwnerDesc = prometheus.NewDesc("teamspace_teamspaces_by_owner",
+		"Teamspaces by owner.", []string{"owner"}, nil)
+	teamspacesByReleaseDesc = prometheus.NewDesc("teamspace_teamspaces_by_release",
+		"Teamspaces by release image.", []string{"release"}, nil)
+	teamspacesByTemplateDesc = prometheus.NewDesc("teamspace_teamspaces_by_template",
+		"Teamspaces by template.", []string{"template"}, nil)
+	teamspacesByClusterDesc = prometheus.NewDesc("teamspace_teamspaces_by_cluster",
+		"Teamspaces by management cluster.", []string{"cluster"}, nil)
+)
+
+// phases are always reported, so alerts on a phase don't see a missing series when it is empty
+var phases = []v1alpha1.TeamspacePhase{
+	v1alpha1.PhasePending,
+	v1alpha1.PhaseProvisioning,
+	v1alpha1.PhaseReady,
+	v1alpha1.PhaseFailed,
+	v1alpha1.PhaseDeleting,
+	v1alpha1.PhaseHibernated,
+}
+
+// TeamspaceCollector reports gauges of the teamspaces in the cache on every scrape, so they
+// can never drift from the cluster
+type TeamspaceCollector struct {
+	manager *TeamspaceManager
+}
+
+// NewTeamspaceCollector returns a collector of the teamspaces of the manager
+func NewTeamspaceCollector(manager *TeamspaceManager) *TeamspaceCollector {
+	return &TeamspaceCollector{manager: manager}
+}
+
+// Describe implements prometheus.Collector
+func (c *TeamspaceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- teamspacesByPhaseDesc
+	ch <- teamspacesByOwnerDesc
+	ch <- teamspacesByReleaseDesc
+	ch <- teamspacesByTemplateDesc
+	ch <- teamspacesByClusterDesc
+}
+
+// Collect implements prometheus.Collector. Nothing is reported until the cache has synced.
+func (c *TeamspaceCollector) Collect(ch chan<- prometheus.Metric) {
+	teamspaces, err := c.manager.ListTeamspaces()
+	if err != nil {
+		slog.Warn("Failed to list teamspaces for metrics", "error", err)
+		return
+	}
+	counts := countTeamspaces(teamspaces)
+	for _, phase := range phases {
+		ch <- prometheus.MustNewConstMetric(teamspacesByPhaseDesc, prometheus.GaugeValue, counts.phases[phase], string(phase))
+	}
+	for owner, count := range counts.owners {
+		ch <- prometheus.MustNewConstMetric(teamspacesByOwnerDesc, prometheus.GaugeValue, count, owner)
+	}
+	for release, count := range counts.releases {
+		ch <- prometheus.MustNewConstMetric(teamspacesByReleaseDesc, prometheus.GaugeValue, count, release)
+	}
+	for template, count := range counts.templates {
+		ch <- prometheus.MustNewConstMetric(teamspacesByTemplateDesc, prometheus.GaugeValue, count, template)
+	}
+	// Every cluster is reported, like phases, so an empty cluster has a series
+	for _, cluster := range c.manager.ListClusters() {
+		ch <- prometheus.MustNewConstMetric(teamspacesByClusterDesc, prometheus.GaugeValue, counts.clusters[cluster.Name], cluster.Name)
+	}
+}
+
+type teamspaceCounts struct {
+	phases    map[v1alpha1.TeamspacePhase]float64
+	owners    map[string]float64
+	releases  map[string]float64
+	templates map[string]float64
+	clusters  map[string]float64
+}
+
+// countTeamspaces tallies the teamspaces along each dimension. Teamspaces the controller has
+// not seen yet count as pending, and teamspaces created without a template as "none".
+func countTeamspaces(teamspaces []*Teamspace) teamspaceCounts {
+	counts := teamspaceCounts{
+		phases:    map[v1alpha1.TeamspacePhase]float64{},
+		owners:    map[string]float64{},
+		releases:  map[string]float64{},
+		templates: map[string]float64{},
+		clusters:  map[string]float64{},
+	}
+	for _, teamspace := range teamspaces {
+		phase := teamspace.Phase
+		if phase == "" {
+			phase = v1alpha1.PhasePending
+		}
+		counts.phases[phase]++
+		counts.owners[teamspace.Owner]++
+		counts.releases[teamspace.Release]++
+		template := teamspace.Template
+		if template == "" {
+			template = "none"
+		}
+		counts.templates[template]++
+		counts.clusters[teamspace.Cluster]++
+	}
+	return counts
+}
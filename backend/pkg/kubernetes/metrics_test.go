@@ -0,0 +1,88 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCountTeamspaces(t *testing.T) {
+	counts := countTeamspaces([]*Teamspace{
+		{Owner: "octocat", Phase: v1alpha1.PhaseReady, Release: "4.19", Template: "small", Cluster: "east"},
+		{Owner: "octocat", Phase: "", Release: "4.19", Cluster: "east"},
+		{Owner: "hubot", Phase: v1alpha1.PhaseFailed, Release: "4.18", Template: "small", Cluster: "west"},
+	})
+
+	if counts.phases[v1alpha1.PhaseReady] != 1 || counts.phases[v1alpha1.PhasePending] != 1 || counts.phases[v1alpha1.PhaseFailed] != 1 {
+		t.Errorf("expected a ready, a pending and a failed teamspace, got %v", counts.phases)
+	}
+	if counts.owners["octocat"] != 2 || counts.owners["hubot"] != 1 {
+		t.Errorf("expected 2 teamspaces of octocat and 1 of hubot, got %v", counts.owners)
+	}
+	if counts.releases["4.19"] != 2 || counts.releases["4.18"] != 1 {
+		t.Errorf("expected 2 teamspaces on 4.19 and 1 on 4.18, got %v", counts.releases)
+	}
+	if counts.templates["small"] != 2 || counts.templates["none"] != 1 {
+		t.Errorf("expected 2 small teamspaces and 1 without a template, got %v", counts.templates)
+	}
+	if counts.clusters["east"] != 2 || counts.clusters["west"] != 1 {
+		t.Errorf("expected 2 teamspaces in east and 1 in west, got %v", counts.clusters)
+	}
+}
+
+func TestMarkProvisioned(t *testing.T) {
+	tests := []struct {
+		name      string
+		previous  v1alpha1.TeamspacePhase
+		phase     v1alpha1.TeamspacePhase
+		marked    bool
+		firstTime bool
+	}{
+		{name: "still provisioning", previous: v1alpha1.PhaseProvisioning, phase: v1alpha1.PhaseProvisioning},
+		{name: "became ready", previous: v1alpha1.PhaseProvisioning, phase: v1alpha1.PhaseReady, marked: true, firstTime: true},
+		{name: "ready after a failure", previous: v1alpha1.PhaseFailed, phase: v1alpha1.PhaseReady, marked: true, firstTime: true},
+		{name: "ready before the field existed", previous: v1alpha1.PhaseReady, phase: v1alpha1.PhaseReady, marked: true},
+		{name: "hibernated before the field existed", previous: v1alpha1.PhaseHibernated, phase: v1alpha1.PhaseProvisioning, marked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := &v1alpha1.Teamspace{Status: v1alpha1.TeamspaceStatus{Phase: tt.previous}}
+			status := ts.Status.DeepCopy()
+			status.Phase = tt.phase
+
+			firstTime := markProvisioned(ts, status)
+			if firstTime != tt.firstTime {
+				t.Errorf("expected newly provisioned to be %v, got %v", tt.firstTime, firstTime)
+			}
+			if (status.ProvisionedAt != nil) != tt.marked {
+				t.Errorf("expected provisionedAt to be set: %v, got %v", tt.marked, status.ProvisionedAt)
+			}
+
+			// Once recorded, the time never changes
+			if tt.marked {
+				provisionedAt := *status.ProvisionedAt
+				ts.Status = *status
+				status = ts.Status.DeepCopy()
+				if markProvisioned(ts, status) || !status.ProvisionedAt.Equal(&provisionedAt) {
+					t.Errorf("expected the provisioning time to be kept, got %v", status.ProvisionedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	status := &v1alpha1.TeamspaceStatus{}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: v1alpha1.ConditionNamespaceReady, Status: metav1.ConditionTrue, Reason: "NamespaceActive"})
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: v1alpha1.ConditionHostedClusterReady, Status: metav1.ConditionFalse, Reason: "HostedClusterFailed"})
+	if reason := failureReason(status); reason != "HostedClusterFailed" {
+		t.Errorf("expected the HostedCluster to have failed, got %s", reason)
+	}
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{Type: v1alpha1.ConditionNamespaceReady, Status: metav1.ConditionFalse, Reason: "GuardrailsFailed"})
+	if reason := failureReason(status); reason != "GuardrailsFailed" {
+		t.Errorf("expected the namespace step to be reported first, got %s", reason)
+	}
+}
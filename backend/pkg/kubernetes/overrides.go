@@ -0,0 +1,178 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/teamspace-app/backend/pkg/config"
+	"github.com/teamspace-app/backend/pkg/quota"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// quotaOverridesName names the ConfigMap holding the quota overrides set by admins. Quota
+// ledgers are named by a hex hash, so it never collides with one.
+const quotaOverridesName = "teamspace-quota.overrides"
+
+// QuotaOverride replaces limits of a user set in the config, as set through the admin API.
+// A limit left unset keeps its configured value; a negative limit means unlimited.
+type QuotaOverride struct {
+	Username     string   `json:"username"`
+	Teamspaces   *int     `json:"teamspaces,omitempty"`
+	Nodes        *int     `json:"nodes,omitempty"`
+	ClusterHours *float64 `json:"clusterHours,omitempty"`
+}
+
+// QuotaOverrides lists the quota overrides set by admins, by username
+func (m *TeamspaceManager) QuotaOverrides() ([]QuotaOverride, error) {
+	overrides, err := m.quotaOverrides()
+	if err != nil {
+		return nil, err
+	}
+	list := []QuotaOverride{}
+	for _, override := range overrides {
+		list = append(list, override)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Username < list[j].Username
+	})
+	return list, nil
+}
+
+// SetQuotaOverride sets the quota override of a user, replacing any previous one
+func (m *TeamspaceManager) SetQuotaOverride(override QuotaOverride) error {
+	value, err := json.Marshal(override)
+	if err != nil {
+		return fmt.Errorf("failed to encode quota override: %v", err)
+	}
+
+	err = m.updateQuotaOverrides(func(data map[string]string) {
+		// Replaces an override keyed by the username, from before usernames were hashed
+		delete(data, strings.ToLower(override.Username))
+		data[usernameHash(override.Username)] = string(value)
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Quota override set", "username", override.Username, "override", string(value))
+	return nil
+}
+
+// RemoveQuotaOverride drops the quota override of a user, who is held to the config again
+func (m *TeamspaceManager) RemoveQuotaOverride(username string) error {
+	err := m.updateQuotaOverrides(func(data map[string]string) {
+		delete(data, strings.ToLower(username))
+		delete(data, usernameHash(username))
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Quota override removed", "username", username)
+	return nil
+}
+
+// updateQuotaOverrides applies a change to the overrides ConfigMap of the default cluster,
+// creating it when missing
+func (m *TeamspaceManager) updateQuotaOverrides(mutate func(map[string]string)) error {
+	ctx := context.TODO()
+	configMaps := m.defaultCluster().clientset.CoreV1().ConfigMaps(m.config.Quotas.LedgerNamespace)
+
+	err := retry.OnError(retry.DefaultRetry, isLedgerConflict, func() error {
+		cm, err := configMaps.Get(ctx, quotaOverridesName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      quotaOverridesName,
+				Namespace: m.config.Quotas.LedgerNamespace,
+			}}
+			cm.Data = map[string]string{}
+			mutate(cm.Data)
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		mutate(cm.Data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update quota overrides: %v", err)
+	}
+	return nil
+}
+
+// quotaOverrides reads the quota overrides from the cache, keyed by lowercased username. They
+// are stored under the hash of the username, which is valid as a key whatever the provider,
+// or under the lowercased username when set before usernames were hashed.
+func (m *TeamspaceManager) quotaOverrides() (map[string]QuotaOverride, error) {
+	if !m.HasSynced() {
+		return nil, ErrCacheNotSynced
+	}
+	cm, err := m.defaultCluster().cache.quotaOverrides.Get(quotaOverridesName)
+	if apierrors.IsNotFound(err) {
+		return map[string]QuotaOverride{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quota overrides: %v", err)
+	}
+
+	overrides := map[string]QuotaOverride{}
+	for key, value := range cm.Data {
+		var override QuotaOverride
+		if err := json.Unmarshal([]byte(value), &override); err != nil {
+			slog.Warn("Ignoring malformed quota override", "username", key, "error", err)
+			continue
+		}
+		if override.Username == "" {
+			override.Username = key
+		}
+		overrides[strings.ToLower(override.Username)] = override
+	}
+	return overrides, nil
+}
+
+// quotaLimits resolves the limits of a user from the config, with the override of the user
+// applied over their configured limits
+func (m *TeamspaceManager) quotaLimits(username string, teams []string) (quota.Limits, error) {
+	overrides, err := m.quotaOverrides()
+	if err != nil {
+		return quota.Limits{}, err
+	}
+	override, ok := overrides[strings.ToLower(username)]
+	if !ok {
+		return quota.For(m.config.Quotas, username, teams), nil
+	}
+
+	// Replace the configured entry of the user, whatever the case of its key
+	cfg := m.config.Quotas
+	cfg.Users = map[string]config.QuotaLimits{}
+	var limits config.QuotaLimits
+	for name, configured := range m.config.Quotas.Users {
+		if strings.EqualFold(name, username) {
+			limits = configured
+			continue
+		}
+		cfg.Users[name] = configured
+	}
+	if override.Teamspaces != nil {
+		limits.Teamspaces = override.Teamspaces
+	}
+	if override.Nodes != nil {
+		limits.Nodes = override.Nodes
+	}
+	if override.ClusterHours != nil {
+		limits.ClusterHours = override.ClusterHours
+	}
+	cfg.Users[username] = limits
+	return quota.For(cfg, username, teams), nil
+}
@@ -0,0 +1,76 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/placement"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// placeTeamspace picks the cluster of a new teamspace of the given size, or checks the named
+// one, and returns the decision to record on the teamspace. What each cluster hosts is read
+// from the cache, so concurrent creates may overshoot the capacity of a cluster by a few
+// teamspaces.
+func (m *TeamspaceManager) placeTeamspace(clusterName string, region string, teams []string, nodes int) (*managementCluster, *v1alpha1.Placement, error) {
+	var clusters []placement.Cluster
+	for _, cluster := range m.clusters {
+		candidate, err := m.placementCandidate(cluster)
+		if err != nil {
+			return nil, nil, err
+		}
+		clusters = append(clusters, candidate)
+	}
+
+	decision, err := placement.Place(clusters, placement.Request{
+		Cluster: clusterName,
+		Region:  region,
+		Teams:   teams,
+		Nodes:   nodes,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	cluster, err := m.resolveCluster(decision.Cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	placed := &v1alpha1.Placement{
+		Reason:    decision.Reason,
+		Region:    region,
+		DecidedAt: metav1.Now(),
+	}
+	for _, candidate := range decision.Candidates {
+		placed.Candidates = append(placed.Candidates, v1alpha1.PlacementCandidate{
+			Cluster:  candidate.Cluster,
+			Eligible: candidate.Eligible,
+			Score:    candidate.Score,
+			Reason:   candidate.Reason,
+		})
+	}
+	return cluster, placed, nil
+}
+
+// placementCandidate describes the cluster to the placement engine, with the teamspaces it
+// hosts and the nodes of their NodePools
+func (m *TeamspaceManager) placementCandidate(cluster *managementCluster) (placement.Cluster, error) {
+	teamspaces, err := cachedTeamspaces(cluster.cache.teamspaces.GetIndexer().List())
+	if err != nil {
+		return placement.Cluster{}, fmt.Errorf("failed to list teamspaces of cluster %s: %v", cluster.name, err)
+	}
+
+	candidate := placement.Cluster{
+		Name:          cluster.name,
+		Region:        cluster.config.Region,
+		Teamspaces:    len(teamspaces),
+		MaxTeamspaces: cluster.config.MaxTeamspaces,
+		MaxNodes:      cluster.config.MaxNodes,
+		AllowedTeams:  cluster.config.AllowedTeams,
+		DeniedTeams:   cluster.config.DeniedTeams,
+	}
+	for _, ts := range teamspaces {
+		candidate.Nodes += m.teamspaceNodes(cluster, ts)
+	}
+	return candidate, nil
+}
@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+	"github.com/teamspace-app/backend/pkg/quota"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// QuotaStatus returns the limits of the user and what their teamspaces use of them
+func (m *TeamspaceManager) QuotaStatus(username string, teams []string) (quota.Status, error) {
+	usage, err := m.quotaUsage(username, time.Now())
+	if err != nil {
+		return quota.Status{}, err
+	}
+	limits, err := m.quotaLimits(username, teams)
+	if err != nil {
+		return quota.Status{}, err
+	}
+	return limits.Status(usage), nil
+}
+
+// quotaUsage adds up what the teamspaces of the owner count against their quota
+func (m *TeamspaceManager) quotaUsage(owner string, now time.Time) (quota.Usage, error) {
+	teamspaces, err := m.observedReservations(owner)
+	if err != nil {
+		return quota.Usage{}, err
+	}
+	var usage quota.Usage
+	for _, r := range teamspaces {
+		usage = usage.Add(r.usage(now))
+	}
+	return usage, nil
+}
+
+// observedReservations returns what each cached teamspace of the owner, in any cluster, counts
+// against their quota. Teamspaces count until they are gone, including while hibernated or
+// being deleted.
+func (m *TeamspaceManager) observedReservations(owner string) (map[string]reservation, error) {
+	if !m.HasSynced() {
+		return nil, ErrCacheNotSynced
+	}
+	reservations := map[string]reservation{}
+	for _, cluster := range m.clusters {
+		objs, err := cluster.cache.teamspaces.GetIndexer().ByIndex(ownerIndex, strings.ToLower(owner))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list teamspaces: %v", err)
+		}
+		teamspaces, err := cachedTeamspaces(objs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ts := range teamspaces {
+			r := reservation{
+				Name:       displayName(ts),
+				Nodes:      m.teamspaceNodes(cluster, ts),
+				ReservedAt: ts.CreationTimestamp.Time,
+			}
+			if ts.Spec.ExpiresAt != nil {
+				r.ExpiresAt = ts.Spec.ExpiresAt.Time
+			}
+			reservations[ts.Name] = r
+		}
+	}
+	return reservations, nil
+}
+
+// limitsOf returns the limits of the owner of a teamspace. The teams of a user are only known
+// from their own session, so when someone else acts on the teamspace the owner is held to
+// their user or default limits.
+func (m *TeamspaceManager) limitsOf(owner string, username string, teams []string) (quota.Limits, error) {
+	if !strings.EqualFold(owner, username) {
+		teams = nil
+	}
+	return m.quotaLimits(owner, teams)
+}
+
+// teamspaceNodes returns the nodes the teamspace counts against quota and capacity: the
+// replicas of its NodePool, or the maximum when it autoscales. A hibernated teamspace counts the
+// nodes it is resumed with, and one whose NodePool does not exist yet the size of its template.
+func (m *TeamspaceManager) teamspaceNodes(cluster *managementCluster, ts *v1alpha1.Teamspace) int {
+	namespace := toTeamspace(ts, cluster.name).Namespace
+	if ns, _ := cluster.cachedNamespace(namespace); ns != nil {
+		replicas := replicaAnnotation(ns, nodePoolReplicasAnnotation)
+		autoScaling := autoScalingAnnotation(ns)
+		if len(replicas) > 0 || len(autoScaling) > 0 {
+			nodes := 0
+			for _, count := range replicas {
+				nodes += int(count)
+			}
+			for _, bounds := range autoScaling {
+				nodes += int(bounds.Max)
+			}
+			return nodes
+		}
+	}
+
+	np, err := cluster.cachedNodePool(namespace)
+	if err != nil || np == nil {
+		return m.nodePoolReplicas(m.templateOf(ts))
+	}
+	if bounds := autoScalingOf(np); bounds != nil {
+		return int(bounds.Max)
+	}
+	replicas, _, _ := unstructured.NestedInt64(np.Object, "spec", "replicas")
+	return int(replicas)
+}
+
+// nodePoolReplicas returns the size of the NodePool of teamspaces created from the template
+func (m *TeamspaceManager) nodePoolReplicas(template *config.TemplateConfig) int {
+	if template != nil && template.NodePoolReplicas > 0 {
+		return template.NodePoolReplicas
+	}
+	return m.config.HyperShift.NodePoolReplicas
+}
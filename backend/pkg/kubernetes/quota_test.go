@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestQuotaUsageCountsTheNodePoolReplicas(t *testing.T) {
+	appConfig := config.Default()
+	appConfig.HyperShift.NodePoolReplicas = 2
+	m := newFakeManager(t, appConfig)
+	cluster := m.defaultCluster()
+
+	teamspace, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := func() int {
+		err := wait.PollUntilContextTimeout(t.Context(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+			usage, err := m.quotaUsage("alice", time.Now())
+			return err == nil && usage.Teamspaces == 1, nil
+		})
+		if err != nil {
+			t.Fatalf("the cache did not observe the teamspace: %v", err)
+		}
+		usage, _ := m.quotaUsage("alice", time.Now())
+		return usage.Nodes
+	}
+	if got := nodes(); got != 2 {
+		t.Errorf("expected the size of the template before the NodePool exists, got %d", got)
+	}
+
+	// The NodePool was scaled by hand
+	np := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "hypershift.openshift.io/v1beta1",
+		"kind":       "NodePool",
+		"metadata":   map[string]interface{}{"name": hostedClusterName, "namespace": teamspace.Namespace},
+		"spec":       map[string]interface{}{"replicas": int64(5)},
+	}}
+	if _, err := cluster.dynamic.Resource(nodePoolResource).Namespace(teamspace.Namespace).Create(t.Context(), np, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollUntilContextTimeout(t.Context(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		np, err := cluster.cachedNodePool(teamspace.Namespace)
+		return np != nil, err
+	})
+	if err != nil {
+		t.Fatalf("the cache did not observe the NodePool: %v", err)
+	}
+	if got := nodes(); got != 5 {
+		t.Errorf("expected the replicas of the NodePool, got %d", got)
+	}
+}
+
+func TestQuotaOverridesAreServedFromTheCache(t *testing.T) {
+	m := newFakeManager(t, config.Default())
+
+	if err := m.SetQuotaOverride(QuotaOverride{Username: "alice", Teamspaces: limit(5)}); err != nil {
+		t.Fatal(err)
+	}
+	err := wait.PollUntilContextTimeout(t.Context(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		limits, err := m.quotaLimits("alice", nil)
+		return err == nil && limits.Teamspaces != nil && *limits.Teamspaces == 5, err
+	})
+	if err != nil {
+		t.Fatalf("the override was not applied: %v", err)
+	}
+
+	clientset := m.defaultCluster().clientset.(*fake.Clientset)
+	clientset.ClearActions()
+	if _, err := m.QuotaStatus("alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == "configmaps" && action.GetVerb() == "get" {
+			t.Errorf("expected the overrides to be read from the cache, got a %s of %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
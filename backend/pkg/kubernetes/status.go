@@ -0,0 +1,166 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Condition is a single observation about a teamspace, as returned by the API
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// GetTeamspace returns a teamspace with its phase and conditions computed from the live state
+// of its namespace, its HostedCluster and its kubeconfig secret. The teamspace is looked up in the
+// named cluster or, when empty, in every cluster.
+func (m *TeamspaceManager) GetTeamspace(name string, clusterName string) (*Teamspace, error) {
+	ctx := context.TODO()
+
+	ts, cluster, err := m.getTeamspace(name, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	teamspace := toTeamspace(ts, cluster.name)
+
+	ns, err := cluster.cachedNamespace(teamspace.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace: %v", err)
+	}
+
+	var hc *unstructured.Unstructured
+	hasKubeconfig := false
+	if ns != nil {
+		hc, err = cluster.cachedHostedCluster(ctx, ns.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get HostedCluster: %v", err)
+		}
+		hasKubeconfig = cluster.hasCachedSecret(ns.Name, kubeconfigSecretName(ts.Name))
+	}
+
+	teamspace.Phase, teamspace.LastError = computePhase(ts, ns, hc, hasKubeconfig)
+	teamspace.Conditions = computeConditions(ts, ns, hc, hasKubeconfig)
+	if hc != nil {
+		teamspace.APIServerURL = hostedClusterAPIServerURL(hc)
+		teamspace.ConsoleURL = hostedClusterConsoleURL(hc)
+	}
+
+	return teamspace, nil
+}
+
+// summarizePhase returns the phase recorded by the controller, for use in listings
+func summarizePhase(ts *v1alpha1.Teamspace) v1alpha1.TeamspacePhase {
+	if ts.DeletionTimestamp != nil {
+		return v1alpha1.PhaseDeleting
+	}
+	if ts.Status.Phase == "" {
+		return v1alpha1.PhasePending
+	}
+	return ts.Status.Phase
+}
+
+// computePhase derives the phase and the last error from the objects backing the teamspace
+func computePhase(ts *v1alpha1.Teamspace, ns *corev1.Namespace, hc *unstructured.Unstructured, hasKubeconfig bool) (v1alpha1.TeamspacePhase, string) {
+	switch {
+	case ts.DeletionTimestamp != nil || (ns != nil && ns.DeletionTimestamp != nil):
+		return v1alpha1.PhaseDeleting, ""
+	case isHibernated(ns):
+		return v1alpha1.PhaseHibernated, ""
+	case hc != nil && hostedClusterFailure(hc) != "":
+		return v1alpha1.PhaseFailed, hostedClusterFailure(hc)
+	case ts.Status.Phase == v1alpha1.PhaseFailed:
+		return v1alpha1.PhaseFailed, ts.Status.LastError
+	case ns == nil:
+		return v1alpha1.PhasePending, ""
+	case hc == nil:
+		return v1alpha1.PhaseProvisioning, ""
+	}
+
+	if available, _ := hostedClusterAvailable(hc); available && hasKubeconfig {
+		return v1alpha1.PhaseReady, ""
+	}
+	return v1alpha1.PhaseProvisioning, ""
+}
+
+// computeConditions reports the live readiness of each part of the teamspace, followed by any
+// other condition recorded by the controller
+func computeConditions(ts *v1alpha1.Teamspace, ns *corev1.Namespace, hc *unstructured.Unstructured, hasKubeconfig bool) []Condition {
+	recorded := map[string]metav1.Condition{}
+	for _, condition := range ts.Status.Conditions {
+		recorded[condition.Type] = condition
+	}
+
+	live := func(conditionType string, ok bool, reason, message string) Condition {
+		condition := Condition{
+			Type:    conditionType,
+			Status:  string(metav1.ConditionFalse),
+			Reason:  reason,
+			Message: message,
+		}
+		if ok {
+			condition.Status = string(metav1.ConditionTrue)
+		}
+		// Keep the transition time recorded by the controller when it agrees with what we observe
+		if previous, found := recorded[conditionType]; found && string(previous.Status) == condition.Status {
+			condition.LastTransitionTime = previous.LastTransitionTime.Time
+		}
+		return condition
+	}
+
+	var conditions []Condition
+
+	switch {
+	case ns == nil:
+		conditions = append(conditions, live(v1alpha1.ConditionNamespaceReady, false, "NamespaceNotFound", "The namespace has not been created yet"))
+	case ns.DeletionTimestamp != nil:
+		conditions = append(conditions, live(v1alpha1.ConditionNamespaceReady, false, "NamespaceTerminating", "The namespace is being deleted"))
+	default:
+		conditions = append(conditions, live(v1alpha1.ConditionNamespaceReady, true, "NamespaceActive", ""))
+	}
+
+	if isHibernated(ns) {
+		conditions = append(conditions, live(v1alpha1.ConditionHostedClusterReady, false, "Hibernated", "The hosted cluster is hibernated"))
+	} else if hc == nil {
+		conditions = append(conditions, live(v1alpha1.ConditionHostedClusterReady, false, "HostedClusterNotFound", "The HostedCluster has not been created yet"))
+	} else if failure := hostedClusterFailure(hc); failure != "" {
+		conditions = append(conditions, live(v1alpha1.ConditionHostedClusterReady, false, "HostedClusterFailed", failure))
+	} else if available, message := hostedClusterAvailable(hc); available {
+		conditions = append(conditions, live(v1alpha1.ConditionHostedClusterReady, true, "HostedClusterAvailable", message))
+	} else {
+		conditions = append(conditions, live(v1alpha1.ConditionHostedClusterReady, false, "HostedClusterProvisioning", message))
+	}
+
+	if hasKubeconfig {
+		conditions = append(conditions, live(v1alpha1.ConditionKubeconfigReady, true, "KubeconfigPublished", ""))
+	} else {
+		conditions = append(conditions, live(v1alpha1.ConditionKubeconfigReady, false, "KubeconfigNotFound", "The admin kubeconfig has not been published yet"))
+	}
+
+	computed := map[string]bool{}
+	for _, condition := range conditions {
+		computed[condition.Type] = true
+	}
+	for _, condition := range ts.Status.Conditions {
+		if computed[condition.Type] {
+			continue
+		}
+		conditions = append(conditions, Condition{
+			Type:               condition.Type,
+			Status:             string(condition.Status),
+			Reason:             condition.Reason,
+			Message:            condition.Message,
+			LastTransitionTime: condition.LastTransitionTime.Time,
+		})
+	}
+
+	return conditions
+}
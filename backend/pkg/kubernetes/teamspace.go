@@ -2,154 +2,464 @@ package kubernetes
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
+const (
+	teamspaceFinalizer = v1alpha1.GroupName + "/finalizer"
+	// forceDeleteAnnotation tells the controller not to wait for the HostedCluster on deletion
+	forceDeleteAnnotation = v1alpha1.GroupName + "/force-delete"
+)
+
+// ErrTeamspaceNotFound is returned when the requested teamspace does not exist
+var ErrTeamspaceNotFound = errors.New("teamspace not found")
+
+// ErrTeamspaceExists is returned when the owner already has a teamspace with the requested name
+var ErrTeamspaceExists = errors.New("teamspace already exists")
+
+// ErrAmbiguousTeamspace is returned when teamspaces with the same ID exist in several clusters
+var ErrAmbiguousTeamspace = errors.New("teamspace is ambiguous")
+
+// ErrInvalidName is returned when a teamspace name cannot be used in Kubernetes object names
+var ErrInvalidName = errors.New("invalid teamspace name")
+
+// maxNameLength keeps the namespace of a teamspace, teamspace-<name>-<suffix>, within the
+// 63 characters allowed for namespace names
+const maxNameLength = 63 - len("teamspace-") - 1 - idSuffixLength
+
+// idSuffixLength is the number of hex digits of the random suffix of teamspace IDs
+const idSuffixLength = 8
+
 type Teamspace struct {
+	// ID identifies the teamspace in the API; it never changes once the teamspace is created
+	ID string `json:"id"`
+	// Name is the name the owner gave the teamspace, unique among their teamspaces
 	Name              string     `json:"name"`
+	Cluster           string     `json:"cluster"`
 	Namespace         string     `json:"namespace"`
 	CreatedAt         time.Time  `json:"createdAt"`
 	Owner             string     `json:"owner"`
 	DeletionTimestamp *time.Time `json:"deletionTimestamp,omitempty"`
+	ExpiresAt         *time.Time `json:"expiresAt,omitempty"`
+
+	Phase      v1alpha1.TeamspacePhase `json:"phase"`
+	Release    string                  `json:"release,omitempty"`
+	FeatureSet string                  `json:"featureSet,omitempty"`
+	Template   string                  `json:"template,omitempty"`
+	LastError  string                  `json:"lastError,omitempty"`
+	// Placement explains why the teamspace was created in its cluster
+	Placement string `json:"placement,omitempty"`
+
+	Collaborators []Collaborator `json:"collaborators,omitempty"`
+	// PendingTransfer is set while the teamspace waits for a new owner to accept it
+	PendingTransfer *PendingTransfer `json:"pendingTransfer,omitempty"`
+	// Role is the access the caller has to the teamspace
+	Role Role `json:"role,omitempty"`
+
+	// Only populated by GetTeamspace
+	APIServerURL string      `json:"apiServerURL,omitempty"`
+	ConsoleURL   string      `json:"consoleURL,omitempty"`
+	Conditions   []Condition `json:"conditions,omitempty"`
 }
 
 type TeamspaceManager struct {
-	clientset *kubernetes.Clientset
+	config *config.Config
+	// clusters are the management clusters, the default first
+	clusters []*managementCluster
+	ledger   *quotaLedger
+	// watchers relays the changes seen by the Teamspace informers to the watches of the clients
+	watchers *teamspaceBroadcaster
+}
+
+// NewTeamspaceManager connects to every management cluster of the config
+func NewTeamspaceManager(appConfig *config.Config) (*TeamspaceManager, error) {
+	var clients []Clients
+	for _, cfg := range appConfig.Clusters {
+		c, err := NewClients(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %v", cfg.Name, err)
+		}
+		clients = append(clients, c)
+	}
+	return NewTeamspaceManagerForClients(appConfig, clients)
+}
+
+// NewTeamspaceManagerForClients creates a manager working through the given clients, one per
+// cluster of the config and in the same order, such as the fake clients of tests
+func NewTeamspaceManagerForClients(appConfig *config.Config, clients []Clients) (*TeamspaceManager, error) {
+	if len(appConfig.Clusters) == 0 {
+		return nil, fmt.Errorf("no management cluster configured")
+	}
+	if len(clients) != len(appConfig.Clusters) {
+		return nil, fmt.Errorf("got clients for %d clusters, %d are configured", len(clients), len(appConfig.Clusters))
+	}
+
+	m := &TeamspaceManager{config: appConfig, watchers: newTeamspaceBroadcaster()}
+	for i, cfg := range appConfig.Clusters {
+		cluster := newManagementCluster(cfg, clients[i])
+		if _, err := cluster.cache.teamspaces.AddEventHandler(m.watchers.handler(cluster.name)); err != nil {
+			return nil, fmt.Errorf("cluster %s: %v", cfg.Name, err)
+		}
+		m.clusters = append(m.clusters, cluster)
+	}
+
+	// Quotas span every cluster, so they are kept in the default one
+	m.ledger = &quotaLedger{configMaps: m.defaultCluster().clientset.CoreV1(), namespace: appConfig.Quotas.LedgerNamespace}
+	m.defaultCluster().watchQuotaOverrides(appConfig.Quotas.LedgerNamespace)
+	return m, nil
+}
+
+// EventsClient returns the client of the default management cluster for Events, which the audit
+// log can write to
+func (m *TeamspaceManager) EventsClient() typedcorev1.EventsGetter {
+	return m.defaultCluster().clientset.CoreV1()
+}
+
+// Ping checks that the API server of every management cluster answers
+func (m *TeamspaceManager) Ping(ctx context.Context) error {
+	for _, cluster := range m.clusters {
+		if err := cluster.clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+			return fmt.Errorf("cluster %s: %v", cluster.name, err)
+		}
+	}
+	return nil
+}
+
+// teamspaceID returns the ID of a new teamspace, which is also the name of its Teamspace object.
+// The random suffix keeps teamspaces with the same name apart, whoever owns them now or later.
+// Teamspaces created before IDs had a suffix keep their name as their ID.
+func teamspaceID(name string) string {
+	suffix := make([]byte, idSuffixLength/2)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", name, hex.EncodeToString(suffix))
 }
 
-func NewTeamspaceManager() (*TeamspaceManager, error) {
-	var config *rest.Config
-	var err error
+// validateName checks that a teamspace name can be used in the names of its objects
+func validateName(name string) error {
+	if len(name) > maxNameLength {
+		return fmt.Errorf("%w: must be no more than %d characters", ErrInvalidName, maxNameLength)
+	}
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidName, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// displayName returns the name the owner gave the teamspace
+func displayName(ts *v1alpha1.Teamspace) string {
+	if ts.Spec.DisplayName != "" {
+		return ts.Spec.DisplayName
+	}
+	return ts.Name
+}
+
+// namespaceName returns the namespace that backs the teamspace with the given ID
+func namespaceName(name string) string {
+	return fmt.Sprintf("teamspace-%s", name)
+}
 
-	// Try in-cluster config first
-	config, err = rest.InClusterConfig()
+// CreateTeamspace creates the Teamspace object; the controller provisions the namespace.
+// An empty template selects the default template, an empty release the template release,
+// and a zero ttl the default lifetime. The placement engine picks the cluster, preferring the
+// given region, unless a cluster is named. The teamspace must fit in the quota of the owner,
+// resolved with their GitHub teams. Names are unique per owner across every cluster.
+func (m *TeamspaceManager) CreateTeamspace(name string, owner string, teams []string, initialHostedClusterRelease string, featureSet string, templateName string, clusterName string, region string, ttl time.Duration) (*Teamspace, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if clusterName != "" {
+		if _, err := m.resolveCluster(clusterName); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	expiresAt, err := m.expiryFor(now, ttl)
 	if err != nil {
-		// If in-cluster config fails, try loading from kubeconfig
-		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-		configOverrides := &clientcmd.ConfigOverrides{}
-		kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-		config, err = kubeConfig.ClientConfig()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get Kubernetes config: %v", err)
+		return nil, err
+	}
+
+	template, err := m.resolveTemplate(templateName)
+	if err != nil {
+		return nil, err
+	}
+	if template != nil {
+		templateName = template.Name
+		if initialHostedClusterRelease == "" {
+			initialHostedClusterRelease = template.Release
 		}
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	// IDs are random, so names are compared with the cached teamspaces of the owner in every
+	// cluster. The ledger repeats the check against concurrent creates.
+	owned, err := m.ListTeamspacesByOwner(owner)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create clientset: %v", err)
+		return nil, err
+	}
+	for _, teamspace := range owned {
+		if strings.EqualFold(teamspace.Name, name) {
+			return nil, fmt.Errorf("%w: you already have a teamspace named %s", ErrTeamspaceExists, name)
+		}
 	}
 
-	return &TeamspaceManager{
-		clientset: clientset,
-	}, nil
-}
+	cluster, placed, err := m.placeTeamspace(clusterName, region, teams, m.nodePoolReplicas(template))
+	if err != nil {
+		return nil, err
+	}
 
-func (m *TeamspaceManager) CreateTeamspace(name string, owner string, initialHostedClusterRelease string, featureSet string) (*Teamspace, error) {
-	namespace := fmt.Sprintf("teamspace-%s", name)
-	teamspace := &Teamspace{
-		Name:      name,
-		Namespace: namespace,
-		CreatedAt: time.Now(),
-		Owner:     owner,
+	ctx := context.TODO()
+	id := teamspaceID(name)
+	expiresAt = expiresAt.Truncate(time.Second)
+	reserved := reservation{Name: name, Nodes: m.nodePoolReplicas(template), ExpiresAt: expiresAt, ReservedAt: now}
+	limits, err := m.quotaLimits(owner, teams)
+	if err != nil {
+		return nil, err
 	}
+	err = m.ledger.reserve(ctx, owner, id, reserved, limits, func() (map[string]reservation, error) {
+		return m.observedReservations(owner)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The reservation is released on every failure until the Teamspace object is created
+	stored := false
+	defer func() {
+		if stored {
+			return
+		}
+		if err := m.ledger.release(ctx, owner, id); err != nil {
+			slog.Error("Failed to release quota reservation", "teamspace", id, "error", err)
+		}
+	}()
 
-	// Create namespace
-	_, err := m.clientset.CoreV1().Namespaces().Create(context.TODO(), &corev1.Namespace{
+	ts := &v1alpha1.Teamspace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: namespace,
+			Name: id,
 			Labels: map[string]string{
-				"teamspace": "true",
-				"owner":     owner,
-				"name":      name,
+				ownerLabel: usernameHash(owner),
 			},
 			Annotations: map[string]string{
-				"release":     initialHostedClusterRelease,
-				"feature-set": featureSet,
+				schemaVersionAnnotation: labelSchemaVersion,
 			},
 		},
-	}, metav1.CreateOptions{})
+		Spec: v1alpha1.TeamspaceSpec{
+			DisplayName: name,
+			Owner:       owner,
+			Release:     initialHostedClusterRelease,
+			FeatureSet:  featureSet,
+			Template:    templateName,
+			ExpiresAt:   &metav1.Time{Time: expiresAt},
+			Placement:   placed,
+		},
+	}
+
+	obj, err := ts.ToUnstructured()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create namespace: %v", err)
+		return nil, err
 	}
 
-	return teamspace, nil
-}
+	created, err := cluster.dynamic.Resource(v1alpha1.TeamspaceResource).Create(ctx, obj, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("%w: you already have a teamspace named %s", ErrTeamspaceExists, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create teamspace: %v", err)
+	}
+	stored = true
 
-func (m *TeamspaceManager) DeleteTeamspace(name string) error {
-	namespace := fmt.Sprintf("teamspace-%s", name)
-	return m.clientset.CoreV1().Namespaces().Delete(context.TODO(), namespace, metav1.DeleteOptions{})
-}
+	ts, err = v1alpha1.FromUnstructured(created)
+	if err != nil {
+		return nil, err
+	}
+	cluster.recordEvent(ts, corev1.EventTypeNormal, "Placed", fmt.Sprintf("Placed in cluster %s: %s", cluster.name, placed.Reason))
+	slog.Info("Teamspace placed", "teamspace", id, "cluster", cluster.name, "reason", placed.Reason)
 
-func (m *TeamspaceManager) ListTeamspaces() ([]*Teamspace, error) {
-	namespaces, err := m.clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
-		LabelSelector: "teamspace=true",
+	// Give the cache a moment to observe the new object so an immediate list includes it
+	_ = wait.PollUntilContextTimeout(context.TODO(), 50*time.Millisecond, 2*time.Second, true, func(context.Context) (bool, error) {
+		_, exists, _ := cluster.cache.teamspaces.GetIndexer().GetByKey(id)
+		return exists, nil
 	})
+
+	return toTeamspace(ts, cluster.name), nil
+}
+
+// DeleteTeamspace deletes the Teamspace object; the controller tears down the namespace. The
+// teamspace is looked up in the named cluster or, when empty, in every cluster.
+func (m *TeamspaceManager) DeleteTeamspace(name string, clusterName string) error {
+	_, cluster, err := m.getTeamspace(name, clusterName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list namespaces: %v", err)
+		return err
 	}
+	return cluster.dynamic.Resource(v1alpha1.TeamspaceResource).Delete(context.TODO(), name, metav1.DeleteOptions{})
+}
 
+// ListTeamspaces lists all teamspaces of every cluster from the cache
+func (m *TeamspaceManager) ListTeamspaces() ([]*Teamspace, error) {
+	if !m.HasSynced() {
+		return nil, ErrCacheNotSynced
+	}
 	var teamspaces []*Teamspace
-	for _, ns := range namespaces.Items {
-		teamspace := &Teamspace{
-			Name:      ns.Labels["name"],
-			Namespace: ns.Name,
-			CreatedAt: ns.CreationTimestamp.Time,
-			Owner:     ns.Labels["owner"],
+	for _, cluster := range m.clusters {
+		listed, err := cluster.listTeamspaces(cluster.cache.teamspaces.GetIndexer().List())
+		if err != nil {
+			return nil, err
 		}
+		teamspaces = append(teamspaces, listed...)
+	}
+	return teamspaces, nil
+}
 
-		// Include deletion timestamp if the namespace is being deleted
-		if ns.DeletionTimestamp != nil {
-			deletionTime := ns.DeletionTimestamp.Time
-			teamspace.DeletionTimestamp = &deletionTime
+// ListTeamspacesByOwner lists teamspaces owned by a specific user in every cluster
+func (m *TeamspaceManager) ListTeamspacesByOwner(owner string) ([]*Teamspace, error) {
+	if !m.HasSynced() {
+		return nil, ErrCacheNotSynced
+	}
+	var teamspaces []*Teamspace
+	for _, cluster := range m.clusters {
+		objs, err := cluster.cache.teamspaces.GetIndexer().ByIndex(ownerIndex, strings.ToLower(owner))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list teamspaces: %v", err)
 		}
-
-		teamspaces = append(teamspaces, teamspace)
+		listed, err := cluster.listTeamspaces(objs)
+		if err != nil {
+			return nil, err
+		}
+		teamspaces = append(teamspaces, listed...)
 	}
-
 	return teamspaces, nil
 }
 
-// ListTeamspacesByOwner lists teamspaces owned by a specific user
-func (m *TeamspaceManager) ListTeamspacesByOwner(owner string) ([]*Teamspace, error) {
-	namespaces, err := m.clientset.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("teamspace=true,owner=%s", owner),
-	})
+func (m *managementCluster) listTeamspaces(objs []interface{}) ([]*Teamspace, error) {
+	cached, err := cachedTeamspaces(objs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list namespaces: %v", err)
+		return nil, err
 	}
 
 	var teamspaces []*Teamspace
-	for _, ns := range namespaces.Items {
-		teamspace := &Teamspace{
-			Name:      ns.Labels["name"],
-			Namespace: ns.Name,
-			CreatedAt: ns.CreationTimestamp.Time,
-			Owner:     owner,
-		}
+	for _, ts := range cached {
+		teamspaces = append(teamspaces, toTeamspace(ts, m.name))
+	}
+
+	return teamspaces, nil
+}
 
-		// Include deletion timestamp if the namespace is being deleted
-		if ns.DeletionTimestamp != nil {
-			deletionTime := ns.DeletionTimestamp.Time
-			teamspace.DeletionTimestamp = &deletionTime
+// getTeamspace returns the cached Teamspace object with the given name and the cluster it lives
+// in, looking only in the named cluster unless clusterName is empty. New IDs are random, but
+// teamspaces that kept their name as their ID may exist in several clusters; rather than act on
+// either of them, such a teamspace is reported as ambiguous unless its cluster is named.
+func (m *TeamspaceManager) getTeamspace(name string, clusterName string) (*v1alpha1.Teamspace, *managementCluster, error) {
+	if !m.HasSynced() {
+		return nil, nil, ErrCacheNotSynced
+	}
+	clusters := m.clusters
+	if clusterName != "" {
+		cluster, err := m.resolveCluster(clusterName)
+		if err != nil {
+			return nil, nil, err
+		}
+		clusters = []*managementCluster{cluster}
+	}
+	var found *unstructured.Unstructured
+	var foundIn *managementCluster
+	for _, cluster := range clusters {
+		obj, exists, err := cluster.cache.teamspaces.GetIndexer().GetByKey(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get teamspace: %v", err)
+		}
+		if !exists {
+			continue
+		}
+		if foundIn != nil {
+			return nil, nil, fmt.Errorf("%w: %s exists in clusters %s and %s", ErrAmbiguousTeamspace, name, foundIn.name, cluster.name)
 		}
+		found, foundIn = obj.(*unstructured.Unstructured), cluster
+	}
+	if foundIn == nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrTeamspaceNotFound, name)
+	}
+	ts, err := v1alpha1.FromUnstructured(found)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ts, foundIn, nil
+}
 
-		teamspaces = append(teamspaces, teamspace)
+// toTeamspace converts the Teamspace object of the cluster into its API representation
+func toTeamspace(ts *v1alpha1.Teamspace, cluster string) *Teamspace {
+	namespace := ts.Status.Namespace
+	if namespace == "" {
+		namespace = namespaceName(ts.Name)
 	}
 
-	return teamspaces, nil
+	teamspace := &Teamspace{
+		ID:        ts.Name,
+		Name:      displayName(ts),
+		Cluster:   cluster,
+		Namespace: namespace,
+		CreatedAt: ts.CreationTimestamp.Time,
+		Owner:     ts.Spec.Owner,
+
+		Phase:      summarizePhase(ts),
+		Release:    ts.Spec.Release,
+		FeatureSet: ts.Spec.FeatureSet,
+		Template:   ts.Spec.Template,
+		LastError:  ts.Status.LastError,
+	}
+
+	// Include deletion timestamp if the teamspace is being deleted
+	if ts.DeletionTimestamp != nil {
+		deletionTime := ts.DeletionTimestamp.Time
+		teamspace.DeletionTimestamp = &deletionTime
+	}
+
+	for _, collaborator := range ts.Spec.Collaborators {
+		teamspace.Collaborators = append(teamspace.Collaborators, Collaborator{
+			Username: collaborator.Username,
+			Role:     Role(collaborator.Role),
+		})
+	}
+
+	if ts.Spec.ExpiresAt != nil {
+		expiresAt := ts.Spec.ExpiresAt.Time
+		teamspace.ExpiresAt = &expiresAt
+	}
+
+	if ts.Spec.Placement != nil {
+		teamspace.Placement = ts.Spec.Placement.Reason
+	}
+
+	if ts.Spec.Transfer != nil {
+		teamspace.PendingTransfer = &PendingTransfer{
+			To:          ts.Spec.Transfer.To,
+			RequestedBy: ts.Spec.Transfer.RequestedBy,
+			RequestedAt: ts.Spec.Transfer.RequestedAt.Time,
+		}
+	}
+
+	return teamspace
 }
 
 func (m *TeamspaceManager) GetKubeconfig(name string) ([]byte, error) {
-	namespace := fmt.Sprintf("teamspace-%s", name)
-	kubeconfigSecret := fmt.Sprintf("teamspace-%s-kubeconfig", name)
-	secret, err := m.clientset.CoreV1().Secrets(namespace).Get(context.TODO(), kubeconfigSecret, metav1.GetOptions{})
+	ts, cluster, err := m.getTeamspace(name, "")
+	if err != nil {
+		return nil, err
+	}
+	secret, err := cluster.clientset.CoreV1().Secrets(toTeamspace(ts, cluster.name).Namespace).Get(context.TODO(), kubeconfigSecretName(name), metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get kubeconfig secret: %v", err)
 	}
@@ -157,18 +467,17 @@ func (m *TeamspaceManager) GetKubeconfig(name string) ([]byte, error) {
 	return secret.Data["kubeconfig"], nil
 }
 
-// IsTeamspaceOwner checks if the given user is the owner of the specified teamspace
+// IsTeamspaceOwner checks if the given user is the owner of the specified teamspace.
+// Use TeamspaceRole to authorize access that collaborators may also have.
 func (m *TeamspaceManager) IsTeamspaceOwner(name string, username string) (bool, error) {
-	namespace := fmt.Sprintf("teamspace-%s", name)
-	ns, err := m.clientset.CoreV1().Namespaces().Get(context.TODO(), namespace, metav1.GetOptions{})
+	ts, _, err := m.getTeamspace(name, "")
 	if err != nil {
-		return false, fmt.Errorf("failed to get namespace: %v", err)
+		return false, err
 	}
 
-	owner, exists := ns.Labels["owner"]
-	if !exists {
-		return false, fmt.Errorf("namespace %s has no owner label", namespace)
+	if ts.Spec.Owner == "" {
+		return false, fmt.Errorf("teamspace %s has no owner", name)
 	}
 
-	return owner == username, nil
+	return ts.Spec.Owner == username, nil
 }
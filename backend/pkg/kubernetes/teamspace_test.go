@@ -0,0 +1,174 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newFakeManager returns a started manager over in-memory clusters, one per cluster of the config
+func newFakeManager(t *testing.T, appConfig *config.Config) *TeamspaceManager {
+	var clients []Clients
+	for range appConfig.Clusters {
+		clients = append(clients, NewDevCluster(appConfig, 0).Clients())
+	}
+	m, err := NewTeamspaceManagerForClients(appConfig, clients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Start(t.Context())
+	t.Cleanup(m.Shutdown)
+	if !m.WaitForCacheSync(t.Context()) {
+		t.Fatal("the cache did not sync")
+	}
+	return m
+}
+
+// createCachedTeamspace creates the Teamspace object in the cluster, bypassing the checks of the
+// manager, and waits for the cache to observe it
+func createCachedTeamspace(t *testing.T, cluster *managementCluster, ts *v1alpha1.Teamspace) {
+	t.Helper()
+	obj, err := ts.ToUnstructured()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cluster.dynamic.Resource(v1alpha1.TeamspaceResource).Create(t.Context(), obj, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollUntilContextTimeout(t.Context(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		_, exists, err := cluster.cache.teamspaces.GetIndexer().GetByKey(ts.Name)
+		return exists, err
+	})
+	if err != nil {
+		t.Fatalf("the cache did not observe the teamspace: %v", err)
+	}
+}
+
+func TestTeamspaceIDIsUnique(t *testing.T) {
+	first := teamspaceID("demo")
+	second := teamspaceID("demo")
+	if first == second {
+		t.Errorf("expected teamspaces with the same name to get different IDs, both got %s", first)
+	}
+	if !strings.HasPrefix(first, "demo-") || len(first) != len("demo-")+idSuffixLength {
+		t.Errorf("expected the ID to be the name and a suffix, got %s", first)
+	}
+}
+
+func TestNamesAreUniquePerOwner(t *testing.T) {
+	m := newFakeManager(t, config.Default())
+
+	demo, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0); !errors.Is(err, ErrTeamspaceExists) {
+		t.Errorf("expected a second teamspace of the same name to be rejected, got %v", err)
+	}
+	if _, err := m.CreateTeamspace("demo", "bob", nil, "", "", "", "", "", 0); err != nil {
+		t.Errorf("expected another owner to use the same name: %v", err)
+	}
+
+	// Once the teamspace is given away its name is free again
+	if _, err := m.TransferTeamspace(demo.ID, "", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollUntilContextTimeout(t.Context(), 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		owned, err := m.ListTeamspacesByOwner("alice")
+		return len(owned) == 0, err
+	})
+	if err != nil {
+		t.Fatalf("the cache did not observe the transfer: %v", err)
+	}
+	if _, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0); err != nil {
+		t.Errorf("expected the previous owner to reuse the name: %v", err)
+	}
+}
+
+func TestFailedCreateReleasesTheReservation(t *testing.T) {
+	m := newFakeManager(t, config.Default())
+	dynamicClient := m.defaultCluster().dynamic.(*dynamicfake.FakeDynamicClient)
+	dynamicClient.PrependReactor("create", "teamspaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewAlreadyExists(v1alpha1.TeamspaceResource.GroupResource(), "demo")
+	})
+
+	if _, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0); !errors.Is(err, ErrTeamspaceExists) {
+		t.Fatalf("expected the teamspace to exist, got %v", err)
+	}
+	cm, err := m.ledger.configMaps.ConfigMaps(m.ledger.namespace).Get(t.Context(), ledgerName("alice"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cm.Data) != 0 {
+		t.Errorf("expected the reservation to be released, got %v", cm.Data)
+	}
+}
+
+func TestTeamspaceInSeveralClustersIsAmbiguous(t *testing.T) {
+	appConfig := config.Default()
+	appConfig.Clusters = []config.ClusterConfig{{Name: "east"}, {Name: "west"}}
+	m := newFakeManager(t, appConfig)
+
+	// Teamspaces created before IDs had a suffix have their name as their ID
+	for _, cluster := range m.clusters {
+		createCachedTeamspace(t, cluster, &v1alpha1.Teamspace{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+			Spec:       v1alpha1.TeamspaceSpec{DisplayName: "demo", Owner: "alice"},
+		})
+	}
+
+	if _, err := m.GetTeamspace("demo", ""); !errors.Is(err, ErrAmbiguousTeamspace) {
+		t.Errorf("expected the teamspace to be ambiguous, got %v", err)
+	}
+	if err := m.DeleteTeamspace("demo", ""); !errors.Is(err, ErrAmbiguousTeamspace) {
+		t.Errorf("expected the delete to be refused, got %v", err)
+	}
+	for _, cluster := range m.clusters {
+		if _, exists, _ := cluster.cache.teamspaces.GetIndexer().GetByKey("demo"); !exists {
+			t.Errorf("expected the teamspace of cluster %s to be left alone", cluster.name)
+		}
+	}
+
+	// Naming the cluster picks one of them
+	if _, err := m.GetTeamspace("demo", "north"); !errors.Is(err, ErrUnknownCluster) {
+		t.Errorf("expected the cluster to be unknown, got %v", err)
+	}
+	if err := m.DeleteTeamspace("demo", "west"); err != nil {
+		t.Fatalf("expected the teamspace of cluster west to be deleted: %v", err)
+	}
+	east, west := m.clusters[0], m.clusters[1]
+	if _, err := west.dynamic.Resource(v1alpha1.TeamspaceResource).Get(t.Context(), "demo", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the teamspace of cluster west to be gone, got %v", err)
+	}
+	if _, err := east.dynamic.Resource(v1alpha1.TeamspaceResource).Get(t.Context(), "demo", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the teamspace of cluster east to be left alone: %v", err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	longest := strings.Repeat("a", maxNameLength)
+	if err := validateName(longest); err != nil {
+		t.Fatalf("expected a %d character name to be valid: %v", maxNameLength, err)
+	}
+	if errs := validation.IsDNS1123Label(namespaceName(teamspaceID(longest))); len(errs) > 0 {
+		t.Errorf("expected the namespace of the longest name to be valid: %v", errs)
+	}
+
+	for _, name := range []string{"", "Demo", "demo_1", "-demo", longest + "a"} {
+		if err := validateName(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("expected %q to be invalid, got %v", name, err)
+		}
+	}
+}
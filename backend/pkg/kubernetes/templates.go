@@ -0,0 +1,229 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// templateManifestsAnnotation lists the template manifests applied into a teamspace namespace,
+// so that manifests removed from the template can be deleted
+const templateManifestsAnnotation = v1alpha1.GroupName + "/template-manifests"
+
+// ErrUnknownTemplate is returned when a create request names a template that is not configured
+var ErrUnknownTemplate = errors.New("unknown template")
+
+// Template is a teamspace profile, as returned by the API
+type Template struct {
+	Name             string `json:"name"`
+	Description      string `json:"description,omitempty"`
+	Release          string `json:"release,omitempty"`
+	NodePoolReplicas int    `json:"nodePoolReplicas"`
+	InstanceType     string `json:"instanceType,omitempty"`
+	Default          bool   `json:"default,omitempty"`
+}
+
+// ListTemplates returns the configured templates in the order they are configured
+func (m *TeamspaceManager) ListTemplates() []Template {
+	templates := []Template{}
+	for _, template := range m.config.Templates {
+		templates = append(templates, Template{
+			Name:             template.Name,
+			Description:      template.Description,
+			Release:          template.Release,
+			NodePoolReplicas: m.nodePoolReplicas(&template),
+			InstanceType:     template.InstanceType,
+			Default:          template.Name == m.config.DefaultTemplate,
+		})
+	}
+	return templates
+}
+
+// resolveTemplate returns the template a new teamspace is created from, falling back to the
+// default template. It returns nil when no template applies.
+func (m *TeamspaceManager) resolveTemplate(name string) (*config.TemplateConfig, error) {
+	if name == "" {
+		name = m.config.DefaultTemplate
+	}
+	if name == "" {
+		return nil, nil
+	}
+	template, ok := m.config.Template(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+	return template, nil
+}
+
+// templateOf returns the template recorded on the teamspace, or nil if it has none or it was
+// removed from the config
+func (m *TeamspaceManager) templateOf(ts *v1alpha1.Teamspace) *config.TemplateConfig {
+	if ts.Spec.Template == "" {
+		return nil
+	}
+	template, ok := m.config.Template(ts.Spec.Template)
+	if !ok {
+		return nil
+	}
+	return template
+}
+
+// nodePoolPlatformSettings merges the template NodePool settings over the global ones
+func nodePoolPlatformSettings(platformType string, global map[string]interface{}, template *config.TemplateConfig) map[string]interface{} {
+	settings, _ := copyJSONValue(global).(map[string]interface{})
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	if template == nil {
+		return settings
+	}
+	for k, v := range template.NodePoolPlatformSpec {
+		settings[k] = copyJSONValue(v)
+	}
+	if template.InstanceType != "" {
+		// The config only allows an instance type on the platforms whose NodePools have one
+		switch platformType {
+		case "AWS":
+			settings["instanceType"] = template.InstanceType
+		case "Azure":
+			settings["vmSize"] = template.InstanceType
+		}
+	}
+	return settings
+}
+
+// ensureTemplateManifests applies the manifests of the teamspace template into its namespace
+// and deletes the ones that were removed from the template
+func (c *TeamspaceController) ensureTemplateManifests(ctx context.Context, ts *v1alpha1.Teamspace, namespace string) error {
+	m := c.cluster
+
+	var manifests []map[string]interface{}
+	if template := c.manager.templateOf(ts); template != nil {
+		manifests = template.Manifests
+	}
+
+	applied := map[string]bool{}
+	for _, manifest := range manifests {
+		obj := &unstructured.Unstructured{Object: copyJSONValue(manifest).(map[string]interface{})}
+		obj.SetNamespace(namespace)
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[teamspaceNameLabel] = ts.Name
+		obj.SetLabels(labels)
+
+		resource, err := m.namespacedResource(obj.GroupVersionKind())
+		if err != nil {
+			return fmt.Errorf("failed to apply template manifest %s %s: %v", obj.GetKind(), obj.GetName(), err)
+		}
+		_, err = m.dynamic.Resource(resource).Namespace(namespace).Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+		if err != nil {
+			return fmt.Errorf("failed to apply template manifest %s %s: %v", obj.GetKind(), obj.GetName(), err)
+		}
+		applied[manifestKey(obj.GroupVersionKind(), obj.GetName())] = true
+	}
+
+	ns, err := m.cachedNamespace(namespace)
+	if err != nil || ns == nil {
+		return err
+	}
+	var previous []string
+	if value := ns.Annotations[templateManifestsAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &previous); err != nil {
+			slog.Warn("Ignoring malformed annotation", "namespace", namespace, "annotation", templateManifestsAnnotation, "error", err)
+		}
+	}
+
+	changed := len(previous) != len(applied)
+	for _, key := range previous {
+		if applied[key] {
+			continue
+		}
+		changed = true
+		gvk, name, err := parseManifestKey(key)
+		if err != nil {
+			continue
+		}
+		resource, err := m.namespacedResource(gvk)
+		if err != nil {
+			continue
+		}
+		slog.Info("Deleting object removed from template", "template", ts.Spec.Template, "kind", gvk.Kind, "namespace", namespace, "name", name)
+		err = m.dynamic.Resource(resource).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s %s: %v", gvk.Kind, name, err)
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	keys := make([]string, 0, len(applied))
+	for key := range applied {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return m.updateNamespace(ctx, namespace, func(ns *corev1.Namespace) error {
+		if len(keys) == 0 {
+			delete(ns.Annotations, templateManifestsAnnotation)
+			return nil
+		}
+		value, err := json.Marshal(keys)
+		if err != nil {
+			return err
+		}
+		ns.Annotations[templateManifestsAnnotation] = string(value)
+		return nil
+	})
+}
+
+// namespacedResource maps a kind to its resource, refusing cluster scoped kinds
+func (m *managementCluster) namespacedResource(gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+	mapping, err := m.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		// The kind may have been installed since discovery was cached
+		m.mapper.Reset()
+		mapping, err = m.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	}
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return schema.GroupVersionResource{}, fmt.Errorf("%s is not namespaced", gvk.Kind)
+	}
+	return mapping.Resource, nil
+}
+
+// manifestKey identifies an applied manifest in the template manifests annotation
+func manifestKey(gvk schema.GroupVersionKind, name string) string {
+	return fmt.Sprintf("%s/%s/%s", gvk.GroupVersion().String(), gvk.Kind, name)
+}
+
+func parseManifestKey(key string) (schema.GroupVersionKind, string, error) {
+	var gvk schema.GroupVersionKind
+	// The group version is "v1" for the core group and "group/version" otherwise
+	parts := strings.Split(key, "/")
+	switch len(parts) {
+	case 3:
+		gvk = schema.GroupVersionKind{Version: parts[0], Kind: parts[1]}
+		return gvk, parts[2], nil
+	case 4:
+		gvk = schema.GroupVersionKind{Group: parts[0], Version: parts[1], Kind: parts[2]}
+		return gvk, parts[3], nil
+	}
+	return gvk, "", fmt.Errorf("malformed manifest %q", key)
+}
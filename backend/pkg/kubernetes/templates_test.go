@@ -0,0 +1,22 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/teamspace-app/backend/pkg/config"
+)
+
+func TestInstanceTypeIsOnlySetWhereTheNodePoolHasOne(t *testing.T) {
+	template := &config.TemplateConfig{Name: "gpu", InstanceType: "g5.xlarge"}
+	for platform, want := range map[string]map[string]interface{}{
+		"AWS":      {"instanceType": "g5.xlarge"},
+		"Azure":    {"vmSize": "g5.xlarge"},
+		"KubeVirt": {},
+		"None":     {},
+	} {
+		if got := nodePoolPlatformSettings(platform, nil, template); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected the %s NodePool settings %v, got %v", platform, want, got)
+		}
+	}
+}
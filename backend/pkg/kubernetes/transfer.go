@@ -0,0 +1,171 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrInvalidOwner is returned when a teamspace cannot be handed to the requested owner
+var ErrInvalidOwner = errors.New("invalid owner")
+
+// PendingTransfer is a handover of a teamspace waiting for the new owner, as returned by the API
+type PendingTransfer struct {
+	To          string    `json:"to"`
+	RequestedBy string    `json:"requestedBy"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+// RequestTransfer offers the teamspace to another user, replacing any pending offer. Nothing
+// changes hands until they accept it. Usernames are case insensitive, so the recipient is
+// recorded lowercased, however it was typed.
+func (m *TeamspaceManager) RequestTransfer(name string, requestedBy string, to string) (*Teamspace, error) {
+	to = strings.ToLower(to)
+	ts, cluster, err := m.updateTeamspace(name, "", func(ts *v1alpha1.Teamspace) error {
+		if strings.EqualFold(ts.Spec.Owner, to) {
+			return fmt.Errorf("%w: %s already owns the teamspace", ErrInvalidOwner, to)
+		}
+		ts.Spec.Transfer = &v1alpha1.OwnershipTransfer{
+			To:          to,
+			RequestedBy: requestedBy,
+			RequestedAt: metav1.Now(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Teamspace offered", "teamspace", name, "requested_by", requestedBy, "to", to)
+	return toTeamspace(ts, cluster.name), nil
+}
+
+// CancelTransfer withdraws or declines the pending transfer of the teamspace
+func (m *TeamspaceManager) CancelTransfer(name string) (*Teamspace, error) {
+	ts, cluster, err := m.updateTeamspace(name, "", func(ts *v1alpha1.Teamspace) error {
+		if ts.Spec.Transfer == nil {
+			return fmt.Errorf("%w: no transfer of teamspace %s is pending", ErrInvalidState, name)
+		}
+		ts.Spec.Transfer = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Teamspace transfer cancelled", "teamspace", name)
+	return toTeamspace(ts, cluster.name), nil
+}
+
+// AcceptTransfer makes the user the owner of a teamspace offered to them. The teamspace must fit
+// in their quota, resolved with their GitHub teams.
+func (m *TeamspaceManager) AcceptTransfer(name string, username string, teams []string) (*Teamspace, error) {
+	return m.transferTeamspace(name, "", username, teams, func(ts *v1alpha1.Teamspace) error {
+		if !isTransferRecipient(ts, username) {
+			return fmt.Errorf("%w: teamspace %s is not being transferred to %s", ErrInvalidState, name, username)
+		}
+		return nil
+	})
+}
+
+// TransferTeamspace makes another user the owner of the teamspace without their acceptance.
+// Their teams are not known outside their own session, so the teamspace must fit in their user
+// or default limits. The new owner is recorded lowercased, however it was typed. The teamspace
+// is looked up in the named cluster or, when empty, in every cluster.
+func (m *TeamspaceManager) TransferTeamspace(name string, clusterName string, owner string) (*Teamspace, error) {
+	return m.transferTeamspace(name, clusterName, strings.ToLower(owner), nil, nil)
+}
+
+// transferTeamspace moves the teamspace, and what it counts against the quota, to a new owner.
+// The ID and namespace of the teamspace stay the same. The previous owner loses access, the new
+// owner is dropped from the collaborators and any pending transfer is cleared. check, if set,
+// vets the live object before anything changes.
+func (m *TeamspaceManager) transferTeamspace(name string, clusterName string, owner string, teams []string, check func(*v1alpha1.Teamspace) error) (*Teamspace, error) {
+	ctx := context.TODO()
+
+	// Display names are unique per owner
+	owned, err := m.ListTeamspacesByOwner(owner)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := m.quotaLimits(owner, teams)
+	if err != nil {
+		return nil, err
+	}
+	_, cluster, err := m.getTeamspace(name, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous string
+	reserved := false
+	ts, cluster, err := m.updateTeamspace(name, clusterName, func(ts *v1alpha1.Teamspace) error {
+		if check != nil {
+			if err := check(ts); err != nil {
+				return err
+			}
+		}
+		previous = ts.Spec.Owner
+		if strings.EqualFold(ts.Spec.Owner, owner) {
+			return fmt.Errorf("%w: %s already owns the teamspace", ErrInvalidOwner, owner)
+		}
+		for _, teamspace := range owned {
+			if teamspace.ID != ts.Name && strings.EqualFold(teamspace.Name, displayName(ts)) {
+				return fmt.Errorf("%w: %s already has a teamspace named %s", ErrTeamspaceExists, owner, displayName(ts))
+			}
+		}
+
+		// The ledger holds the teamspace against the quota of the new owner until the cache
+		// observes the change
+		r := reservation{Name: displayName(ts), Nodes: m.teamspaceNodes(cluster, ts), ReservedAt: time.Now()}
+		if ts.Spec.ExpiresAt != nil {
+			r.ExpiresAt = ts.Spec.ExpiresAt.Time
+		}
+		err := m.ledger.reserve(ctx, owner, ts.Name, r, limits, func() (map[string]reservation, error) {
+			return m.observedReservations(owner)
+		})
+		if err != nil {
+			return err
+		}
+		reserved = true
+
+		ts.Spec.Owner = owner
+		if ts.Labels == nil {
+			ts.Labels = map[string]string{}
+		}
+		ts.Labels[ownerLabel] = usernameHash(owner)
+		var kept []v1alpha1.Collaborator
+		for _, collaborator := range ts.Spec.Collaborators {
+			if !strings.EqualFold(collaborator.Username, owner) {
+				kept = append(kept, collaborator)
+			}
+		}
+		ts.Spec.Collaborators = kept
+		ts.Spec.Transfer = nil
+		return nil
+	})
+	if err != nil {
+		if reserved {
+			if err := m.ledger.release(ctx, owner, name); err != nil {
+				slog.Error("Failed to release quota reservation", "teamspace", name, "owner", owner, "error", err)
+			}
+		}
+		return nil, err
+	}
+
+	// A teamspace created moments ago may still be reserved in the ledger of the previous owner
+	if err := m.ledger.release(ctx, previous, name); err != nil {
+		slog.Error("Failed to release quota reservation", "teamspace", name, "owner", previous, "error", err)
+	}
+
+	slog.Info("Teamspace transferred", "teamspace", name, "from", previous, "to", owner)
+	cluster.recordEvent(ts, corev1.EventTypeNormal, "OwnerChanged", fmt.Sprintf("Ownership was transferred from %s to %s", previous, owner))
+	return toTeamspace(ts, cluster.name), nil
+}
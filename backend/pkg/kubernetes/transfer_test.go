@@ -0,0 +1,170 @@
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/config"
+	"github.com/teamspace-app/backend/pkg/quota"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestPendingTransferIsVisibleToRecipient(t *testing.T) {
+	ts := &v1alpha1.Teamspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-1a2b3c4d"},
+		Spec: v1alpha1.TeamspaceSpec{
+			Owner:    "octocat",
+			Transfer: &v1alpha1.OwnershipTransfer{To: "Hubot", RequestedBy: "octocat"},
+		},
+	}
+
+	if role := roleOf(ts, "hubot"); role != RoleNone {
+		t.Errorf("expected the recipient to have no access before accepting, got %q", role)
+	}
+	if !visibleTo(ts, "hubot") {
+		t.Errorf("expected the teamspace to be visible to the recipient")
+	}
+	if visibleTo(ts, "someone-else") {
+		t.Errorf("expected the teamspace to be hidden from other users")
+	}
+
+	obj, err := ts.ToUnstructured()
+	if err != nil {
+		t.Fatalf("failed to convert teamspace: %v", err)
+	}
+	users, _ := indexByUser(obj)
+	if len(users) != 2 || users[1] != "hubot" {
+		t.Errorf("expected the owner and the recipient to be indexed, got %v", users)
+	}
+
+	// Once the transfer is declined the recipient sees the teamspace go away
+	visible := map[string]bool{ts.Name: true}
+	ts.Spec.Transfer = nil
+	if eventType, forward := filterEvent(watch.Modified, ts, "hubot", visible); !forward || eventType != TeamspaceDeleted {
+		t.Errorf("expected a deleted event for the recipient, got %q (forwarded: %v)", eventType, forward)
+	}
+}
+
+// reservedIn reports whether the teamspace is reserved in the ledger of the owner
+func reservedIn(t *testing.T, m *TeamspaceManager, owner, id string) bool {
+	t.Helper()
+	cm, err := m.ledger.configMaps.ConfigMaps(m.ledger.namespace).Get(t.Context(), ledgerName(owner), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok := cm.Data[id]
+	return ok
+}
+
+func TestTransferMovesTheReservation(t *testing.T) {
+	m := newFakeManager(t, config.Default())
+
+	for _, transfer := range []struct {
+		name     string
+		transfer func(id string) (*Teamspace, error)
+	}{
+		{"accepted", func(id string) (*Teamspace, error) {
+			if _, err := m.RequestTransfer(id, "alice", "bob"); err != nil {
+				return nil, err
+			}
+			return m.AcceptTransfer(id, "bob", nil)
+		}},
+		{"forced", func(id string) (*Teamspace, error) {
+			return m.TransferTeamspace(id, "", "bob")
+		}},
+	} {
+		demo, err := m.CreateTeamspace("demo-"+transfer.name, "alice", nil, "", "", "", "", "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reservedIn(t, m, "alice", demo.ID) {
+			t.Fatalf("expected the new teamspace to be reserved for alice")
+		}
+
+		transferred, err := transfer.transfer(demo.ID)
+		if err != nil {
+			t.Fatalf("%s transfer failed: %v", transfer.name, err)
+		}
+		if transferred.Owner != "bob" {
+			t.Errorf("expected bob to own the teamspace after the %s transfer, got %s", transfer.name, transferred.Owner)
+		}
+		if !reservedIn(t, m, "bob", demo.ID) {
+			t.Errorf("expected the %s transfer to reserve the teamspace for bob", transfer.name)
+		}
+		if reservedIn(t, m, "alice", demo.ID) {
+			t.Errorf("expected the %s transfer to release the reservation of alice", transfer.name)
+		}
+	}
+}
+
+func TestTransferIsHeldToTheQuotaOfTheRecipient(t *testing.T) {
+	appConfig := config.Default()
+	appConfig.Quotas.Default.Teamspaces = limit(1)
+	m := newFakeManager(t, appConfig)
+
+	if _, err := m.CreateTeamspace("mine", "bob", nil, "", "", "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	demo, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.TransferTeamspace(demo.ID, "", "bob"); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("expected the forced transfer to exceed the quota of bob, got %v", err)
+	}
+	if _, err := m.RequestTransfer(demo.ID, "alice", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AcceptTransfer(demo.ID, "bob", nil); !errors.Is(err, quota.ErrExceeded) {
+		t.Errorf("expected accepting the transfer to exceed the quota of bob, got %v", err)
+	}
+
+	ts, _, err := m.getTeamspace(demo.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Spec.Owner != "alice" {
+		t.Errorf("expected alice to keep the teamspace, got %s", ts.Spec.Owner)
+	}
+	if reservedIn(t, m, "bob", demo.ID) {
+		t.Errorf("expected no reservation for bob after the rejected transfers")
+	}
+	if !reservedIn(t, m, "alice", demo.ID) {
+		t.Errorf("expected alice to keep her reservation")
+	}
+}
+
+func TestTransferRecipientsAreCaseInsensitive(t *testing.T) {
+	m := newFakeManager(t, config.Default())
+
+	if _, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := m.CreateTeamspace("demo", "bob", nil, "", "", "", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owned, err := m.ListTeamspacesByOwner("ALICE"); err != nil || len(owned) != 1 {
+		t.Fatalf("expected ALICE to own the teamspace of alice, got %v, %v", owned, err)
+	}
+
+	// The name is taken by the teamspace of alice, whatever the case of the recipient
+	if _, err := m.TransferTeamspace(theirs.ID, "", "ALICE"); !errors.Is(err, ErrTeamspaceExists) {
+		t.Errorf("expected the transfer to be refused, got %v", err)
+	}
+
+	offered, err := m.RequestTransfer(theirs.ID, "bob", "Carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offered.PendingTransfer == nil || offered.PendingTransfer.To != "carol" {
+		t.Errorf("expected the recipient to be recorded lowercased, got %+v", offered.PendingTransfer)
+	}
+}
@@ -0,0 +1,302 @@
+package kubernetes
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"sync"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TeamspaceEventType is the kind of change carried by a TeamspaceEvent
+type TeamspaceEventType string
+
+const (
+	TeamspaceAdded    TeamspaceEventType = "added"
+	TeamspaceModified TeamspaceEventType = "modified"
+	TeamspaceDeleted  TeamspaceEventType = "deleted"
+	// TeamspaceReset tells the client to drop its state; it is followed by an added event per teamspace
+	TeamspaceReset TeamspaceEventType = "reset"
+	// TeamspaceBookmark only advances the resource version the client resumes from
+	TeamspaceBookmark TeamspaceEventType = "bookmark"
+)
+
+// TeamspaceEvent is a change to one of the teamspaces visible to a user
+type TeamspaceEvent struct {
+	Type      TeamspaceEventType
+	Teamspace *Teamspace
+	// ResourceVersion is the cursor to resume the watch from, which holds the resource version
+	// of every cluster
+	ResourceVersion string
+}
+
+// watchBufferSize is how many events a watch can fall behind the informers before it is dropped
+// and its client resynced
+const watchBufferSize = 100
+
+// clusterEvent is a change to a Teamspace object in the cache of one cluster
+type clusterEvent struct {
+	cluster   string
+	eventType watch.EventType
+	obj       *unstructured.Unstructured
+}
+
+// teamspaceBroadcaster fans the events of the Teamspace informers out to the watches, so that
+// the API server serves one watch per cluster however many clients stream their teamspaces
+type teamspaceBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan clusterEvent]bool
+}
+
+func newTeamspaceBroadcaster() *teamspaceBroadcaster {
+	return &teamspaceBroadcaster{subscribers: map[chan clusterEvent]bool{}}
+}
+
+// subscribe returns the events from now on. The channel is closed when the subscriber falls
+// watchBufferSize events behind, or once it unsubscribes.
+func (b *teamspaceBroadcaster) subscribe() chan clusterEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := make(chan clusterEvent, watchBufferSize)
+	b.subscribers[events] = true
+	return events
+}
+
+func (b *teamspaceBroadcaster) unsubscribe(events chan clusterEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[events] {
+		delete(b.subscribers, events)
+		close(events)
+	}
+}
+
+// publish hands the event to every subscriber without waiting, so that a slow client holds up
+// neither the informer nor the other watches
+func (b *teamspaceBroadcaster) publish(event clusterEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+			delete(b.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// handler publishes the changes seen by the Teamspace informer of a cluster
+func (b *teamspaceBroadcaster) handler(cluster string) cache.ResourceEventHandler {
+	publish := func(eventType watch.EventType, obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			b.publish(clusterEvent{cluster: cluster, eventType: eventType, obj: u})
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) { publish(watch.Added, obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			// Resyncs deliver objects that did not change
+			resourceVersion := newObj.(*unstructured.Unstructured).GetResourceVersion()
+			if resourceVersion != "" && resourceVersion == oldObj.(*unstructured.Unstructured).GetResourceVersion() {
+				return
+			}
+			publish(watch.Modified, newObj)
+		},
+		DeleteFunc: func(obj interface{}) { publish(watch.Deleted, obj) },
+	}
+}
+
+// WatchTeamspaces streams changes to the teamspaces the user owns or collaborates on until the context is cancelled.
+// The stream starts with a reset followed by the current teamspaces, unless resourceVersion is
+// still the state of the cache, as when a client reconnects after an idle period.
+func (m *TeamspaceManager) WatchTeamspaces(ctx context.Context, username string, resourceVersion string) (<-chan TeamspaceEvent, error) {
+	if !m.HasSynced() {
+		return nil, ErrCacheNotSynced
+	}
+
+	events := make(chan TeamspaceEvent)
+	go func() {
+		defer close(events)
+
+		visible := map[string]bool{}
+		send := func(event TeamspaceEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		cursor := m.parseCursor(resourceVersion)
+		for ctx.Err() == nil {
+			// Subscribe before reading the cache, so that no change is missed in between
+			changes := m.watchers.subscribe()
+			ok := cursor != nil && m.resume(username, cursor, visible)
+			if !ok {
+				cursor, ok = m.sendSnapshot(username, visible, send)
+			}
+			if !ok || !m.forwardEvents(ctx, username, changes, cursor, visible, send) {
+				m.watchers.unsubscribe(changes)
+				return
+			}
+			slog.Warn("Teamspace watch fell behind and is resynced", "user", username)
+			cursor = nil
+		}
+	}()
+
+	return events, nil
+}
+
+// encodeCursor encodes the resource version of every cluster into a single resource version
+func encodeCursor(cursor map[string]string) string {
+	values := url.Values{}
+	for cluster, resourceVersion := range cursor {
+		values.Set(cluster, resourceVersion)
+	}
+	return values.Encode()
+}
+
+// parseCursor decodes the resource version of every cluster, returning nil when the cursor is
+// empty, malformed or misses a cluster
+func (m *TeamspaceManager) parseCursor(resourceVersion string) map[string]string {
+	if resourceVersion == "" {
+		return nil
+	}
+	values, err := url.ParseQuery(resourceVersion)
+	if err != nil {
+		return nil
+	}
+	cursor := map[string]string{}
+	for _, cluster := range m.clusters {
+		if values.Get(cluster.name) == "" {
+			return nil
+		}
+		cursor[cluster.name] = values.Get(cluster.name)
+	}
+	return cursor
+}
+
+// cacheCursor returns the resource version the cache of every cluster is at
+func (m *TeamspaceManager) cacheCursor() map[string]string {
+	cursor := map[string]string{}
+	for _, cluster := range m.clusters {
+		cursor[cluster.name] = cluster.cache.teamspaces.LastSyncResourceVersion()
+	}
+	return cursor
+}
+
+// resume reports whether the client is still up to date with the cache, in which case it
+// already has the teamspaces visible to the user and needs no snapshot
+func (m *TeamspaceManager) resume(username string, cursor map[string]string, visible map[string]bool) bool {
+	for cluster, resourceVersion := range m.cacheCursor() {
+		if cursor[cluster] != resourceVersion {
+			return false
+		}
+	}
+	teamspaces, err := m.ListTeamspacesForUser(username)
+	if err != nil {
+		return false
+	}
+	for _, teamspace := range teamspaces {
+		visible[teamspace.ID] = true
+	}
+	return true
+}
+
+// sendSnapshot emits a reset and the user's teamspaces from the cache, returning the cursor to
+// watch from
+func (m *TeamspaceManager) sendSnapshot(username string, visible map[string]bool, send func(TeamspaceEvent) bool) (map[string]string, bool) {
+	cursor := m.cacheCursor()
+	resourceVersion := encodeCursor(cursor)
+	teamspaces, err := m.ListTeamspacesForUser(username)
+	if err != nil {
+		slog.Error("Failed to list teamspaces to watch", "user", username, "error", err)
+		return nil, false
+	}
+
+	for name := range visible {
+		delete(visible, name)
+	}
+	if !send(TeamspaceEvent{Type: TeamspaceReset, ResourceVersion: resourceVersion}) {
+		return nil, false
+	}
+	for _, teamspace := range teamspaces {
+		visible[teamspace.ID] = true
+		if !send(TeamspaceEvent{Type: TeamspaceAdded, Teamspace: teamspace, ResourceVersion: resourceVersion}) {
+			return nil, false
+		}
+	}
+
+	return cursor, true
+}
+
+// forwardEvents relays the changes of every cluster, advancing the cursor as they arrive. It
+// reports whether the client must be resynced because the watch fell behind and was dropped;
+// the stream ends otherwise.
+func (m *TeamspaceManager) forwardEvents(ctx context.Context, username string, changes <-chan clusterEvent, cursor map[string]string, visible map[string]bool, send func(TeamspaceEvent) bool) bool {
+	for {
+		var change clusterEvent
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-changes:
+			if !ok {
+				return true
+			}
+			change = event
+		}
+
+		cursor[change.cluster] = change.obj.GetResourceVersion()
+		resourceVersion := encodeCursor(cursor)
+
+		ts, err := v1alpha1.FromUnstructured(change.obj)
+		if err != nil {
+			slog.Error("Failed to convert watched teamspace", "error", err)
+			continue
+		}
+
+		eventType, forward := filterEvent(change.eventType, ts, username, visible)
+		if !forward {
+			// Changes to the teamspaces of others still advance the cursor, so that the client
+			// resumes without a snapshot
+			if !send(TeamspaceEvent{Type: TeamspaceBookmark, ResourceVersion: resourceVersion}) {
+				return false
+			}
+			continue
+		}
+		teamspace := toTeamspace(ts, change.cluster)
+		teamspace.Role = roleOf(ts, username)
+		if !send(TeamspaceEvent{Type: eventType, Teamspace: teamspace, ResourceVersion: resourceVersion}) {
+			return false
+		}
+	}
+}
+
+// filterEvent decides which event, if any, the user sees for a change to a teamspace. A teamspace
+// that stops being visible to the user, e.g. when they are removed as a collaborator, is reported as deleted.
+func filterEvent(eventType watch.EventType, ts *v1alpha1.Teamspace, username string, visible map[string]bool) (TeamspaceEventType, bool) {
+	wasVisible := visible[ts.Name]
+	isVisible := eventType != watch.Deleted && visibleTo(ts, username)
+
+	switch {
+	case isVisible && wasVisible:
+		return TeamspaceModified, true
+	case isVisible:
+		visible[ts.Name] = true
+		return TeamspaceAdded, true
+	case wasVisible:
+		delete(visible, ts.Name)
+		return TeamspaceDeleted, true
+	default:
+		return "", false
+	}
+}
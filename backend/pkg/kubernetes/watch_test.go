@@ -0,0 +1,88 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/teamspace-app/backend/pkg/config"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// nextEvent returns the next event of a watch, failing the test if none arrives
+func nextEvent(t *testing.T, events <-chan TeamspaceEvent) TeamspaceEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a watch event")
+		return TeamspaceEvent{}
+	}
+}
+
+func TestWatchesShareTheInformer(t *testing.T) {
+	m := newFakeManager(t, config.Default())
+
+	alice, err := m.WatchTeamspaces(t.Context(), "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := m.WatchTeamspaces(t.Context(), "bob", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, events := range []<-chan TeamspaceEvent{alice, bob} {
+		if event := nextEvent(t, events); event.Type != TeamspaceReset {
+			t.Fatalf("expected the watch to start with a reset, got %q", event.Type)
+		}
+	}
+
+	teamspace, err := m.CreateTeamspace("demo", "alice", nil, "", "", "", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := nextEvent(t, alice); event.Type != TeamspaceAdded || event.Teamspace.ID != teamspace.ID {
+		t.Errorf("expected alice to see her teamspace added, got %q %+v", event.Type, event.Teamspace)
+	}
+	if event := nextEvent(t, bob); event.Type != TeamspaceBookmark || event.Teamspace != nil {
+		t.Errorf("expected bob to only see a bookmark, got %q %+v", event.Type, event.Teamspace)
+	}
+
+	// The API server serves the informer only, whatever the number of watches
+	watches := 0
+	for _, action := range m.defaultCluster().dynamic.(*dynamicfake.FakeDynamicClient).Actions() {
+		if action.GetVerb() == "watch" && action.GetResource().Resource == "teamspaces" {
+			watches++
+		}
+	}
+	if watches != 1 {
+		t.Errorf("expected a single watch of teamspaces on the API server, got %d", watches)
+	}
+}
+
+func TestBroadcasterDropsSlowSubscribers(t *testing.T) {
+	b := newTeamspaceBroadcaster()
+	slow := b.subscribe()
+	fast := b.subscribe()
+
+	for i := 0; i <= watchBufferSize; i++ {
+		b.publish(clusterEvent{cluster: "default"})
+		if i < watchBufferSize {
+			<-fast
+		}
+	}
+	<-fast
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != watchBufferSize {
+		t.Errorf("expected the slow subscriber to get its buffer before being dropped, got %d events", received)
+	}
+	if !b.subscribers[fast] {
+		t.Errorf("expected the subscriber that kept up to stay subscribed")
+	}
+	b.unsubscribe(slow)
+	b.unsubscribe(fast)
+}
@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in log records
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are dropped whatever they hold; a key
+// matches when it contains one of them, such as "access_token" or "session_cookie"
+var sensitiveKeys = []string{"token", "secret", "password", "cookie", "kubeconfig", "authorization", "credential"}
+
+// sensitiveExactKeys are dropped only on an exact match, as they are common within other keys
+var sensitiveExactKeys = map[string]bool{"state": true, "code": true, "session": true}
+
+// secretPatterns find secrets inside messages and values, whatever their key
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// PEM certificates and keys
+	{regexp.MustCompile(`-----BEGIN [A-Z ]+-----[\s\S]*?-----END [A-Z ]+-----`), Redacted},
+	// Credentials of a kubeconfig, and the tokens and passwords of YAML and JSON documents in general
+	{regexp.MustCompile(`(?i)((?:client-key-data|client-certificate-data|certificate-authority-data|token|password)"?\s*:\s*"?)[^\s,}"]+`), "${1}" + Redacted},
+	// GitHub tokens
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})`), Redacted},
+	// JSON Web Tokens, such as service account and OIDC tokens
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Redacted},
+	// Authorization headers and bearer tokens
+	{regexp.MustCompile(`(?i)\b(authorization:\s*)[^\n]+`), "${1}" + Redacted},
+	{regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9\-._~+/]+=*`), "${1} " + Redacted},
+	// OAuth parameters of URLs and form bodies
+	{regexp.MustCompile(`(?i)\b((?:code|state|access_token|refresh_token|id_token|client_secret)=)[^&\s"]+`), "${1}" + Redacted},
+	// Cookies, including the session cookie
+	{regexp.MustCompile(`(?i)\b((?:set-)?cookie:\s*)[^\n]+`), "${1}" + Redacted},
+	{regexp.MustCompile(`\b(teamspace-session=)[^;\s"]+`), "${1}" + Redacted},
+}
+
+// Redact removes the secrets it recognizes from a string
+func Redact(s string) string {
+	for _, secret := range secretPatterns {
+		s = secret.pattern.ReplaceAllString(s, secret.replacement)
+	}
+	return s
+}
+
+// sensitiveKey reports whether an attribute key names a secret
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveExactKeys[key] {
+		return true
+	}
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAttr is the ReplaceAttr of the handlers. Values of any other kind than strings are
+// formatted to strings to be redacted, as errors and structs can hold secrets too.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 {
+		switch a.Key {
+		case slog.TimeKey, slog.LevelKey, slog.SourceKey:
+			return a
+		case slog.MessageKey:
+			return slog.String(a.Key, Redact(a.Value.String()))
+		}
+	}
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(Redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(Redact(v.String()))
+		case []byte:
+			a.Value = slog.StringValue(Redact(string(v)))
+		default:
+			a.Value = slog.StringValue(Redact(fmt.Sprintf("%+v", v)))
+		}
+	}
+	return a
+}
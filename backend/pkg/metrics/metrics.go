@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+const namespace = "teamspace"
+
+// Registry holds every metric served on /metrics. A registry of our own keeps metrics that
+// dependencies register globally out of the endpoint.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts requests to the API by route template, so IDs don't make new series
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests, by route and method. Watches last as long as the client stays connected.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// GitHubRequests counts calls to GitHub by endpoint; the status is "error" when no response came back
+	GitHubRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "github_requests_total",
+		Help:      "Requests to GitHub, by endpoint and status code.",
+	}, []string{"endpoint", "status"})
+
+	GitHubRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "github_request_duration_seconds",
+		Help:      "Latency of requests to GitHub, by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	// GitHubRateLimitRemaining and GitHubRateLimitReset are taken from the rate limit headers of
+	// the latest GitHub response, by rate limit resource such as "core"
+	GitHubRateLimitRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_rate_limit_remaining",
+		Help:      "Requests left in the current GitHub rate limit window, by resource.",
+	}, []string{"resource"})
+
+	GitHubRateLimitReset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "github_rate_limit_reset_timestamp_seconds",
+		Help:      "Unix time at which the current GitHub rate limit window resets, by resource.",
+	}, []string{"resource"})
+
+	KubernetesRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kubernetes_requests_total",
+		Help:      "Requests to the Kubernetes API server, by host, method and status code.",
+	}, []string{"host", "method", "code"})
+
+	KubernetesRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "kubernetes_request_duration_seconds",
+		Help:      "Latency of requests to the Kubernetes API server, by host and verb.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"host", "verb"})
+
+	// ProvisioningDuration observes how long new teamspaces took to first become ready
+	ProvisioningDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "provisioning_duration_seconds",
+		Help:      "Time from the creation of a teamspace until it first became ready.",
+		Buckets:   []float64{60, 120, 300, 600, 900, 1200, 1800, 2700, 3600, 5400, 7200},
+	})
+
+	// AuditRecordsDropped counts the audit records dropped because the sinks fell behind
+	AuditRecordsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_records_dropped_total",
+		Help:      "Audit records dropped because the sinks fell behind.",
+	})
+
+	// ProvisioningFailures counts teamspaces entering the Failed phase, by the reason of the
+	// condition that failed
+	ProvisioningFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provisioning_failures_total",
+		Help:      "Teamspaces that entered the Failed phase, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		GitHubRequests,
+		GitHubRequestDuration,
+		GitHubRateLimitRemaining,
+		GitHubRateLimitReset,
+		KubernetesRequests,
+		KubernetesRequestDuration,
+		ProvisioningDuration,
+		ProvisioningFailures,
+		AuditRecordsDropped,
+	)
+}
+
+// RegisterKubernetesClient makes client-go report the requests of every Kubernetes client to
+// the registry. client-go only accepts the first registration, so call it once at startup.
+func RegisterKubernetesClient() {
+	clientmetrics.Register(clientmetrics.RegisterOpts{
+		RequestLatency: kubernetesLatency{},
+		RequestResult:  kubernetesResult{},
+	})
+}
+
+type kubernetesLatency struct{}
+
+func (kubernetesLatency) Observe(_ context.Context, verb string, u url.URL, latency time.Duration) {
+	KubernetesRequestDuration.WithLabelValues(u.Host, verb).Observe(latency.Seconds())
+}
+
+type kubernetesResult struct{}
+
+func (kubernetesResult) Increment(_ context.Context, code, method, host string) {
+	KubernetesRequests.WithLabelValues(host, method, code).Inc()
+}
@@ -0,0 +1,183 @@
+package placement
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoCluster is returned when no management cluster can take the teamspace
+var ErrNoCluster = errors.New("no management cluster can take the teamspace")
+
+// Weights of the factors in the score of a cluster, which add up to 100
+const (
+	regionWeight   = 40
+	capacityWeight = 40
+	loadWeight     = 20
+)
+
+// Cluster is a management cluster as the placement engine sees it
+type Cluster struct {
+	Name   string
+	Region string
+	// Teamspaces and Nodes are what the cluster hosts now
+	Teamspaces int
+	Nodes      int
+	// MaxTeamspaces and MaxNodes bound what the cluster hosts; zero means unlimited
+	MaxTeamspaces int
+	MaxNodes      int
+	// AllowedTeams, when set, restricts the cluster to members of these GitHub teams
+	AllowedTeams []string
+	// DeniedTeams keeps members of these GitHub teams off the cluster
+	DeniedTeams []string
+}
+
+// Request is the teamspace to place
+type Request struct {
+	// Cluster, when set, is the only cluster considered
+	Cluster string
+	// Region is the region the user prefers, if any
+	Region string
+	// Teams are the GitHub teams of the owner
+	Teams []string
+	// Nodes is the size of the NodePool of the teamspace
+	Nodes int
+}
+
+// Candidate is how a cluster fared
+type Candidate struct {
+	Cluster  string
+	Eligible bool
+	// Score ranks the eligible clusters from 0 to 100; ineligible clusters score 0
+	Score  int
+	Reason string
+}
+
+// Decision is the cluster picked for a teamspace and why
+type Decision struct {
+	Cluster string
+	Reason  string
+	// Candidates are every cluster in the order they were given
+	Candidates []Candidate
+}
+
+// Place picks the eligible cluster with the highest score. Clusters are eligible when the team
+// rules let the owner in and the teamspace fits in their capacity. The score favours the region
+// the user prefers, then the capacity left once the teamspace is placed, then the clusters
+// hosting fewer teamspaces. Ties go to the cluster given first.
+func Place(clusters []Cluster, req Request) (Decision, error) {
+	busiest := 0
+	for _, cluster := range clusters {
+		busiest = max(busiest, cluster.Teamspaces)
+	}
+
+	decision := Decision{}
+	best := -1
+	for i, cluster := range clusters {
+		candidate := evaluate(cluster, req, busiest)
+		decision.Candidates = append(decision.Candidates, candidate)
+		if candidate.Eligible && (best < 0 || candidate.Score > decision.Candidates[best].Score) {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		var reasons []string
+		for _, candidate := range decision.Candidates {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", candidate.Cluster, candidate.Reason))
+		}
+		decision.Reason = strings.Join(reasons, "; ")
+		return decision, fmt.Errorf("%w: %s", ErrNoCluster, decision.Reason)
+	}
+
+	chosen := decision.Candidates[best]
+	decision.Cluster = chosen.Cluster
+	if req.Cluster != "" {
+		decision.Reason = fmt.Sprintf("requested by the user (%s)", chosen.Reason)
+	} else {
+		decision.Reason = fmt.Sprintf("highest score %d of %d clusters (%s)", chosen.Score, len(clusters), chosen.Reason)
+	}
+	return decision, nil
+}
+
+// evaluate scores a single cluster for the request
+func evaluate(cluster Cluster, req Request, busiest int) Candidate {
+	candidate := Candidate{Cluster: cluster.Name}
+
+	if req.Cluster != "" && req.Cluster != cluster.Name {
+		candidate.Reason = "another cluster was requested"
+		return candidate
+	}
+	if team := firstShared(cluster.DeniedTeams, req.Teams); team != "" {
+		candidate.Reason = fmt.Sprintf("denied to team %s", team)
+		return candidate
+	}
+	if len(cluster.AllowedTeams) > 0 && firstShared(cluster.AllowedTeams, req.Teams) == "" {
+		candidate.Reason = fmt.Sprintf("restricted to teams %s", strings.Join(cluster.AllowedTeams, ", "))
+		return candidate
+	}
+	if cluster.MaxTeamspaces > 0 && cluster.Teamspaces+1 > cluster.MaxTeamspaces {
+		candidate.Reason = fmt.Sprintf("full with %d of %d teamspaces", cluster.Teamspaces, cluster.MaxTeamspaces)
+		return candidate
+	}
+	if cluster.MaxNodes > 0 && cluster.Nodes+req.Nodes > cluster.MaxNodes {
+		candidate.Reason = fmt.Sprintf("%d of %d nodes left, %d needed", max(cluster.MaxNodes-cluster.Nodes, 0), cluster.MaxNodes, req.Nodes)
+		return candidate
+	}
+	candidate.Eligible = true
+
+	var reasons []string
+	score := 0.0
+	if req.Region != "" {
+		if strings.EqualFold(cluster.Region, req.Region) {
+			score += regionWeight
+			reasons = append(reasons, fmt.Sprintf("in region %s", cluster.Region))
+		} else {
+			reasons = append(reasons, "outside the requested region")
+		}
+	}
+
+	left := capacityLeft(cluster, req)
+	score += capacityWeight * left
+	if cluster.MaxTeamspaces > 0 || cluster.MaxNodes > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d%% capacity left", int(left*100)))
+	} else {
+		reasons = append(reasons, "unlimited capacity")
+	}
+
+	load := 1.0
+	if busiest > 0 {
+		load = 1 - float64(cluster.Teamspaces)/float64(busiest)
+	}
+	score += loadWeight * load
+	reasons = append(reasons, fmt.Sprintf("%d teamspaces", cluster.Teamspaces))
+
+	candidate.Score = int(score + 0.5)
+	candidate.Reason = strings.Join(reasons, ", ")
+	return candidate
+}
+
+// capacityLeft returns the share of the tightest capacity of the cluster that is left once the
+// teamspace is placed, from 0 to 1
+func capacityLeft(cluster Cluster, req Request) float64 {
+	left := 1.0
+	if cluster.MaxTeamspaces > 0 {
+		left = min(left, float64(cluster.MaxTeamspaces-cluster.Teamspaces-1)/float64(cluster.MaxTeamspaces))
+	}
+	if cluster.MaxNodes > 0 {
+		left = min(left, float64(cluster.MaxNodes-cluster.Nodes-req.Nodes)/float64(cluster.MaxNodes))
+	}
+	return max(left, 0)
+}
+
+// firstShared returns the first team of the rule the user is a member of
+func firstShared(rule []string, teams []string) string {
+	for _, team := range rule {
+		for _, member := range teams {
+			if team == member {
+				return team
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package placement
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPlace(t *testing.T) {
+	clusters := []Cluster{
+		{Name: "east", Region: "us-east", Teamspaces: 8, MaxTeamspaces: 10},
+		{Name: "west", Region: "us-west", Teamspaces: 2, MaxTeamspaces: 10},
+		{Name: "eu", Region: "eu-west", Teamspaces: 4, AllowedTeams: []string{"emea"}},
+	}
+
+	tests := []struct {
+		name    string
+		req     Request
+		cluster string
+	}{
+		{name: "most capacity left", req: Request{}, cluster: "west"},
+		{name: "region preference", req: Request{Region: "us-east"}, cluster: "east"},
+		{name: "region in another case", req: Request{Region: "US-East"}, cluster: "east"},
+		{name: "allowed team", req: Request{Region: "eu-west", Teams: []string{"emea"}}, cluster: "eu"},
+		{name: "team not allowed", req: Request{Region: "eu-west"}, cluster: "west"},
+		{name: "requested cluster", req: Request{Cluster: "east"}, cluster: "east"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := Place(clusters, tt.req)
+			if err != nil {
+				t.Fatalf("expected the teamspace to be placed, got %v", err)
+			}
+			if decision.Cluster != tt.cluster {
+				t.Errorf("expected %s, got %s: %s", tt.cluster, decision.Cluster, decision.Reason)
+			}
+			if len(decision.Candidates) != len(clusters) || decision.Reason == "" {
+				t.Errorf("expected every cluster to be recorded with a reason, got %+v", decision)
+			}
+		})
+	}
+}
+
+func TestPlaceIneligible(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster Cluster
+		req     Request
+	}{
+		{name: "denied team", cluster: Cluster{Name: "east", DeniedTeams: []string{"interns"}}, req: Request{Teams: []string{"dev", "interns"}}},
+		{name: "not an allowed team", cluster: Cluster{Name: "east", AllowedTeams: []string{"sre"}}, req: Request{Teams: []string{"dev"}}},
+		{name: "full of teamspaces", cluster: Cluster{Name: "east", Teamspaces: 5, MaxTeamspaces: 5}, req: Request{}},
+		{name: "too few nodes left", cluster: Cluster{Name: "east", Nodes: 10, MaxNodes: 12}, req: Request{Nodes: 3}},
+		{name: "another cluster requested", cluster: Cluster{Name: "east"}, req: Request{Cluster: "west"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := Place([]Cluster{tt.cluster}, tt.req)
+			if !errors.Is(err, ErrNoCluster) {
+				t.Fatalf("expected no cluster to be eligible, got %v", err)
+			}
+			if decision.Candidates[0].Eligible || decision.Candidates[0].Reason == "" {
+				t.Errorf("expected the cluster to be ineligible with a reason, got %+v", decision.Candidates[0])
+			}
+		})
+	}
+}
+
+func TestPlacePrefersFirstOnTies(t *testing.T) {
+	decision, err := Place([]Cluster{{Name: "a"}, {Name: "b"}}, Request{})
+	if err != nil || decision.Cluster != "a" {
+		t.Errorf("expected the first cluster, got %s, %v", decision.Cluster, err)
+	}
+}
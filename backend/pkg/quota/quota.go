@@ -0,0 +1,142 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/teamspace-app/backend/pkg/config"
+)
+
+// ErrExceeded is returned when a request would take a user over one of their limits
+var ErrExceeded = errors.New("quota exceeded")
+
+// Limits are the limits that apply to a user; nil means unlimited
+type Limits struct {
+	Teamspaces   *int     `json:"teamspaces"`
+	Nodes        *int     `json:"nodes"`
+	ClusterHours *float64 `json:"clusterHours"`
+}
+
+// Usage is what a user owns, or what a request asks for
+type Usage struct {
+	Teamspaces   int     `json:"teamspaces"`
+	Nodes        int     `json:"nodes"`
+	ClusterHours float64 `json:"clusterHours"`
+}
+
+// Add returns the sum of both usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		Teamspaces:   u.Teamspaces + other.Teamspaces,
+		Nodes:        u.Nodes + other.Nodes,
+		ClusterHours: u.ClusterHours + other.ClusterHours,
+	}
+}
+
+// Sub returns the usage minus the other usage
+func (u Usage) Sub(other Usage) Usage {
+	return Usage{
+		Teamspaces:   u.Teamspaces - other.Teamspaces,
+		Nodes:        u.Nodes - other.Nodes,
+		ClusterHours: u.ClusterHours - other.ClusterHours,
+	}
+}
+
+// Status reports the limits of a user against what they use, as returned by the API
+type Status struct {
+	Limits    Limits `json:"limits"`
+	Usage     Usage  `json:"usage"`
+	Remaining Limits `json:"remaining"`
+}
+
+// For resolves the limits of a user. Usernames match case insensitively, as GitHub's do.
+func For(cfg config.QuotasConfig, username string, teams []string) Limits {
+	var user *config.QuotaLimits
+	for name, limits := range cfg.Users {
+		if strings.EqualFold(name, username) {
+			user = &limits
+			break
+		}
+	}
+	var teamLimits []config.QuotaLimits
+	for _, team := range teams {
+		if limits, ok := cfg.Teams[team]; ok {
+			teamLimits = append(teamLimits, limits)
+		}
+	}
+
+	return Limits{
+		Teamspaces:   resolve(cfg.Default, user, teamLimits, func(l config.QuotaLimits) *int { return l.Teamspaces }),
+		Nodes:        resolve(cfg.Default, user, teamLimits, func(l config.QuotaLimits) *int { return l.Nodes }),
+		ClusterHours: resolve(cfg.Default, user, teamLimits, func(l config.QuotaLimits) *float64 { return l.ClusterHours }),
+	}
+}
+
+// resolve picks a single limit from the user override, the most generous team or the default
+func resolve[T int | float64](defaults config.QuotaLimits, user *config.QuotaLimits, teams []config.QuotaLimits, limit func(config.QuotaLimits) *T) *T {
+	if user != nil && limit(*user) != nil {
+		return unlimitedIfNegative(limit(*user))
+	}
+
+	var best *T
+	for _, team := range teams {
+		value := limit(team)
+		if value == nil {
+			continue
+		}
+		if *value < 0 {
+			return nil
+		}
+		if best == nil || *value > *best {
+			best = value
+		}
+	}
+	if best != nil {
+		return best
+	}
+
+	return unlimitedIfNegative(limit(defaults))
+}
+
+func unlimitedIfNegative[T int | float64](value *T) *T {
+	if value == nil || *value < 0 {
+		return nil
+	}
+	v := *value
+	return &v
+}
+
+// Check returns ErrExceeded if granting the request on top of the usage goes over a limit
+func (l Limits) Check(usage, requested Usage) error {
+	total := usage.Add(requested)
+	if requested.Teamspaces > 0 && l.Teamspaces != nil && total.Teamspaces > *l.Teamspaces {
+		return fmt.Errorf("%w: maximum number of teamspaces (%d) reached", ErrExceeded, *l.Teamspaces)
+	}
+	if requested.Nodes > 0 && l.Nodes != nil && total.Nodes > *l.Nodes {
+		return fmt.Errorf("%w: %d nodes requested, %d of %d nodes left", ErrExceeded, requested.Nodes, max(*l.Nodes-usage.Nodes, 0), *l.Nodes)
+	}
+	if requested.ClusterHours > 0 && l.ClusterHours != nil && total.ClusterHours > *l.ClusterHours {
+		return fmt.Errorf("%w: %.1f cluster-hours requested, %.1f of %.1f cluster-hours left", ErrExceeded, requested.ClusterHours, math.Max(*l.ClusterHours-usage.ClusterHours, 0), *l.ClusterHours)
+	}
+	return nil
+}
+
+// Status returns the limits with the usage and what remains of each limit
+func (l Limits) Status(usage Usage) Status {
+	status := Status{Limits: l, Usage: usage}
+	if l.Teamspaces != nil {
+		remaining := max(*l.Teamspaces-usage.Teamspaces, 0)
+		status.Remaining.Teamspaces = &remaining
+	}
+	if l.Nodes != nil {
+		remaining := max(*l.Nodes-usage.Nodes, 0)
+		status.Remaining.Nodes = &remaining
+	}
+	if l.ClusterHours != nil {
+		remaining := math.Max(*l.ClusterHours-usage.ClusterHours, 0)
+		status.Remaining.ClusterHours = &remaining
+	}
+	return status
+}
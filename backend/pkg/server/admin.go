@@ -0,0 +1,266 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/audit"
+	"github.com/teamspace-app/backend/pkg/kubernetes"
+	"github.com/teamspace-app/backend/pkg/quota"
+)
+
+// handleAdminListTeamspaces lists the teamspaces of every owner, filtered by the owner, release,
+// phase, minAge and maxAge query parameters
+func (s *Server) handleAdminListTeamspaces(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := kubernetes.TeamspaceFilter{
+		Owner:   query.Get("owner"),
+		Cluster: query.Get("cluster"),
+		Release: query.Get("release"),
+		Phase:   v1alpha1.TeamspacePhase(query.Get("phase")),
+	}
+	for param, age := range map[string]*time.Duration{"minAge": &filter.MinAge, "maxAge": &filter.MaxAge} {
+		if value := query.Get(param); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration < 0 {
+				slog.WarnContext(r.Context(), "Invalid filter", "param", param, "value", value)
+				http.Error(w, fmt.Sprintf("Invalid %s, expected a duration such as \"24h\"", param), http.StatusBadRequest)
+				return
+			}
+			*age = duration
+		}
+	}
+
+	teamspaces, err := s.teamspaces.FilterTeamspaces(filter)
+	if errors.Is(err, kubernetes.ErrCacheNotSynced) {
+		cacheNotSynced(w)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list teamspaces", "error", err)
+		http.Error(w, "Unable to list teamspaces: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Listing teamspaces of every owner", "count", len(teamspaces), "filter", filter)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(teamspaces); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminDeleteTeamspace force deletes a teamspace of any owner
+func (s *Server) handleAdminDeleteTeamspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	slog.InfoContext(r.Context(), "Force deleting teamspace", "teamspace", id)
+
+	err := s.teamspaces.ForceDeleteTeamspace(id, r.URL.Query().Get("cluster"))
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrUnknownCluster) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to force delete teamspace", "teamspace", id, "error", err)
+		http.Error(w, "Failed to delete teamspace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Teamspace force deleted", "teamspace", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminTransferTeamspace makes another user the owner of a teamspace
+func (s *Server) handleAdminTransferTeamspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var data struct {
+		Owner string `json:"owner"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		slog.WarnContext(r.Context(), "Failed to decode request body", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.auth.ValidUsername(data.Owner) {
+		http.Error(w, fmt.Sprintf("%q is not a valid username", data.Owner), http.StatusBadRequest)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Transferring teamspace as an admin", "teamspace", id, "to", data.Owner)
+	audit.SetDetail(r.Context(), fmt.Sprintf("to %s", data.Owner))
+
+	teamspace, err := s.teamspaces.TransferTeamspace(id, r.URL.Query().Get("cluster"), data.Owner)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrUnknownCluster) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrInvalidOwner) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrTeamspaceExists) || errors.Is(err, kubernetes.ErrInvalidState) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		slog.InfoContext(r.Context(), "Recipient is over quota", "teamspace", id, "to", data.Owner, "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to transfer teamspace", "teamspace", id, "to", data.Owner, "error", err)
+		http.Error(w, "Failed to transfer teamspace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(teamspace); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleAdminListQuotaOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := s.teamspaces.QuotaOverrides()
+	if errors.Is(err, kubernetes.ErrCacheNotSynced) {
+		cacheNotSynced(w)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list quota overrides", "error", err)
+		http.Error(w, "Unable to list quota overrides: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(overrides); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminSetQuotaOverride overrides the configured limits of a user
+func (s *Server) handleAdminSetQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var override kubernetes.QuotaOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		slog.WarnContext(r.Context(), "Failed to decode request body", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	override.Username = vars["username"]
+	if !s.auth.ValidUsername(override.Username) {
+		http.Error(w, fmt.Sprintf("%q is not a valid username", override.Username), http.StatusBadRequest)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Overriding quota", "username", override.Username)
+
+	err := s.teamspaces.SetQuotaOverride(override)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to override quota", "username", override.Username, "error", err)
+		http.Error(w, "Failed to set quota override: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(override); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleAdminRemoveQuotaOverride holds a user to their configured limits again
+func (s *Server) handleAdminRemoveQuotaOverride(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	slog.InfoContext(r.Context(), "Removing quota override", "username", vars["username"])
+
+	if err := s.teamspaces.RemoveQuotaOverride(vars["username"]); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to remove quota override", "username", vars["username"], "error", err)
+		http.Error(w, "Failed to remove quota override: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminQueryAudit returns audit records, the most recent first, filtered by the actor,
+// action, since, until and limit query parameters. Times are in RFC 3339.
+func (s *Server) handleAdminQueryAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+	}
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				slog.WarnContext(r.Context(), "Invalid filter", "param", param, "value", value)
+				http.Error(w, fmt.Sprintf("Invalid %s, expected a time such as \"2025-01-02T15:04:05Z\"", param), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit, expected a positive number", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	records, err := s.audit.Query(r.Context(), filter)
+	if errors.Is(err, audit.ErrQueryUnsupported) {
+		http.Error(w, "Audit records can only be queried with a file or events sink", http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to query audit records", "error", err)
+		http.Error(w, "Unable to query audit records: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Querying audit records", "count", len(records), "filter", filter)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(records); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,1021 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/teamspace-app/backend/pkg/audit"
+	"github.com/teamspace-app/backend/pkg/kubernetes"
+	"github.com/teamspace-app/backend/pkg/placement"
+	"github.com/teamspace-app/backend/pkg/quota"
+)
+
+func (s *Server) handleAuthStatus(w http.ResponseWriter, r *http.Request) {
+	isAuth := s.auth.IsAuthenticated(r)
+
+	// Create response object
+	response := map[string]interface{}{
+		"authenticated": isAuth,
+		"provider":      s.auth.ProviderName(),
+	}
+
+	// If authenticated, include username
+	if isAuth {
+		username, ok := s.auth.GetUsername(r)
+		if ok {
+			response["username"] = username
+		}
+		response["admin"] = s.auth.IsAdmin(r)
+	}
+
+	// Set headers
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleGetQuota returns the limits of the caller and how much of them their teamspaces use
+func (s *Server) handleGetQuota(w http.ResponseWriter, r *http.Request) {
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := s.teamspaces.QuotaStatus(username, s.auth.GetTeams(r))
+	if errors.Is(err, kubernetes.ErrCacheNotSynced) {
+		cacheNotSynced(w)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to compute quota usage", "error", err)
+		http.Error(w, "Unable to compute quota usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates := s.teamspaces.ListTemplates()
+	slog.DebugContext(r.Context(), "Listing templates", "count", len(templates))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(templates); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleListClusters(w http.ResponseWriter, r *http.Request) {
+	clusters := s.teamspaces.ListClusters()
+	slog.DebugContext(r.Context(), "Listing clusters", "count", len(clusters))
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(clusters); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleListTeamspaces(w http.ResponseWriter, r *http.Request) {
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// List teamspaces by owner
+	teamspaces, err := s.teamspaces.ListTeamspacesForUser(username)
+	if errors.Is(err, kubernetes.ErrCacheNotSynced) {
+		cacheNotSynced(w)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list teamspaces", "error", err)
+		http.Error(w, "Unable to list teamspaces: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Listing teamspaces", "count", len(teamspaces))
+
+	// Set proper headers
+	w.Header().Set("Content-Type", "application/json")
+	// Encode response
+	if err := json.NewEncoder(w).Encode(teamspaces); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// watchHeartbeatInterval keeps idle event streams from being closed by proxies
+const watchHeartbeatInterval = 20 * time.Second
+
+// handleWatchTeamspaces streams changes to the caller's teamspaces as Server-Sent Events. The id of
+// each event is the resource version to resume from, which browsers send back as Last-Event-ID when
+// they reconnect.
+func (s *Server) handleWatchTeamspaces(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	resourceVersion := r.Header.Get("Last-Event-ID")
+	if resourceVersion == "" {
+		resourceVersion = r.URL.Query().Get("resourceVersion")
+	}
+
+	slog.InfoContext(r.Context(), "Streaming teamspaces", "resource_version", resourceVersion)
+
+	events, err := s.teamspaces.WatchTeamspaces(r.Context(), username, resourceVersion)
+	if errors.Is(err, kubernetes.ErrCacheNotSynced) {
+		cacheNotSynced(w)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to start watch", "error", err)
+		http.Error(w, "Unable to watch teamspaces: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "Failed to clear the write deadline of the watch", "error", err)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.ErrorContext(r.Context(), "Streaming is not supported", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.InfoContext(r.Context(), "Watch client disconnected")
+			return
+		case <-s.shuttingDown:
+			// The browser reconnects, to another replica, from the last event it received
+			slog.InfoContext(r.Context(), "Watch ended by shutdown")
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				slog.InfoContext(r.Context(), "Watch ended")
+				return
+			}
+			if err := writeTeamspaceEvent(w, event); err != nil {
+				slog.WarnContext(r.Context(), "Failed to write watch event", "error", err)
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeTeamspaceEvent writes a single Server-Sent Event. Bookmarks carry no data and only
+// advance the id the client resumes from.
+func writeTeamspaceEvent(w io.Writer, event kubernetes.TeamspaceEvent) error {
+	if event.Type == kubernetes.TeamspaceBookmark {
+		_, err := fmt.Fprintf(w, "id: %s\n\n", event.ResourceVersion)
+		return err
+	}
+
+	data := []byte("{}")
+	if event.Teamspace != nil {
+		var err error
+		if data, err = json.Marshal(event.Teamspace); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ResourceVersion, event.Type, data)
+	return err
+}
+
+func (s *Server) handleCreateTeamspace(w http.ResponseWriter, r *http.Request) {
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	var data struct {
+		Name                        string `json:"name"`
+		InitialHostedClusterRelease string `json:"initialHostedClusterRelease"`
+		FeatureSet                  string `json:"featureSet"`
+		Template                    string `json:"template"`
+		Cluster                     string `json:"cluster"`
+		Region                      string `json:"region"`
+		TTL                         string `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		slog.WarnContext(r.Context(), "Failed to decode request body", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "Creating teamspace", "name", data.Name, "release", data.InitialHostedClusterRelease, "template", data.Template, "cluster", data.Cluster, "ttl", data.TTL)
+
+	if data.Name == "" {
+		http.Error(w, "Teamspace name cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if data.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(data.TTL); err != nil {
+			http.Error(w, "Invalid ttl, expected a duration such as \"72h\"", http.StatusBadRequest)
+			return
+		}
+	}
+
+	teamspace, err := s.teamspaces.CreateTeamspace(data.Name, username, s.auth.GetTeams(r), data.InitialHostedClusterRelease, data.FeatureSet, data.Template, data.Cluster, data.Region, ttl)
+	if errors.Is(err, kubernetes.ErrInvalidTTL) || errors.Is(err, kubernetes.ErrUnknownTemplate) || errors.Is(err, kubernetes.ErrUnknownCluster) || errors.Is(err, kubernetes.ErrInvalidName) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrTeamspaceExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		slog.InfoContext(r.Context(), "User is over quota", "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, placement.ErrNoCluster) {
+		slog.WarnContext(r.Context(), "No cluster can take the teamspace", "region", data.Region, "error", err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create teamspace", "error", err)
+		http.Error(w, "Failed to create teamspace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Teamspace created", "teamspace", teamspace.ID, "name", teamspace.Name, "cluster", teamspace.Cluster)
+	audit.SetTarget(r.Context(), teamspace.ID)
+	// Set proper headers
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	// Encode response
+	if err := json.NewEncoder(w).Encode(teamspace); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleGetTeamspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	// The cluster picks a teamspace whose ID exists in several clusters
+	cluster := r.URL.Query().Get("cluster")
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Check the user's role on the teamspace
+	role, err := s.teamspaces.TeamspaceRole(id, cluster, username)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrUnknownCluster) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !role.AtLeast(kubernetes.RoleViewer) {
+		slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleViewer)
+		http.Error(w, "You don't have permission to view this teamspace", http.StatusForbidden)
+		return
+	}
+
+	teamspace, err := s.teamspaces.GetTeamspace(id, cluster)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get teamspace", "teamspace", id, "error", err)
+		http.Error(w, "Failed to get teamspace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	teamspace.Role = role
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(teamspace); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleDeleteTeamspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	// The cluster picks a teamspace whose ID exists in several clusters
+	cluster := r.URL.Query().Get("cluster")
+
+	if id == "" {
+		http.Error(w, "Teamspace ID cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Check the user's role on the teamspace
+	role, err := s.teamspaces.TeamspaceRole(id, cluster, username)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrUnknownCluster) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !role.AtLeast(kubernetes.RoleAdmin) {
+		slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleAdmin)
+		http.Error(w, "You don't have permission to delete this teamspace", http.StatusForbidden)
+		return
+	}
+
+	err = s.teamspaces.DeleteTeamspace(id, cluster)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete teamspace", "teamspace", id, "error", err)
+		http.Error(w, "Failed to delete teamspace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Teamspace deleted", "teamspace", id)
+	// Set headers
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleExtendTeamspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Check the user's role on the teamspace
+	role, err := s.teamspaces.TeamspaceRole(id, "", username)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !role.AtLeast(kubernetes.RoleEditor) {
+		slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleEditor)
+		http.Error(w, "You don't have permission to extend this teamspace", http.StatusForbidden)
+		return
+	}
+
+	// The body is optional; without a ttl the teamspace is extended by the default ttl
+	var data struct {
+		TTL string `json:"ttl"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil && err != io.EOF {
+			slog.WarnContext(r.Context(), "Failed to decode request body", "error", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var ttl time.Duration
+	if data.TTL != "" {
+		if ttl, err = time.ParseDuration(data.TTL); err != nil {
+			http.Error(w, "Invalid ttl, expected a duration such as \"24h\"", http.StatusBadRequest)
+			return
+		}
+	}
+
+	teamspace, err := s.teamspaces.ExtendTeamspace(id, ttl, username, s.auth.GetTeams(r))
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrInvalidTTL) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		slog.InfoContext(r.Context(), "Owner is over quota", "teamspace", id, "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to extend teamspace", "teamspace", id, "error", err)
+		http.Error(w, "Failed to extend teamspace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	teamspace.Role = role
+
+	slog.InfoContext(r.Context(), "Teamspace extended", "teamspace", id, "expires_at", teamspace.ExpiresAt)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(teamspace); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleHibernateTeamspace(w http.ResponseWriter, r *http.Request) {
+	s.handlePowerTransition(w, r, "hibernate", s.teamspaces.HibernateTeamspace)
+}
+
+func (s *Server) handleResumeTeamspace(w http.ResponseWriter, r *http.Request) {
+	s.handlePowerTransition(w, r, "resume", s.teamspaces.ResumeTeamspace)
+}
+
+// handlePowerTransition hibernates or resumes a teamspace on behalf of an editor
+func (s *Server) handlePowerTransition(w http.ResponseWriter, r *http.Request, action string, transition func(string) (*kubernetes.Teamspace, error)) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Check the user's role on the teamspace
+	role, err := s.teamspaces.TeamspaceRole(id, "", username)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !role.AtLeast(kubernetes.RoleEditor) {
+		slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleEditor)
+		http.Error(w, fmt.Sprintf("You don't have permission to %s this teamspace", action), http.StatusForbidden)
+		return
+	}
+
+	teamspace, err := transition(id)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrInvalidState) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to "+action+" teamspace", "teamspace", id, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to %s teamspace: %v", action, err), http.StatusInternalServerError)
+		return
+	}
+	teamspace.Role = role
+
+	slog.InfoContext(r.Context(), "Teamspace power transition requested", "teamspace", id, "action", action)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(teamspace); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+	}
+}
+
+func (s *Server) handleSetCollaborator(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	collaborator := vars["username"]
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Check the user's role on the teamspace
+	role, err := s.teamspaces.TeamspaceRole(id, "", username)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !role.AtLeast(kubernetes.RoleAdmin) {
+		slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleAdmin)
+		http.Error(w, "You don't have permission to share this teamspace", http.StatusForbidden)
+		return
+	}
+
+	var data struct {
+		Role kubernetes.Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		slog.WarnContext(r.Context(), "Failed to decode request body", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !s.auth.ValidUsername(collaborator) {
+		http.Error(w, fmt.Sprintf("%q is not a valid username", collaborator), http.StatusBadRequest)
+		return
+	}
+
+	audit.SetDetail(r.Context(), fmt.Sprintf("role: %s", data.Role))
+	teamspace, err := s.teamspaces.SetCollaborator(id, collaborator, data.Role)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrInvalidCollaborator) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrInvalidState) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to set collaborator", "teamspace", id, "collaborator", collaborator, "error", err)
+		http.Error(w, "Failed to share teamspace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	teamspace.Role = role
+
+	slog.InfoContext(r.Context(), "Teamspace shared", "teamspace", id, "collaborator", collaborator, "role", data.Role)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(teamspace); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleRemoveCollaborator(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	collaborator := vars["username"]
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Check the user's role on the teamspace
+	role, err := s.teamspaces.TeamspaceRole(id, "", username)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Collaborators may always leave a teamspace on their own
+	leaving := role != kubernetes.RoleNone && strings.EqualFold(username, collaborator)
+	if !leaving && !role.AtLeast(kubernetes.RoleAdmin) {
+		slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleAdmin)
+		http.Error(w, "You don't have permission to manage the collaborators of this teamspace", http.StatusForbidden)
+		return
+	}
+
+	if _, err := s.teamspaces.RemoveCollaborator(id, collaborator); err != nil {
+		if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+			http.Error(w, "Teamspace not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, kubernetes.ErrInvalidCollaborator) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, kubernetes.ErrInvalidState) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to remove collaborator", "teamspace", id, "collaborator", collaborator, "error", err)
+		http.Error(w, "Failed to remove collaborator: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Collaborator removed", "teamspace", id, "collaborator", collaborator)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTransferTeamspace offers a teamspace to a new owner, who must accept it. Admins can pass
+// force to transfer it straight away.
+func (s *Server) handleTransferTeamspace(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	var data struct {
+		To    string `json:"to"`
+		Force bool   `json:"force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		slog.WarnContext(r.Context(), "Failed to decode request body", "error", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !s.auth.ValidUsername(data.To) {
+		http.Error(w, fmt.Sprintf("%q is not a valid username", data.To), http.StatusBadRequest)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Transferring teamspace", "teamspace", id, "to", data.To, "force", data.Force)
+	audit.SetDetail(r.Context(), fmt.Sprintf("to %s, force: %v", data.To, data.Force))
+
+	var teamspace *kubernetes.Teamspace
+	var err error
+	if data.Force {
+		// Forcing skips the acceptance of the new owner, so it is reserved to admins
+		if !s.auth.IsAdmin(r) {
+			slog.WarnContext(r.Context(), "User is not an admin and cannot force a transfer", "teamspace", id)
+			http.Error(w, "You must be an admin to force a transfer", http.StatusForbidden)
+			return
+		}
+		teamspace, err = s.teamspaces.TransferTeamspace(id, "", data.To)
+	} else {
+		// Check the user's role on the teamspace
+		role, roleErr := s.teamspaces.TeamspaceRole(id, "", username)
+		if errors.Is(roleErr, kubernetes.ErrTeamspaceNotFound) {
+			http.Error(w, "Teamspace not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(roleErr, kubernetes.ErrAmbiguousTeamspace) {
+			http.Error(w, roleErr.Error(), http.StatusConflict)
+			return
+		}
+		if roleErr != nil {
+			slog.ErrorContext(r.Context(), "Failed to check access", "error", roleErr)
+			http.Error(w, "Failed to check teamspace access: "+roleErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !role.AtLeast(kubernetes.RoleOwner) {
+			slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleOwner)
+			http.Error(w, "Only the owner can transfer this teamspace", http.StatusForbidden)
+			return
+		}
+		teamspace, err = s.teamspaces.RequestTransfer(id, username, data.To)
+	}
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrInvalidOwner) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrTeamspaceExists) || errors.Is(err, kubernetes.ErrInvalidState) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		slog.InfoContext(r.Context(), "Recipient is over quota", "teamspace", id, "to", data.To, "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to transfer teamspace", "teamspace", id, "to", data.To, "error", err)
+		http.Error(w, "Failed to transfer teamspace: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusAccepted
+	if data.Force {
+		status = http.StatusOK
+	} else {
+		teamspace.Role = kubernetes.RoleOwner
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(teamspace); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+	}
+}
+
+// handleAcceptTransfer makes the caller the owner of a teamspace offered to them
+func (s *Server) handleAcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Only the recipient of the transfer can accept it
+	recipient, err := s.teamspaces.TransferRecipient(id)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !strings.EqualFold(recipient, username) {
+		slog.InfoContext(r.Context(), "Teamspace is not being transferred to the user", "teamspace", id)
+		http.Error(w, "This teamspace is not being transferred to you", http.StatusForbidden)
+		return
+	}
+
+	teamspace, err := s.teamspaces.AcceptTransfer(id, username, s.auth.GetTeams(r))
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrTeamspaceExists) || errors.Is(err, kubernetes.ErrInvalidState) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		slog.InfoContext(r.Context(), "User is over quota", "teamspace", id, "error", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to accept transfer", "teamspace", id, "error", err)
+		http.Error(w, "Failed to accept transfer: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	teamspace.Role = kubernetes.RoleOwner
+
+	slog.InfoContext(r.Context(), "Transfer accepted", "teamspace", id)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(teamspace); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleCancelTransfer lets the owner withdraw a pending transfer, or the recipient decline it
+func (s *Server) handleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Check the user's role on the teamspace
+	role, err := s.teamspaces.TeamspaceRole(id, "", username)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recipient, err := s.teamspaces.TransferRecipient(id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	declining := recipient != "" && strings.EqualFold(recipient, username)
+	if !declining && !role.AtLeast(kubernetes.RoleOwner) {
+		slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleOwner)
+		http.Error(w, "You don't have permission to cancel the transfer of this teamspace", http.StatusForbidden)
+		return
+	}
+
+	if _, err := s.teamspaces.CancelTransfer(id); err != nil {
+		if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+			http.Error(w, "Teamspace not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, kubernetes.ErrInvalidState) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to cancel transfer", "teamspace", id, "error", err)
+		http.Error(w, "Failed to cancel transfer: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Transfer cancelled", "teamspace", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetKubeconfig(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	// Get the username from session
+	username, ok := s.auth.GetUsername(r)
+	if !ok {
+		slog.WarnContext(r.Context(), "No username found in session")
+		http.Error(w, "Session error: no username", http.StatusUnauthorized)
+		return
+	}
+
+	// Check the user's role on the teamspace
+	role, err := s.teamspaces.TeamspaceRole(id, "", username)
+	if errors.Is(err, kubernetes.ErrTeamspaceNotFound) {
+		http.Error(w, "Teamspace not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, kubernetes.ErrAmbiguousTeamspace) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to check access", "error", err)
+		http.Error(w, "Failed to check teamspace access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !role.AtLeast(kubernetes.RoleEditor) {
+		slog.InfoContext(r.Context(), "Access denied", "teamspace", id, "role", role, "required", kubernetes.RoleEditor)
+		http.Error(w, "You don't have permission to access this teamspace's kubeconfig", http.StatusForbidden)
+		return
+	}
+
+	config, err := s.teamspaces.GetKubeconfig(id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get kubeconfig", "teamspace", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Kubeconfig downloaded", "teamspace", id)
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Content-Disposition", "attachment; filename=kubeconfig.yaml")
+	w.Write(config)
+}
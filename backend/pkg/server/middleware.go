@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/teamspace-app/backend/pkg/audit"
+	"github.com/teamspace-app/backend/pkg/logging"
+	"github.com/teamspace-app/backend/pkg/metrics"
+)
+
+// Logging response writer to capture status code
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (lrw *loggingResponseWriter) WriteHeader(code int) {
+	lrw.statusCode = code
+	lrw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush event streams
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+// CORS middleware
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Get the origin from the request header
+		origin := r.Header.Get("Origin")
+		if strings.HasPrefix(origin, "http://localhost:") || strings.HasPrefix(origin, "https://localhost:") {
+			// Allow any localhost origin as a fallback for development
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			slog.DebugContext(r.Context(), "Handling preflight request", "origin", origin)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDKey holds the ID of the request in its context
+type requestIDKey struct{}
+
+// Request logger middleware: gives the request an ID, returned in the X-Request-ID header, and
+// adds it to every record logged with the request context along with the route and the user
+func (s *Server) requestLoggerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+		ctx = logging.With(ctx, "request_id", requestID, "method", r.Method, "route", routeTemplate(r))
+		if username, ok := s.auth.GetUsername(r); ok {
+			ctx = logging.With(ctx, "user", username)
+		}
+		r = r.WithContext(ctx)
+
+		// Create a response writer wrapper to capture status code
+		lrw := &loggingResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		next.ServeHTTP(lrw, r)
+
+		// Probes come every few seconds and would drown the other requests
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			level = slog.LevelDebug
+		}
+		slog.Log(ctx, level, "Request handled", "path", r.URL.Path, "status", lrw.statusCode, "duration", time.Since(start))
+	})
+}
+
+// routeTemplate returns the template of the route that matched the request, such as
+// /api/teamspaces/{id}
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+// Metrics middleware: counts requests and their latency by route template, so teamspace IDs
+// don't make a series each
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeTemplate(r)
+
+		lrw := &loggingResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		next.ServeHTTP(lrw, r)
+
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(lrw.statusCode)).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Authentication middleware
+func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Skip auth check only for login, callback, and status endpoints
+		if r.URL.Path == "/auth/login" || r.URL.Path == "/auth/callback" || r.URL.Path == "/auth/status" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Strict authentication check - no bypasses for any environment
+		if !s.auth.IsAuthenticated(r) {
+			slog.InfoContext(r.Context(), "User is not authenticated, access denied")
+			if r.URL.Path == "/" {
+				http.Redirect(w, r, "/auth/login", http.StatusTemporaryRedirect)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Audit middleware: records who did what to which teamspace, and how it ended, for every request
+// to the route. Handlers add what only they know, such as the ID of a new teamspace, through the
+// audit package.
+func (s *Server) auditMiddleware(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID, _ := r.Context().Value(requestIDKey{}).(string)
+
+		vars := mux.Vars(r)
+		record := &audit.Record{
+			Time:         time.Now(),
+			RequestID:    requestID,
+			Action:       action,
+			Target:       strings.Trim(vars["id"]+"/"+vars["username"], "/"),
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			SourceIP:     sourceIP(r),
+			ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		}
+		// Read before the handler runs, as logging out clears the session
+		record.Actor, _ = s.auth.GetUsername(r)
+
+		lrw := &loggingResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(lrw, r.WithContext(audit.NewContext(r.Context(), record)))
+
+		record.Status = lrw.statusCode
+		record.Outcome = audit.OutcomeOf(lrw.statusCode)
+		s.audit.Record(*record)
+	}
+}
+
+// newRequestID returns a random ID for requests that did not come with one
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// sourceIP returns the address of the peer, without its port
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Admin middleware: admin routes act on teamspaces of any owner, so they are authorized by
+// membership of an admin team instead of the caller's role on the teamspace
+func (s *Server) adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.auth.IsAdmin(r) {
+			slog.WarnContext(r.Context(), "User is not an admin, access denied")
+			http.Error(w, "You must be an admin to do this", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Cache readiness middleware: teamspace reads are served from informers, so
+// refuse them until the informers have synced instead of returning partial data
+func (s *Server) cacheSyncMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.teamspaces.HasSynced() {
+			slog.WarnContext(r.Context(), "Teamspace cache is not synced yet, rejecting request")
+			cacheNotSynced(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// cacheNotSynced asks the client to retry once the cache has synced, for the routes that are
+// not behind cacheSyncMiddleware and reads that find the cache unsynced
+func cacheNotSynced(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, "Teamspace cache is warming up, please retry shortly", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/teamspace-app/backend/pkg/audit"
+	"github.com/teamspace-app/backend/pkg/auth"
+	"github.com/teamspace-app/backend/pkg/health"
+	"github.com/teamspace-app/backend/pkg/kubernetes"
+	"github.com/teamspace-app/backend/pkg/quota"
+)
+
+// TeamspaceStore is what the handlers need of the teamspaces, implemented by
+// kubernetes.TeamspaceManager
+type TeamspaceStore interface {
+	HasSynced() bool
+
+	ListTemplates() []kubernetes.Template
+	ListClusters() []kubernetes.Cluster
+	QuotaStatus(username string, teams []string) (quota.Status, error)
+
+	ListTeamspacesForUser(username string) ([]*kubernetes.Teamspace, error)
+	WatchTeamspaces(ctx context.Context, username string, resourceVersion string) (<-chan kubernetes.TeamspaceEvent, error)
+	GetTeamspace(name string, clusterName string) (*kubernetes.Teamspace, error)
+	TeamspaceRole(name string, clusterName string, username string) (kubernetes.Role, error)
+	CreateTeamspace(name string, owner string, teams []string, initialHostedClusterRelease string, featureSet string, templateName string, clusterName string, region string, ttl time.Duration) (*kubernetes.Teamspace, error)
+	DeleteTeamspace(name string, clusterName string) error
+	ExtendTeamspace(name string, ttl time.Duration, username string, teams []string) (*kubernetes.Teamspace, error)
+	HibernateTeamspace(name string) (*kubernetes.Teamspace, error)
+	ResumeTeamspace(name string) (*kubernetes.Teamspace, error)
+	GetKubeconfig(name string) ([]byte, error)
+
+	SetCollaborator(name string, username string, role kubernetes.Role) (*kubernetes.Teamspace, error)
+	RemoveCollaborator(name string, username string) (*kubernetes.Teamspace, error)
+
+	RequestTransfer(name string, requestedBy string, to string) (*kubernetes.Teamspace, error)
+	TransferRecipient(name string) (string, error)
+	AcceptTransfer(name string, username string, teams []string) (*kubernetes.Teamspace, error)
+	CancelTransfer(name string) (*kubernetes.Teamspace, error)
+
+	FilterTeamspaces(filter kubernetes.TeamspaceFilter) ([]*kubernetes.Teamspace, error)
+	ForceDeleteTeamspace(name string, clusterName string) error
+	TransferTeamspace(name string, clusterName string, owner string) (*kubernetes.Teamspace, error)
+	QuotaOverrides() ([]kubernetes.QuotaOverride, error)
+	SetQuotaOverride(override kubernetes.QuotaOverride) error
+	RemoveQuotaOverride(username string) error
+}
+
+var _ TeamspaceStore = (*kubernetes.TeamspaceManager)(nil)
+
+// Server serves the API, the auth routes, the probes and the frontend
+type Server struct {
+	auth       *auth.AuthHandler
+	teamspaces TeamspaceStore
+	audit      *audit.Logger
+	checker    *health.Checker
+
+	// shuttingDown is closed when the server starts shutting down, to end the event streams
+	// that would otherwise hold the shutdown up until its deadline
+	shuttingDown chan struct{}
+	shutDownOnce sync.Once
+}
+
+// New creates a server over its dependencies
+func New(authHandler *auth.AuthHandler, teamspaces TeamspaceStore, auditLogger *audit.Logger, checker *health.Checker) *Server {
+	return &Server{
+		auth:         authHandler,
+		teamspaces:   teamspaces,
+		audit:        auditLogger,
+		checker:      checker,
+		shuttingDown: make(chan struct{}),
+	}
+}
+
+// ShutDown ends the event streams, which http.Server.Shutdown would otherwise wait for
+func (s *Server) ShutDown() {
+	s.shutDownOnce.Do(func() { close(s.shuttingDown) })
+}
+
+// Handler returns the routes of the server, with the frontend served from frontendPath
+func (s *Server) Handler(frontendPath string) http.Handler {
+	r := mux.NewRouter()
+
+	// Apply middlewares to the main router
+	r.Use(s.requestLoggerMiddleware)
+	r.Use(corsMiddleware)
+	r.Use(metricsMiddleware)
+
+	// Probes of the kubelet
+	r.HandleFunc("/healthz", s.checker.HandleLiveness).Methods("GET")
+	r.HandleFunc("/readyz", s.checker.HandleReadiness).Methods("GET")
+
+	// Auth routes. Logins, logouts and the requests that change something or hand out
+	// credentials are audited; reads and polls are not.
+	r.HandleFunc("/auth/login", s.auth.HandleLogin)
+	r.HandleFunc("/auth/callback", s.auditMiddleware("auth.login", s.auth.HandleCallback))
+	r.HandleFunc("/auth/logout", s.auditMiddleware("auth.logout", s.auth.HandleLogout))
+	r.HandleFunc("/auth/status", s.handleAuthStatus)
+
+	// Protected routes
+	apiRouter := r.PathPrefix("/api").Subrouter()
+
+	// Ensure OPTIONS method is handled for API endpoints
+	apiRouter.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	apiRouter.HandleFunc("/me/quota", s.authMiddleware(s.cacheSyncMiddleware(s.handleGetQuota))).Methods("GET")
+	apiRouter.HandleFunc("/templates", s.authMiddleware(s.handleListTemplates)).Methods("GET")
+	apiRouter.HandleFunc("/clusters", s.authMiddleware(s.handleListClusters)).Methods("GET")
+	apiRouter.HandleFunc("/teamspaces", s.authMiddleware(s.cacheSyncMiddleware(s.handleListTeamspaces))).Methods("GET")
+	apiRouter.HandleFunc("/teamspaces", s.auditMiddleware("teamspace.create", s.authMiddleware(s.cacheSyncMiddleware(s.handleCreateTeamspace)))).Methods("POST")
+	// Registered before /teamspaces/{id} so "watch" is not taken for a teamspace name
+	apiRouter.HandleFunc("/teamspaces/watch", s.authMiddleware(s.cacheSyncMiddleware(s.handleWatchTeamspaces))).Methods("GET")
+	apiRouter.HandleFunc("/teamspaces/{id}", s.authMiddleware(s.cacheSyncMiddleware(s.handleGetTeamspace))).Methods("GET")
+	apiRouter.HandleFunc("/teamspaces/{id}", s.auditMiddleware("teamspace.delete", s.authMiddleware(s.cacheSyncMiddleware(s.handleDeleteTeamspace)))).Methods("DELETE")
+	apiRouter.HandleFunc("/teamspaces/{id}/extend", s.auditMiddleware("teamspace.extend", s.authMiddleware(s.cacheSyncMiddleware(s.handleExtendTeamspace)))).Methods("POST")
+	apiRouter.HandleFunc("/teamspaces/{id}/hibernate", s.auditMiddleware("teamspace.hibernate", s.authMiddleware(s.cacheSyncMiddleware(s.handleHibernateTeamspace)))).Methods("POST")
+	apiRouter.HandleFunc("/teamspaces/{id}/resume", s.auditMiddleware("teamspace.resume", s.authMiddleware(s.cacheSyncMiddleware(s.handleResumeTeamspace)))).Methods("POST")
+	apiRouter.HandleFunc("/teamspaces/{id}/collaborators/{username}", s.auditMiddleware("collaborator.set", s.authMiddleware(s.cacheSyncMiddleware(s.handleSetCollaborator)))).Methods("PUT")
+	apiRouter.HandleFunc("/teamspaces/{id}/collaborators/{username}", s.auditMiddleware("collaborator.remove", s.authMiddleware(s.cacheSyncMiddleware(s.handleRemoveCollaborator)))).Methods("DELETE")
+	apiRouter.HandleFunc("/teamspaces/{id}/transfer", s.auditMiddleware("transfer.request", s.authMiddleware(s.cacheSyncMiddleware(s.handleTransferTeamspace)))).Methods("POST")
+	apiRouter.HandleFunc("/teamspaces/{id}/transfer", s.auditMiddleware("transfer.cancel", s.authMiddleware(s.cacheSyncMiddleware(s.handleCancelTransfer)))).Methods("DELETE")
+	apiRouter.HandleFunc("/teamspaces/{id}/transfer/accept", s.auditMiddleware("transfer.accept", s.authMiddleware(s.cacheSyncMiddleware(s.handleAcceptTransfer)))).Methods("POST")
+	apiRouter.HandleFunc("/teamspaces/{id}/kubeconfig", s.auditMiddleware("kubeconfig.download", s.authMiddleware(s.cacheSyncMiddleware(s.handleGetKubeconfig))))
+
+	// Admin routes
+	apiRouter.HandleFunc("/admin/teamspaces", s.authMiddleware(s.adminMiddleware(s.cacheSyncMiddleware(s.handleAdminListTeamspaces)))).Methods("GET")
+	apiRouter.HandleFunc("/admin/teamspaces/{id}", s.auditMiddleware("admin.teamspace.delete", s.authMiddleware(s.adminMiddleware(s.cacheSyncMiddleware(s.handleAdminDeleteTeamspace))))).Methods("DELETE")
+	apiRouter.HandleFunc("/admin/teamspaces/{id}/owner", s.auditMiddleware("admin.teamspace.transfer", s.authMiddleware(s.adminMiddleware(s.cacheSyncMiddleware(s.handleAdminTransferTeamspace))))).Methods("PUT")
+	apiRouter.HandleFunc("/admin/quotas", s.authMiddleware(s.adminMiddleware(s.handleAdminListQuotaOverrides))).Methods("GET")
+	apiRouter.HandleFunc("/admin/quotas/{username}", s.auditMiddleware("admin.quota.set", s.authMiddleware(s.adminMiddleware(s.handleAdminSetQuotaOverride)))).Methods("PUT")
+	apiRouter.HandleFunc("/admin/quotas/{username}", s.auditMiddleware("admin.quota.remove", s.authMiddleware(s.adminMiddleware(s.handleAdminRemoveQuotaOverride)))).Methods("DELETE")
+	apiRouter.HandleFunc("/admin/audit", s.authMiddleware(s.adminMiddleware(s.handleAdminQueryAudit))).Methods("GET")
+
+	// Root route serving index.html
+	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		// Always serve the frontend without checking auth
+		// The frontend will handle showing login UI if needed
+		http.ServeFile(w, r, frontendPath+"/index.html")
+	})
+
+	// Create a file server for the static files
+	fileServer := http.FileServer(http.Dir(frontendPath))
+
+	// Serve static assets without stripping prefix
+	r.PathPrefix("/assets/").Handler(fileServer)
+
+	// Handle favicon requests
+	r.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, frontendPath+"/favicon.ico")
+	})
+
+	// Serve index.html for all other routes to support SPA routing
+	r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Skip serving frontend for API and auth endpoints
+		if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/auth/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		// Check if the file exists in the dist directory
+		requestedFile := frontendPath + r.URL.Path
+		_, err := os.Stat(requestedFile)
+		if err == nil {
+			// If the file exists, serve it directly
+			http.ServeFile(w, r, requestedFile)
+			return
+		}
+
+		// For all other routes, serve index.html to support SPA client-side routing
+		http.ServeFile(w, r, frontendPath+"/index.html")
+	})
+
+	return r
+}
@@ -0,0 +1,600 @@
+package server
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/teamspace-app/backend/pkg/apis/teamspace/v1alpha1"
+	"github.com/teamspace-app/backend/pkg/audit"
+	"github.com/teamspace-app/backend/pkg/auth"
+	"github.com/teamspace-app/backend/pkg/config"
+	"github.com/teamspace-app/backend/pkg/health"
+	"github.com/teamspace-app/backend/pkg/kubernetes"
+)
+
+const testConfig = `{
+	"session": {"hash_key": "0123456789abcdef0123456789abcdef", "block_key": "0123456789abcdef0123456789abcdef"},
+	"oauth": {"github_client_id": "client", "github_client_secret": "secret"},
+	"app": {"frontend_url": "/", "github_org": "acme", "allowed_teams": ["dev", "sre"], "admin_teams": ["sre"]},
+	"clusters": [{"name": "default", "denied_teams": ["contractors"]}],
+	"hypershift": {"pull_secret": {"namespace": "teamspaces", "name": "pull-secret"}},
+	"quotas": {"default": {"teamspaces": 1}}
+}`
+
+// githubUsers are the members of the acme org on the fake GitHub, with their teams
+var githubUsers = map[string][]string{
+	"alice":   {"dev"},
+	"bob":     {"dev"},
+	"olivia":  {"sre"},
+	"charlie": {"dev", "contractors"},
+	"mallory": {"marketing"},
+}
+
+// newFakeGitHub serves the OAuth and API endpoints of GitHub the login goes through. The code
+// and the access token of a login are both the username it logs in.
+func newFakeGitHub(t *testing.T) *httptest.Server {
+	router := http.NewServeMux()
+	router.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": r.FormValue("code"), "token_type": "bearer"})
+	})
+	router.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"login": strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")})
+	})
+	router.HandleFunc("GET /orgs/acme/members/{username}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := githubUsers[r.PathValue("username")]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	router.HandleFunc("GET /user/teams", func(w http.ResponseWriter, r *http.Request) {
+		type team struct {
+			Name string `json:"name"`
+			Org  struct {
+				Login string `json:"login"`
+			} `json:"organization"`
+		}
+		teams := []team{}
+		for _, name := range githubUsers[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+			t := team{Name: name}
+			t.Org.Login = "acme"
+			teams = append(teams, t)
+		}
+		json.NewEncoder(w).Encode(teams)
+	})
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// oidcUsers are the users of the fake OIDC issuer, with their groups
+var oidcUsers = map[string][]string{
+	"jane@example.com":     {"dev"},
+	"john.doe@example.com": {"dev"},
+	"ops@example.com":      {"/sre"},
+}
+
+// newFakeIssuer serves the discovery document, the signing keys and the token endpoint of an
+// OIDC provider. The code of a login is the username and the nonce it logs in with.
+func newFakeIssuer(t *testing.T) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := http.NewServeMux()
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	router.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                server.URL,
+			"authorization_endpoint":                server.URL + "/auth",
+			"token_endpoint":                        server.URL + "/token",
+			"jwks_uri":                              server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	router.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	router.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		login, err := url.ParseQuery(r.FormValue("code"))
+		if err != nil {
+			http.Error(w, "invalid code", http.StatusBadRequest)
+			return
+		}
+		username := login.Get("username")
+		claims, _ := json.Marshal(map[string]any{
+			"iss":                server.URL,
+			"aud":                "teamspace",
+			"sub":                username,
+			"iat":                time.Now().Unix(),
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"nonce":              login.Get("nonce"),
+			"preferred_username": username,
+			"groups":             oidcUsers[username],
+		})
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "token",
+			"token_type":   "Bearer",
+			"id_token":     signed + "." + base64.RawURLEncoding.EncodeToString(signature),
+		})
+	})
+	return server
+}
+
+// validateMetadata refuses to store objects with a name, labels or ConfigMap keys the API server
+// would refuse, which the fake clients take as they are
+func validateMetadata(action k8stesting.Action) (bool, runtime.Object, error) {
+	write, ok := action.(interface{ GetObject() runtime.Object })
+	if !ok {
+		return false, nil, nil
+	}
+	obj, err := meta.Accessor(write.GetObject())
+	if err != nil {
+		return false, nil, nil
+	}
+	errs := validation.IsDNS1123Subdomain(obj.GetName())
+	for key, value := range obj.GetLabels() {
+		errs = append(errs, validation.IsQualifiedName(key)...)
+		errs = append(errs, validation.IsValidLabelValue(value)...)
+	}
+	if cm, ok := write.GetObject().(*corev1.ConfigMap); ok {
+		for key := range cm.Data {
+			errs = append(errs, validation.IsConfigMapKey(key)...)
+		}
+	}
+	if len(errs) > 0 {
+		return true, nil, apierrors.NewBadRequest(fmt.Sprintf("invalid %s %s: %s", action.GetResource().Resource, obj.GetName(), strings.Join(errs, ", ")))
+	}
+	return false, nil, nil
+}
+
+// newTestServer serves the API over a manager of fake clients, with logins through a fake GitHub
+func newTestServer(t *testing.T) *httptest.Server {
+	github := newFakeGitHub(t)
+	return serve(t, func(appConfig *config.Config) auth.IdentityProvider {
+		appConfig.OAuth.GithubURL = github.URL
+		appConfig.OAuth.GithubAPIURL = github.URL
+		return auth.NewGitHubProvider(appConfig)
+	})
+}
+
+// newOIDCTestServer serves the API over a manager of fake clients, with logins through a fake
+// OIDC issuer
+func newOIDCTestServer(t *testing.T) *httptest.Server {
+	issuer := newFakeIssuer(t)
+	return serve(t, func(appConfig *config.Config) auth.IdentityProvider {
+		appConfig.OAuth.Provider = config.ProviderOIDC
+		appConfig.OAuth.OIDC.IssuerURL = issuer.URL
+		appConfig.OAuth.OIDC.ClientID = "teamspace"
+		provider, err := auth.NewIdentityProvider(t.Context(), appConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return provider
+	})
+}
+
+// serve serves the API over a manager of fake clients, with logins through the identity provider
+// returned for the test config
+func serve(t *testing.T, identityProvider func(*config.Config) auth.IdentityProvider) *httptest.Server {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	appConfig, err := config.LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := identityProvider(appConfig)
+
+	hypershift := "hypershift.openshift.io"
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		v1alpha1.TeamspaceResource: "TeamspaceList",
+		{Group: hypershift, Version: "v1beta1", Resource: "hostedclusters"}: "HostedClusterList",
+		{Group: hypershift, Version: "v1beta1", Resource: "nodepools"}:      "NodePoolList",
+	})
+	dynamicClient.PrependReactor("*", "*", validateMetadata)
+	kubeClient := fake.NewClientset()
+	kubeClient.PrependReactor("*", "*", validateMetadata)
+	manager, err := kubernetes.NewTeamspaceManagerForClients(appConfig, []kubernetes.Clients{{
+		Kubernetes: kubeClient,
+		Dynamic:    dynamicClient,
+		Metadata:   metadatafake.NewSimpleMetadataClient(metadatafake.NewTestScheme()),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Start(t.Context())
+	t.Cleanup(manager.Shutdown)
+	waitFor(t, "the cache to sync", manager.HasSynced)
+
+	store := sessions.NewCookieStore([]byte(appConfig.Session.HashKey), []byte(appConfig.Session.BlockKey))
+	store.Options = &sessions.Options{Path: "/", Secure: true}
+	authHandler := auth.NewAuthHandler(provider, appConfig, store, appConfig.App.AllowedTeams)
+
+	s := New(authHandler, manager, audit.NewLogger(), health.NewChecker())
+	server := httptest.NewTLSServer(s.Handler(t.TempDir()))
+	t.Cleanup(server.Close)
+	t.Cleanup(s.ShutDown)
+	return server
+}
+
+// newClient returns a client of the server that keeps its session cookie and doesn't follow redirects
+func newClient(t *testing.T, server *httptest.Server) *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Copied, as the server returns the same client every time
+	client := *server.Client()
+	client.Jar = jar
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &client
+}
+
+// login goes through the OAuth flow as the user and returns the status of the callback
+func login(t *testing.T, server *httptest.Server, client *http.Client, username string) int {
+	resp, err := client.Get(server.URL + "/auth/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake GitHub takes the username as the code. The fake OIDC issuer also needs the nonce
+	// of the login for the ID token, which GitHub doesn't issue.
+	code := username
+	if nonce := location.Query().Get("nonce"); nonce != "" {
+		code = url.Values{"username": {username}, "nonce": {nonce}}.Encode()
+	}
+	query := url.Values{"code": {code}, "state": {location.Query().Get("state")}}
+	resp, err = client.Get(server.URL + "/auth/callback?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// loggedIn returns a client with the session of the user
+func loggedIn(t *testing.T, server *httptest.Server, username string) *http.Client {
+	client := newClient(t, server)
+	if status := login(t, server, client, username); status != http.StatusTemporaryRedirect {
+		t.Fatalf("expected %s to log in, got %d", username, status)
+	}
+	return client
+}
+
+// do sends the request with a JSON body, when given one, and decodes the JSON response into out
+func do(t *testing.T, server *httptest.Server, client *http.Client, method, path string, body any, out any) int {
+	data := []byte{}
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode the response of %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// waitFor polls the condition until it holds, as reads are served from informers
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// create creates a teamspace as the client and waits for it to be cached
+func create(t *testing.T, server *httptest.Server, client *http.Client, name string) *kubernetes.Teamspace {
+	var teamspace kubernetes.Teamspace
+	if status := do(t, server, client, "POST", "/api/teamspaces", map[string]string{"name": name}, &teamspace); status != http.StatusCreated {
+		t.Fatalf("expected %s to be created, got %d", name, status)
+	}
+	waitFor(t, fmt.Sprintf("%s to be cached", name), func() bool {
+		return do(t, server, client, "GET", "/api/teamspaces/"+teamspace.ID, nil, nil) == http.StatusOK
+	})
+	return &teamspace
+}
+
+func TestAuth(t *testing.T) {
+	server := newTestServer(t)
+
+	anonymous := newClient(t, server)
+	if status := do(t, server, anonymous, "GET", "/api/teamspaces", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("expected anonymous requests to be unauthorized, got %d", status)
+	}
+	if status := login(t, server, newClient(t, server), "mallory"); status != http.StatusForbidden {
+		t.Errorf("expected a user outside the allowed teams to be refused, got %d", status)
+	}
+
+	alice := loggedIn(t, server, "alice")
+	var status struct {
+		Authenticated bool   `json:"authenticated"`
+		Username      string `json:"username"`
+		Admin         bool   `json:"admin"`
+	}
+	if code := do(t, server, alice, "GET", "/auth/status", nil, &status); code != http.StatusOK || !status.Authenticated || status.Username != "alice" || status.Admin {
+		t.Errorf("expected alice to be logged in without admin rights, got %d %+v", code, status)
+	}
+	if code := do(t, server, alice, "GET", "/api/admin/teamspaces", nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected admin routes to be forbidden to alice, got %d", code)
+	}
+
+	olivia := loggedIn(t, server, "olivia")
+	if code := do(t, server, olivia, "GET", "/api/admin/teamspaces", nil, nil); code != http.StatusOK {
+		t.Errorf("expected admin routes to be open to a member of an admin team, got %d", code)
+	}
+
+	if code := do(t, server, alice, "POST", "/auth/logout", nil, nil); code != http.StatusOK {
+		t.Fatalf("expected alice to log out, got %d", code)
+	}
+	if code := do(t, server, alice, "GET", "/api/teamspaces", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected requests after logging out to be unauthorized, got %d", code)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	server := newTestServer(t)
+	alice := loggedIn(t, server, "alice")
+	bob := loggedIn(t, server, "bob")
+	olivia := loggedIn(t, server, "olivia")
+
+	teamspace := create(t, server, alice, "dev")
+	if teamspace.Owner != "alice" {
+		t.Errorf("expected alice to own the teamspace, got %s", teamspace.Owner)
+	}
+
+	var listed []*kubernetes.Teamspace
+	if code := do(t, server, bob, "GET", "/api/teamspaces", nil, &listed); code != http.StatusOK || len(listed) != 0 {
+		t.Errorf("expected bob to list no teamspace, got %d %v", code, listed)
+	}
+	if code := do(t, server, bob, "GET", "/api/teamspaces/"+teamspace.ID, nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected bob not to see the teamspace of alice, got %d", code)
+	}
+	if code := do(t, server, bob, "DELETE", "/api/teamspaces/"+teamspace.ID, nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected bob not to delete the teamspace of alice, got %d", code)
+	}
+	if code := do(t, server, bob, "GET", "/api/teamspaces/missing-0123abcd", nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected a missing teamspace not to be found, got %d", code)
+	}
+
+	// Collaborators get the rights of their role and no more
+	if code := do(t, server, alice, "PUT", "/api/teamspaces/"+teamspace.ID+"/collaborators/bob", map[string]string{"role": "viewer"}, nil); code != http.StatusOK {
+		t.Fatalf("expected alice to add bob as a viewer, got %d", code)
+	}
+	waitFor(t, "bob to become a viewer", func() bool {
+		return do(t, server, bob, "GET", "/api/teamspaces/"+teamspace.ID, nil, nil) == http.StatusOK
+	})
+	if code := do(t, server, bob, "DELETE", "/api/teamspaces/"+teamspace.ID, nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected a viewer not to delete the teamspace, got %d", code)
+	}
+
+	if code := do(t, server, olivia, "GET", "/api/teamspaces/"+teamspace.ID, nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected admins to go through the admin routes, got %d", code)
+	}
+	if code := do(t, server, alice, "DELETE", "/api/teamspaces/"+teamspace.ID, nil, nil); code != http.StatusNoContent {
+		t.Errorf("expected alice to delete her teamspace, got %d", code)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	server := newTestServer(t)
+	alice := loggedIn(t, server, "alice")
+
+	create(t, server, alice, "first")
+	if code := do(t, server, alice, "POST", "/api/teamspaces", map[string]string{"name": "second"}, nil); code != http.StatusForbidden {
+		t.Errorf("expected a teamspace over the quota to be forbidden, got %d", code)
+	}
+
+	var status struct {
+		Limits struct {
+			Teamspaces *int `json:"teamspaces"`
+		} `json:"limits"`
+		Usage struct {
+			Teamspaces int `json:"teamspaces"`
+		} `json:"usage"`
+	}
+	if code := do(t, server, alice, "GET", "/api/me/quota", nil, &status); code != http.StatusOK {
+		t.Fatalf("expected the quota of alice, got %d", code)
+	}
+	if status.Limits.Teamspaces == nil || *status.Limits.Teamspaces != 1 || status.Usage.Teamspaces != 1 {
+		t.Errorf("expected alice to use 1 of 1 teamspaces, got %+v", status)
+	}
+
+	// Raising the limit of alice lets her create another one
+	olivia := loggedIn(t, server, "olivia")
+	if code := do(t, server, olivia, "PUT", "/api/admin/quotas/alice", map[string]int{"teamspaces": 2}, nil); code != http.StatusOK {
+		t.Fatalf("expected olivia to raise the quota of alice, got %d", code)
+	}
+	waitFor(t, "the quota override to apply", func() bool {
+		code := do(t, server, alice, "GET", "/api/me/quota", nil, &status)
+		return code == http.StatusOK && status.Limits.Teamspaces != nil && *status.Limits.Teamspaces == 2
+	})
+	create(t, server, alice, "second")
+}
+
+func TestCreateErrors(t *testing.T) {
+	server := newTestServer(t)
+	alice := loggedIn(t, server, "alice")
+	charlie := loggedIn(t, server, "charlie")
+	create(t, server, alice, "taken")
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		body   map[string]string
+		status int
+	}{
+		{name: "empty name", client: alice, body: map[string]string{"name": ""}, status: http.StatusBadRequest},
+		{name: "invalid name", client: alice, body: map[string]string{"name": "Not_Valid"}, status: http.StatusBadRequest},
+		{name: "invalid ttl", client: alice, body: map[string]string{"name": "dev", "ttl": "soon"}, status: http.StatusBadRequest},
+		{name: "unknown template", client: alice, body: map[string]string{"name": "dev", "template": "huge"}, status: http.StatusBadRequest},
+		{name: "unknown cluster", client: alice, body: map[string]string{"name": "dev", "cluster": "mars"}, status: http.StatusBadRequest},
+		{name: "name taken", client: alice, body: map[string]string{"name": "taken"}, status: http.StatusConflict},
+		{name: "no eligible cluster", client: charlie, body: map[string]string{"name": "dev"}, status: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := do(t, server, tt.client, "POST", "/api/teamspaces", tt.body, nil); code != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, code)
+			}
+		})
+	}
+
+	if code := do(t, server, alice, "GET", "/api/teamspaces/taken-0123abcd/kubeconfig", nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected the kubeconfig of a missing teamspace not to be found, got %d", code)
+	}
+}
+
+func TestOIDCUsersWithEmailUsernames(t *testing.T) {
+	server := newOIDCTestServer(t)
+	jane := loggedIn(t, server, "jane@example.com")
+	john := loggedIn(t, server, "john.doe@example.com")
+	ops := loggedIn(t, server, "ops@example.com")
+
+	// The username goes into labels and object names only once hashed
+	teamspace := create(t, server, jane, "dev")
+	if teamspace.Owner != "jane@example.com" {
+		t.Errorf("expected jane to own the teamspace, got %s", teamspace.Owner)
+	}
+
+	if code := do(t, server, jane, "PUT", "/api/teamspaces/"+teamspace.ID+"/collaborators/john.doe@example.com", map[string]string{"role": "viewer"}, nil); code != http.StatusOK {
+		t.Fatalf("expected jane to add john as a viewer, got %d", code)
+	}
+	waitFor(t, "john to become a viewer", func() bool {
+		return do(t, server, john, "GET", "/api/teamspaces/"+teamspace.ID, nil, nil) == http.StatusOK
+	})
+	if code := do(t, server, jane, "PUT", "/api/teamspaces/"+teamspace.ID+"/collaborators/%0A", map[string]string{"role": "viewer"}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected a username with a control character to be refused, got %d", code)
+	}
+
+	if code := do(t, server, ops, "PUT", "/api/admin/quotas/john.doe@example.com", map[string]int{"teamspaces": 2}, nil); code != http.StatusOK {
+		t.Fatalf("expected ops to raise the quota of john, got %d", code)
+	}
+	if code := do(t, server, jane, "POST", "/api/teamspaces/"+teamspace.ID+"/transfer", map[string]string{"to": "john.doe@example.com"}, nil); code != http.StatusAccepted {
+		t.Fatalf("expected jane to offer the teamspace to john, got %d", code)
+	}
+	waitFor(t, "john to accept the teamspace", func() bool {
+		return do(t, server, john, "POST", "/api/teamspaces/"+teamspace.ID+"/transfer/accept", nil, nil) == http.StatusOK
+	})
+	var transferred kubernetes.Teamspace
+	if code := do(t, server, john, "GET", "/api/teamspaces/"+teamspace.ID, nil, &transferred); code != http.StatusOK || transferred.Owner != "john.doe@example.com" {
+		t.Errorf("expected john to own the teamspace, got %d %s", code, transferred.Owner)
+	}
+}
+
+// unsyncedStore is a store whose reads find the cache not synced yet
+type unsyncedStore struct {
+	TeamspaceStore
+}
+
+func (unsyncedStore) QuotaOverrides() ([]kubernetes.QuotaOverride, error) {
+	return nil, kubernetes.ErrCacheNotSynced
+}
+
+func TestReadsBeforeTheCacheSyncedAreUnavailable(t *testing.T) {
+	s := New(nil, unsyncedStore{}, audit.NewLogger(), health.NewChecker())
+	rec := httptest.NewRecorder()
+	s.handleAdminListQuotaOverrides(rec, httptest.NewRequest("GET", "/api/admin/quotas", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("expected the client to be asked to retry, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+// ambiguousStore is a store whose teamspace exists in several clusters
+type ambiguousStore struct {
+	TeamspaceStore
+}
+
+func (ambiguousStore) ForceDeleteTeamspace(name string, clusterName string) error {
+	if clusterName == "" {
+		return fmt.Errorf("%w: %s exists in clusters east and west", kubernetes.ErrAmbiguousTeamspace, name)
+	}
+	return nil
+}
+
+func TestAmbiguousTeamspacesConflict(t *testing.T) {
+	s := New(nil, ambiguousStore{}, audit.NewLogger(), health.NewChecker())
+	for target, expected := range map[string]int{
+		"/api/admin/teamspaces/demo":              http.StatusConflict,
+		"/api/admin/teamspaces/demo?cluster=west": http.StatusNoContent,
+	} {
+		rec := httptest.NewRecorder()
+		s.handleAdminDeleteTeamspace(rec, mux.SetURLVars(httptest.NewRequest("DELETE", target, nil), map[string]string{"id": "demo"}))
+		if rec.Code != expected {
+			t.Errorf("expected %s to answer %d, got %d %q", target, expected, rec.Code, rec.Body.String())
+		}
+	}
+}
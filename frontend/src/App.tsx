@@ -1,20 +1,90 @@
-import { useEffect, useState, useMemo, useCallback } from 'react';
+import { useEffect, useState, useCallback } from 'react';
 import api from './api';
 import './App.css';
 import { Dialog, DialogActions, DialogContent, DialogTitle, TextField, MenuItem } from '@mui/material';
 import { Button } from '@mui/material';
 
 interface Teamspace {
+  id: string;
   name: string;
   namespace: string;
   createdAt: string;
   deletionTimestamp?: string;
+  phase?: string;
+  lastError?: string;
+  expiresAt?: string;
+  owner?: string;
+  template?: string;
+  cluster?: string;
+  placement?: string;
+  role?: Role;
+  collaborators?: { username: string; role: Role }[];
+  pendingTransfer?: { to: string; requestedBy: string; requestedAt: string };
   isDeleting?: boolean;
 }
 
+interface Template {
+  name: string;
+  description?: string;
+  release?: string;
+  nodePoolReplicas: number;
+  instanceType?: string;
+  default?: boolean;
+}
+
+interface Cluster {
+  name: string;
+  region?: string;
+  default?: boolean;
+}
+
+interface QuotaLimits {
+  teamspaces: number | null;
+  nodes: number | null;
+  clusterHours: number | null;
+}
+
+interface Quota {
+  limits: QuotaLimits;
+  usage: { teamspaces: number; nodes: number; clusterHours: number };
+  remaining: QuotaLimits;
+}
+
+type Role = 'viewer' | 'editor' | 'admin' | 'owner';
+
+const roleRank: Record<Role, number> = { viewer: 1, editor: 2, admin: 3, owner: 4 };
+
+// Mirrors the role checks done by the backend, to hide actions the user cannot take
+function hasRole(ts: Teamspace, required: Role): boolean {
+  // Recipients of a pending transfer are listed without a role until they accept it
+  if (!ts.role && ts.pendingTransfer) {
+    return false;
+  }
+  return roleRank[ts.role ?? 'owner'] >= roleRank[required];
+}
+
+// Formats the time left before a teamspace expires, e.g. "2d 4h" or "35m"
+function formatRemaining(expiresAt: string, now: number): string {
+  const remaining = new Date(expiresAt).getTime() - now;
+  if (remaining <= 0) {
+    return 'expired';
+  }
+  const minutes = Math.floor(remaining / 60000);
+  const days = Math.floor(minutes / 1440);
+  const hours = Math.floor((minutes % 1440) / 60);
+  if (days > 0) {
+    return `${days}d ${hours}h`;
+  }
+  if (hours > 0) {
+    return `${hours}h ${minutes % 60}m`;
+  }
+  return `${minutes}m`;
+}
+
 function App() {
   const [isAuthenticated, setIsAuthenticated] = useState<boolean | null>(null);
   const [username, setUsername] = useState<string | null>(null);
+  const [authProvider, setAuthProvider] = useState<string>('GitHub');
   const [teamspaces, setTeamspaces] = useState<Teamspace[]>([]);
   const [fetchingError, setFetchingError] = useState<string | null>(null);
   const [copiedCommand, setCopiedCommand] = useState<string | null>(null);
@@ -22,11 +92,19 @@ function App() {
   const [newTeamspaceName, setNewTeamspaceName] = useState('');
   const [newInitialHostedClusterRelease, setNewInitialHostedClusterRelease] = useState('quay.io/openshift-release-dev/ocp-release:4.19.0-ec.5-multi');
   const [featureSet, setFeatureSet] = useState('Default');
+  const [templates, setTemplates] = useState<Template[]>([]);
+  const [template, setTemplate] = useState('');
+  const [clusters, setClusters] = useState<Cluster[]>([]);
+  const [cluster, setCluster] = useState('');
+  const [region, setRegion] = useState('');
+  const [quota, setQuota] = useState<Quota | null>(null);
+  const [now, setNow] = useState(Date.now());
 
-  // Check if any teamspace is in deleting state for polling
-  const hasDeleteInProgress = useMemo(() => {
-    return teamspaces.some(ts => ts.isDeleting || !!ts.deletionTimestamp);
-  }, [teamspaces]);
+  // Tick once a minute to keep the expiry countdowns current
+  useEffect(() => {
+    const interval = setInterval(() => setNow(Date.now()), 60000);
+    return () => clearInterval(interval);
+  }, []);
 
   // Function to fetch teamspaces
   const fetchTeamspaces = useCallback(async () => {
@@ -36,7 +114,7 @@ function App() {
       setTeamspaces(prev => {
         return response.data?.map((ts: Teamspace) => {
           // Preserve the isDeleting flag from previous state
-          const prevTeamspace = prev.find(p => p.name === ts.name);
+          const prevTeamspace = prev.find(p => p.id === ts.id);
           const isBeingDeleted = !!ts.deletionTimestamp || (prevTeamspace?.isDeleting === true);
           return {
             ...ts,
@@ -50,18 +128,96 @@ function App() {
     }
   }, []);
 
-  // Polling effect
+  // Live updates: the server sends a reset followed by the current teamspaces, then every change.
+  // EventSource reconnects on its own and resumes from the last event id it received.
   useEffect(() => {
-    // If any deletion is in progress, poll more frequently
-    if (hasDeleteInProgress) {
-      const interval = setInterval(() => {
-        console.log('Polling for teamspace status during deletion...');
-        fetchTeamspaces();
-      }, 3000); // Poll every 3 seconds when deletion is in progress
-      
-      return () => clearInterval(interval);
+    if (!isAuthenticated) {
+      return;
     }
-  }, [hasDeleteInProgress, fetchTeamspaces]);
+
+    const source = new EventSource('/api/teamspaces/watch', { withCredentials: true });
+
+    const upsert = (event: MessageEvent) => {
+      const ts: Teamspace = JSON.parse(event.data);
+      setTeamspaces(prev => {
+        const prevTeamspace = prev.find(p => p.id === ts.id);
+        const updated = {
+          ...ts,
+          isDeleting: !!ts.deletionTimestamp || prevTeamspace?.isDeleting === true
+        };
+        if (!prevTeamspace) {
+          return [...prev, updated];
+        }
+        return prev.map(p => p.id === ts.id ? updated : p);
+      });
+    };
+
+    source.addEventListener('reset', () => setTeamspaces([]));
+    source.addEventListener('added', upsert);
+    source.addEventListener('modified', upsert);
+    source.addEventListener('deleted', (event: MessageEvent) => {
+      const ts: Teamspace = JSON.parse(event.data);
+      setTeamspaces(prev => prev.filter(p => p.id !== ts.id));
+    });
+    source.onerror = () => {
+      console.warn('Teamspace event stream interrupted, reconnecting...');
+    };
+
+    return () => source.close();
+  }, [isAuthenticated]);
+
+  // Refresh the quota whenever the teamspaces change, so the remaining capacity stays current
+  useEffect(() => {
+    if (!isAuthenticated) {
+      return;
+    }
+    api.get('/api/me/quota').then(
+      (response) => setQuota(response.data),
+      (err) => console.error('Failed to fetch quota:', err)
+    );
+  }, [isAuthenticated, teamspaces]);
+
+  // Load the templates offered in the create dialog, preselecting the default one
+  useEffect(() => {
+    if (!isAuthenticated) {
+      return;
+    }
+    api.get('/api/templates').then(
+      (response) => {
+        const loaded: Template[] = response.data || [];
+        setTemplates(loaded);
+        const defaultTemplate = loaded.find(t => t.default);
+        if (defaultTemplate) {
+          selectTemplate(defaultTemplate);
+        }
+      },
+      (err) => console.error('Failed to fetch templates:', err)
+    );
+  }, [isAuthenticated]);
+
+  // Load the management clusters; an empty selection lets the server place the teamspace
+  useEffect(() => {
+    if (!isAuthenticated) {
+      return;
+    }
+    api.get('/api/clusters').then(
+      (response) => {
+        const loaded: Cluster[] = response.data || [];
+        setClusters(loaded);
+      },
+      (err) => console.error('Failed to fetch clusters:', err)
+    );
+  }, [isAuthenticated]);
+
+  // Regions the user can prefer when the server places the teamspace
+  const regions = [...new Set(clusters.flatMap(c => (c.region ? [c.region] : [])))];
+
+  const selectTemplate = (selected?: Template) => {
+    setTemplate(selected?.name ?? '');
+    if (selected?.release) {
+      setNewInitialHostedClusterRelease(selected.release);
+    }
+  };
 
   // Initial auth status check
   useEffect(() => {
@@ -72,6 +228,9 @@ function App() {
         });
         
         console.log('Authentication status:', response.data);
+        if (response.data.provider) {
+          setAuthProvider(response.data.provider);
+        }
         
         if (response.data.authenticated) {
           setIsAuthenticated(true);
@@ -114,7 +273,10 @@ function App() {
       const createResponse = await api.post('/api/teamspaces', {
         name: newTeamspaceName,
         initialHostedClusterRelease: newInitialHostedClusterRelease,
-        featureSet: featureSetValue
+        featureSet: featureSetValue,
+        template,
+        cluster,
+        region
       });
       console.log('Create response:', createResponse.data);
       const response = await api.get('/api/teamspaces');
@@ -127,7 +289,7 @@ function App() {
     }
   };
 
-  const handleDeleteTeamspace = async (name: string) => {
+  const handleDeleteTeamspace = async (id: string, name: string) => {
     if (!isAuthenticated) {
       alert('Please login first');
       return;
@@ -144,12 +306,12 @@ function App() {
       // Mark the teamspace as deleting in the UI immediately
       setTeamspaces(prev => 
         prev.map(ts => 
-          ts.name === name ? { ...ts, isDeleting: true } : ts
+          ts.id === id ? { ...ts, isDeleting: true } : ts
         )
       );
       
       // Send delete request to backend
-      await api.delete(`/api/teamspaces/${name}`);
+      await api.delete(`/api/teamspaces/${id}`);
       
       // Fetch updated teamspaces that include deletion timestamps
       await fetchTeamspaces();
@@ -161,7 +323,7 @@ function App() {
       // If delete fails, remove the deleting flag
       setTeamspaces(prev => 
         prev.map(ts => 
-          ts.name === name ? { ...ts, isDeleting: false } : ts
+          ts.id === id ? { ...ts, isDeleting: false } : ts
         )
       );
       
@@ -169,6 +331,86 @@ function App() {
     }
   };
 
+  const handleExtendTeamspace = async (id: string) => {
+    try {
+      // The updated expiry arrives through the event stream
+      await api.post(`/api/teamspaces/${id}/extend`);
+    } catch (err) {
+      console.error('Failed to extend teamspace:', err);
+      alert('Failed to extend teamspace: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    }
+  };
+
+  const handlePowerTransition = async (id: string, action: 'hibernate' | 'resume') => {
+    try {
+      // The new phase arrives through the event stream
+      await api.post(`/api/teamspaces/${id}/${action}`);
+    } catch (err) {
+      console.error(`Failed to ${action} teamspace:`, err);
+      alert(`Failed to ${action} teamspace: ` + (err instanceof Error ? err.message : 'Unknown error'));
+    }
+  };
+
+  const handleShareTeamspace = async (id: string) => {
+    const collaborator = prompt('Username to share this teamspace with:');
+    if (!collaborator) {
+      return;
+    }
+    const role = prompt('Role (viewer, editor or admin):', 'viewer');
+    if (!role) {
+      return;
+    }
+    try {
+      await api.put(`/api/teamspaces/${id}/collaborators/${encodeURIComponent(collaborator)}`, { role });
+    } catch (err) {
+      console.error('Failed to share teamspace:', err);
+      alert('Failed to share teamspace: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    }
+  };
+
+  const handleRemoveCollaborator = async (id: string, name: string, collaborator: string) => {
+    if (!confirm(`Remove ${collaborator} from teamspace "${name}"?`)) {
+      return;
+    }
+    try {
+      await api.delete(`/api/teamspaces/${id}/collaborators/${encodeURIComponent(collaborator)}`);
+    } catch (err) {
+      console.error('Failed to remove collaborator:', err);
+      alert('Failed to remove collaborator: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    }
+  };
+
+  const handleTransferTeamspace = async (id: string, name: string) => {
+    const to = prompt(`Username to transfer teamspace "${name}" to. They become the owner once they accept:`);
+    if (!to) {
+      return;
+    }
+    try {
+      await api.post(`/api/teamspaces/${id}/transfer`, { to });
+    } catch (err) {
+      console.error('Failed to transfer teamspace:', err);
+      alert('Failed to transfer teamspace: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    }
+  };
+
+  const handleAcceptTransfer = async (id: string) => {
+    try {
+      await api.post(`/api/teamspaces/${id}/transfer/accept`);
+    } catch (err) {
+      console.error('Failed to accept transfer:', err);
+      alert('Failed to accept transfer: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    }
+  };
+
+  const handleCancelTransfer = async (id: string) => {
+    try {
+      await api.delete(`/api/teamspaces/${id}/transfer`);
+    } catch (err) {
+      console.error('Failed to cancel transfer:', err);
+      alert('Failed to cancel transfer: ' + (err instanceof Error ? err.message : 'Unknown error'));
+    }
+  };
+
   const handleLogout = async () => {
     try {
       // Show loading state
@@ -217,9 +459,9 @@ function App() {
     );
   };
 
-  const downloadKubeconfig = async (teamspaceName: string) => {
+  const downloadKubeconfig = async (id: string, teamspaceName: string) => {
     try {
-      const response = await fetch(`/api/teamspaces/${teamspaceName}/kubeconfig`, {
+      const response = await fetch(`/api/teamspaces/${id}/kubeconfig`, {
         method: 'GET',
         credentials: 'include', // Include cookies for authentication
       });
@@ -266,7 +508,7 @@ function App() {
                 </>
               ) : (
                 <a href="/auth/login" className="btn">
-                  Login with GitHub
+                  {`Login with ${authProvider}`}
                 </a>
               )}
             </>
@@ -288,9 +530,20 @@ function App() {
         {isAuthenticated ? (
           <div className="teamspaces-container">
             <h2>Your Teamspaces</h2>
-            <button onClick={handleOpen} className="btn">
+            <button
+              onClick={handleOpen}
+              className="btn"
+              disabled={quota?.remaining.teamspaces === 0}
+            >
               Create New Teamspace
             </button>
+            {quota && (
+              <p className="quota">
+                {quota.limits.teamspaces !== null && `${quota.usage.teamspaces} of ${quota.limits.teamspaces} teamspaces`}
+                {quota.limits.nodes !== null && ` · ${quota.usage.nodes} of ${quota.limits.nodes} nodes`}
+                {quota.limits.clusterHours !== null && ` · ${Math.round(quota.usage.clusterHours)} of ${quota.limits.clusterHours} cluster-hours`}
+              </p>
+            )}
 
             <Dialog open={open} onClose={handleClose}>
               <DialogTitle>Create New Teamspace</DialogTitle>
@@ -304,6 +557,57 @@ function App() {
                   value={newTeamspaceName}
                   onChange={(e) => setNewTeamspaceName(e.target.value)}
                 />
+                {templates.length > 0 && (
+                  <TextField
+                    select
+                    label="Template"
+                    value={template}
+                    onChange={(e) => selectTemplate(templates.find(t => t.name === e.target.value))}
+                    fullWidth
+                    margin="dense"
+                    helperText={templates.find(t => t.name === template)?.description}
+                  >
+                    {templates.map(t => (
+                      <MenuItem key={t.name} value={t.name}>
+                        {t.name} ({t.nodePoolReplicas} {t.nodePoolReplicas === 1 ? 'node' : 'nodes'}{t.instanceType ? `, ${t.instanceType}` : ''})
+                      </MenuItem>
+                    ))}
+                  </TextField>
+                )}
+                {clusters.length > 1 && (
+                  <TextField
+                    select
+                    label="Cluster"
+                    value={cluster}
+                    onChange={(e) => setCluster(e.target.value)}
+                    fullWidth
+                    margin="dense"
+                  >
+                    <MenuItem value="">Automatic</MenuItem>
+                    {clusters.map(c => (
+                      <MenuItem key={c.name} value={c.name}>
+                        {c.name}{c.region ? ` (${c.region})` : ''}
+                      </MenuItem>
+                    ))}
+                  </TextField>
+                )}
+                {!cluster && regions.length > 1 && (
+                  <TextField
+                    select
+                    label="Preferred region"
+                    value={region}
+                    onChange={(e) => setRegion(e.target.value)}
+                    fullWidth
+                    margin="dense"
+                  >
+                    <MenuItem value="">Any</MenuItem>
+                    {regions.map(r => (
+                      <MenuItem key={r} value={r}>
+                        {r}
+                      </MenuItem>
+                    ))}
+                  </TextField>
+                )}
                 <TextField
                   margin="dense"
                   label="Initial HostedCluster Release"
@@ -352,6 +656,50 @@ function App() {
                     </h3>
                     <p>Namespace: {teamspace.namespace}</p>
                     <p>Created: {new Date(teamspace.createdAt).toLocaleString()}</p>
+                    {teamspace.template && <p>Template: {teamspace.template}</p>}
+                    {clusters.length > 1 && teamspace.cluster && <p title={teamspace.placement}>Cluster: {teamspace.cluster}</p>}
+                    {teamspace.phase && <p>Status: {teamspace.phase}</p>}
+                    {teamspace.lastError && <p className="error">{teamspace.lastError}</p>}
+                    {teamspace.role && teamspace.role !== 'owner' && (
+                      <p>Shared by {teamspace.owner} ({teamspace.role})</p>
+                    )}
+                    {teamspace.collaborators && teamspace.collaborators.length > 0 && (
+                      <p>
+                        Collaborators:{' '}
+                        {teamspace.collaborators.map((c) => (
+                          <span key={c.username} className="collaborator">
+                            {c.username} ({c.role})
+                            {(hasRole(teamspace, 'admin') || c.username.toLowerCase() === username?.toLowerCase()) && (
+                              <button className="copy-btn" onClick={() => handleRemoveCollaborator(teamspace.id, teamspace.name, c.username)}>
+                                Remove
+                              </button>
+                            )}{' '}
+                          </span>
+                        ))}
+                      </p>
+                    )}
+                    {teamspace.pendingTransfer && (
+                      <p className="transfer">
+                        {teamspace.pendingTransfer.to.toLowerCase() === username?.toLowerCase()
+                          ? `${teamspace.pendingTransfer.requestedBy} wants to transfer this teamspace to you`
+                          : `Waiting for ${teamspace.pendingTransfer.to} to accept the transfer`}{' '}
+                        {teamspace.pendingTransfer.to.toLowerCase() === username?.toLowerCase() && (
+                          <button className="copy-btn" onClick={() => handleAcceptTransfer(teamspace.id)}>
+                            Accept
+                          </button>
+                        )}
+                        {(hasRole(teamspace, 'owner') || teamspace.pendingTransfer.to.toLowerCase() === username?.toLowerCase()) && (
+                          <button className="copy-btn" onClick={() => handleCancelTransfer(teamspace.id)}>
+                            {hasRole(teamspace, 'owner') ? 'Cancel' : 'Decline'}
+                          </button>
+                        )}
+                      </p>
+                    )}
+                    {teamspace.expiresAt && (
+                      <p title={new Date(teamspace.expiresAt).toLocaleString()}>
+                        Expires in: {formatRemaining(teamspace.expiresAt, now)}
+                      </p>
+                    )}
                     
                     <div className="commands-section">
                       <h4>Commands</h4>
@@ -361,9 +709,9 @@ function App() {
                           <code>export KUBECONFIG=~/Downloads/kubeconfig-{teamspace.name}.yaml</code>
                           <button 
                             className="copy-btn"
-                            onClick={() => copyToClipboard(`export KUBECONFIG=~/Downloads/kubeconfig-${teamspace.name}.yaml`, `export-${teamspace.name}`)}
+                            onClick={() => copyToClipboard(`export KUBECONFIG=~/Downloads/kubeconfig-${teamspace.name}.yaml`, `export-${teamspace.id}`)}
                           >
-                            {copiedCommand === `export-${teamspace.name}` ? 'Copied!' : 'Copy'}
+                            {copiedCommand === `export-${teamspace.id}` ? 'Copied!' : 'Copy'}
                           </button>
                         </div>
                       </div>
@@ -374,9 +722,9 @@ function App() {
                           <code>kubectl annotate hc dev hypershift.openshift.io/image-overrides="cluster-ingress-operator=example.com/cno:latest"</code>
                           <button 
                             className="copy-btn"
-                            onClick={() => copyToClipboard(`kubectl annotate hc dev hypershift.openshift.io/image-overrides="cluster-ingress-operator=example.com/cno:latest"`, teamspace.name)}
+                            onClick={() => copyToClipboard(`kubectl annotate hc dev hypershift.openshift.io/image-overrides="cluster-ingress-operator=example.com/cno:latest"`, teamspace.id)}
                           >
-                            {copiedCommand === teamspace.name ? 'Copied!' : 'Copy'}
+                            {copiedCommand === teamspace.id ? 'Copied!' : 'Copy'}
                           </button>
                         </div>
                       </div>
@@ -387,9 +735,9 @@ function App() {
                           <code>kubectl annotate hc dev hypershift.openshift.io/image-overrides="" --overwrite</code>
                           <button 
                             className="copy-btn"
-                            onClick={() => copyToClipboard(`kubectl annotate hc dev hypershift.openshift.io/image-overrides="" --overwrite`, `restore-${teamspace.name}`)}
+                            onClick={() => copyToClipboard(`kubectl annotate hc dev hypershift.openshift.io/image-overrides="" --overwrite`, `restore-${teamspace.id}`)}
                           >
-                            {copiedCommand === `restore-${teamspace.name}` ? 'Copied!' : 'Copy'}
+                            {copiedCommand === `restore-${teamspace.id}` ? 'Copied!' : 'Copy'}
                           </button>
                         </div>
                       </div>
@@ -397,12 +745,12 @@ function App() {
                       <div className="command-item">
                         <p>Inspect control plane pods:</p>
                         <div className="command-box">
-                          <code>kubectl get pods -nteamspace-{teamspace.name}-dev</code>
+                          <code>kubectl get pods -n{teamspace.namespace}-dev</code>
                           <button 
                             className="copy-btn"
-                            onClick={() => copyToClipboard(`kubectl get pods -nteamspace-${teamspace.name}-dev`, `pods-${teamspace.name}`)}
+                            onClick={() => copyToClipboard(`kubectl get pods -n${teamspace.namespace}-dev`, `pods-${teamspace.id}`)}
                           >
-                            {copiedCommand === `pods-${teamspace.name}` ? 'Copied!' : 'Copy'}
+                            {copiedCommand === `pods-${teamspace.id}` ? 'Copied!' : 'Copy'}
                           </button>
                         </div>
                       </div>
@@ -413,33 +761,83 @@ function App() {
                           <code>kubectl get secret -n {teamspace.namespace} dev-admin-kubeconfig -o jsonpath='{'{.data.kubeconfig}'}' | base64 -d &gt; kubeconfig-{teamspace.name}-hostedcluster</code>
                           <button 
                             className="copy-btn"
-                            onClick={() => copyToClipboard(`kubectl get secret -n ${teamspace.namespace} dev-admin-kubeconfig -o jsonpath='{.data.kubeconfig}' | base64 -d > kubeconfig-${teamspace.name}-hostedcluster`, `hostedcluster-${teamspace.name}`)}
+                            onClick={() => copyToClipboard(`kubectl get secret -n ${teamspace.namespace} dev-admin-kubeconfig -o jsonpath='{.data.kubeconfig}' | base64 -d > kubeconfig-${teamspace.name}-hostedcluster`, `hostedcluster-${teamspace.id}`)}
                           >
-                            {copiedCommand === `hostedcluster-${teamspace.name}` ? 'Copied!' : 'Copy'}
+                            {copiedCommand === `hostedcluster-${teamspace.id}` ? 'Copied!' : 'Copy'}
                           </button>
                         </div>
                       </div>
                     </div>
                       
                     <div className="teamspace-actions">
-                      <button
-                        onClick={() => downloadKubeconfig(teamspace.name)}
-                        className="btn"
-                        style={{ 
-                          opacity: (teamspace.isDeleting || teamspace.deletionTimestamp) ? 0.5 : 1,
-                          pointerEvents: (teamspace.isDeleting || teamspace.deletionTimestamp) ? 'none' : 'auto'
-                        }}
-                        disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp}
-                      >
-                        Download Kubeconfig
-                      </button>
-                      <button
-                        onClick={() => handleDeleteTeamspace(teamspace.name)}
-                        className="btn btn-danger"
-                        disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp}
-                      >
-                        {(teamspace.isDeleting || teamspace.deletionTimestamp) ? 'Deleting...' : 'Delete'}
-                      </button>
+                      {hasRole(teamspace, 'editor') && (
+                        <>
+                          <button
+                            onClick={() => downloadKubeconfig(teamspace.id, teamspace.name)}
+                            className="btn"
+                            style={{ 
+                              opacity: (teamspace.isDeleting || teamspace.deletionTimestamp) ? 0.5 : 1,
+                              pointerEvents: (teamspace.isDeleting || teamspace.deletionTimestamp) ? 'none' : 'auto'
+                            }}
+                            disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp}
+                          >
+                            Download Kubeconfig
+                          </button>
+                          {teamspace.phase === 'Hibernated' ? (
+                            <button
+                              onClick={() => handlePowerTransition(teamspace.id, 'resume')}
+                              className="btn"
+                              disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp}
+                            >
+                              Resume
+                            </button>
+                          ) : (
+                            <button
+                              onClick={() => handlePowerTransition(teamspace.id, 'hibernate')}
+                              className="btn"
+                              disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp || teamspace.phase !== 'Ready'}
+                            >
+                              Hibernate
+                            </button>
+                          )}
+                          {teamspace.expiresAt && (
+                            <button
+                              onClick={() => handleExtendTeamspace(teamspace.id)}
+                              className="btn"
+                              disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp}
+                            >
+                              Extend
+                            </button>
+                          )}
+                        </>
+                      )}
+                      {hasRole(teamspace, 'admin') && (
+                        <>
+                          <button
+                            onClick={() => handleShareTeamspace(teamspace.id)}
+                            className="btn"
+                            disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp}
+                          >
+                            Share
+                          </button>
+                          {hasRole(teamspace, 'owner') && (
+                            <button
+                              onClick={() => handleTransferTeamspace(teamspace.id, teamspace.name)}
+                              className="btn"
+                              disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp}
+                            >
+                              Transfer
+                            </button>
+                          )}
+                          <button
+                            onClick={() => handleDeleteTeamspace(teamspace.id, teamspace.name)}
+                            className="btn btn-danger"
+                            disabled={teamspace.isDeleting || !!teamspace.deletionTimestamp}
+                          >
+                            {(teamspace.isDeleting || teamspace.deletionTimestamp) ? 'Deleting...' : 'Delete'}
+                          </button>
+                        </>
+                      )}
                     </div>
                   </div>
                 ))